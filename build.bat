@@ -2,8 +2,9 @@
 echo Building AndroidSafeLocal...
 set CGO_ENABLED=1
 go build -ldflags "-H=windowsgui" -o AndroidSafeLocal.exe ./cmd/android-safe-local
+if %ERRORLEVEL% EQU 0 go build -o AndroidSafeLocal-cli.exe ./cmd/android-safe-local-cli
 if %ERRORLEVEL% EQU 0 (
-    echo Build Successful! Run AndroidSafeLocal.exe to start.
+    echo Build Successful! Run AndroidSafeLocal.exe to start, or AndroidSafeLocal-cli.exe for the command line.
 ) else (
     echo Build Failed!
     exit /b %ERRORLEVEL%
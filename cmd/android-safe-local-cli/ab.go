@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"AndroidSafeLocal/internal/ab"
+	"AndroidSafeLocal/internal/backup"
+)
+
+func runAB(args []string) error {
+	fs := flag.NewFlagSet("ab", flag.ExitOnError)
+	in := fs.String("in", "", "Android backup (.ab) to list, convert or restore, or tar to convert")
+	out := fs.String("out", "", "Converted file: .tar for a .ab input, .ab for a tar input, or the .ab -take writes")
+	encrypt := fs.Bool("encrypt", false, "Encrypt the .ab made from a tar with a password")
+	take := fs.String("take", "", "Comma separated packages to back up from the device with adb backup into -out")
+	restore := fs.Bool("restore", false, "Restore -in to the device with adb restore")
+	fs.Parse(args)
+
+	switch {
+	case *take != "":
+		if *out == "" {
+			return fmt.Errorf("-take needs -out")
+		}
+		client, err := connect()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Confirm the backup on the device; a password set there encrypts the file.")
+		if err := client.BackupArchive(*out, strings.Split(*take, ",")); err != nil {
+			return err
+		}
+		info, err := os.Stat(*out)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (%s).\n", *out, backup.FormatBytes(info.Size()))
+		return nil
+
+	case *in == "":
+		return fmt.Errorf("-in or -take is required")
+
+	case *restore:
+		if _, err := abPassword(*in, false); err != nil && !errors.Is(err, ab.ErrPasswordRequired) {
+			return err
+		}
+		client, err := connect()
+		if err != nil {
+			return err
+		}
+		if !confirm(fmt.Sprintf("Restore %s? Its apps' data on the device is replaced", *in)) {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+		fmt.Println("Confirm the restore on the device and enter the backup password there if it has one.")
+		return client.RestoreArchive(*in)
+	}
+
+	src, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if strings.HasSuffix(strings.ToLower(*in), ".tar") {
+		if *out == "" {
+			return fmt.Errorf("converting a tar needs -out")
+		}
+		password := ""
+		if *encrypt {
+			if password, err = readPassphrase("New backup password", true); err != nil {
+				return err
+			}
+		}
+		return writeFile(*out, func(f *os.File) error {
+			files, err := ab.FromTar(f, src, password)
+			if err == nil {
+				fmt.Printf("Packed %d files into %s.\n", files, *out)
+			}
+			return err
+		})
+	}
+
+	password, err := abPassword(*in, true)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return writeFile(*out, func(f *os.File) error {
+			_, err := ab.ToTar(f, src, password)
+			if err == nil {
+				fmt.Printf("Wrote the tar stream of %s to %s.\n", *in, *out)
+			}
+			return err
+		})
+	}
+
+	h, entries, err := ab.List(src, password)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, e := range entries {
+		if e.Dir {
+			continue
+		}
+		size += e.Size
+		owner := e.Package
+		if owner == "" {
+			owner = "(shared storage)"
+		}
+		fmt.Printf("%-40s %-10s %10s  %s\n", owner, e.Domain, backup.FormatBytes(e.Size), e.Path)
+	}
+	fmt.Printf("Android backup version %d, encryption %s: %d entries, %s.\n", h.Version, h.Encryption, len(entries), backup.FormatBytes(size))
+	return nil
+}
+
+// abPassword reads the header of a .ab file and, if it is encrypted and ask is
+// set, the password for it
+func abPassword(path string, ask bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r, err := ab.NewReader(f, "")
+	if errors.Is(err, ab.ErrPasswordRequired) && ask {
+		return readPassphrase("Backup password for "+path, false)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", r.Close()
+}
+
+// writeFile creates path and fills it with write, removing it again on error
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
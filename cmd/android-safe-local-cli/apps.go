@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"AndroidSafeLocal/internal/apps"
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func runApps(args []string) error {
+	fs := flag.NewFlagSet("apps", flag.ExitOnError)
+	dest := fs.String("dest", "", "Backup folder or sftp://, webdav://, s3:// URL the APKs go to (required)")
+	restore := fs.Bool("restore", false, "Reinstall apps from the backup instead of backing them up")
+	only := fs.String("only", "", "Comma separated package names, default all user-installed (or backed up) apps")
+	list := fs.Bool("list", false, "List the apps and exit")
+	yes := fs.Bool("yes", false, "Start without asking for confirmation")
+	fs.Parse(args)
+
+	if *dest == "" {
+		return fmt.Errorf("-dest is required")
+	}
+	if !*restore && !storage.IsRemote(*dest) {
+		if r, err := repo.Open(*dest); err == nil && r.Encrypted() {
+			return fmt.Errorf("%s is an encrypted repository, the APKs would be stored unencrypted next to it", *dest)
+		}
+	}
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(*only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+	st, err := storage.Open(*dest)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+
+	if *restore {
+		ix, err := apps.Load(st)
+		if err != nil {
+			return err
+		}
+		var chosen []apps.App
+		for _, app := range ix.Latest() {
+			if len(selected) == 0 || selected[app.Package] {
+				chosen = append(chosen, app)
+			}
+		}
+		for _, app := range chosen {
+			fmt.Printf("%-50s %10s  backed up %s\n", app, backup.FormatBytes(app.Size), app.BackedUp)
+		}
+		fmt.Printf("%d apps to reinstall.\n", len(chosen))
+		if *list || len(chosen) == 0 {
+			return nil
+		}
+		if !*yes && !confirm("Reinstall these apps?") {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+		failures := 0
+		apps.Restore(client, st, chosen, func(res apps.Result) {
+			if res.Err != nil {
+				failures++
+				fmt.Printf("FAIL: %s (%v)\n", res.App, res.Err)
+				return
+			}
+			fmt.Printf("Installed %s\n", res.App)
+		})
+		fmt.Printf("Reinstalled %d apps. Failures: %d\n", len(chosen)-failures, failures)
+		return nil
+	}
+
+	pkgs, err := client.Packages()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, p := range pkgs {
+		if len(selected) == 0 || selected[p.Name] {
+			names = append(names, p.Name)
+			fmt.Println(p.Name)
+		}
+	}
+	fmt.Printf("%d user-installed apps selected.\n", len(names))
+	if *list || len(names) == 0 {
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Back up their APKs to %s?", st)) {
+		fmt.Println("Backup cancelled.")
+		return nil
+	}
+	var stored, skipped, failures int
+	_, err = apps.Backup(client, st, names, func(res apps.Result) {
+		switch {
+		case res.Err != nil:
+			failures++
+			fmt.Printf("FAIL: %s (%v)\n", res.App.Package, res.Err)
+		case res.Skipped:
+			skipped++
+		default:
+			stored++
+			fmt.Printf("Stored %s (%d APKs, %s)\n", res.App, len(res.App.APKs), backup.FormatBytes(res.App.Size))
+		}
+	})
+	fmt.Printf("Apps stored: %d, already in the backup: %d, failures: %d\n", stored, skipped, failures)
+	return err
+}
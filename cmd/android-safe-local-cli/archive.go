@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"AndroidSafeLocal/internal/archive"
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/snapshot"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder (required)")
+	out := fs.String("out", "", "Archive to write, - for stdout (required)")
+	format := fs.String("format", "", fmt.Sprintf("One of %v (default: from the -out extension)", archive.Formats))
+	snapshotName := fs.String("snapshot", "", "Export the files of this snapshot instead of the latest ones")
+	query := queryFlags(fs)
+	fs.Parse(args)
+
+	if *src == "" || *out == "" {
+		return fmt.Errorf("-src and -out are required")
+	}
+	f, err := archiveFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+	q, err := query()
+	if err != nil {
+		return err
+	}
+	repository, err := unlock(*src)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.LoadSealed(*src, repository.Sealer())
+	if *snapshotName != "" {
+		_, m, err = snapshot.Load(*src, *snapshotName, repository.Sealer())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read manifest: %w", err)
+	}
+	entries := m.Select(q)
+	if len(entries) == 0 {
+		return fmt.Errorf("no files selected")
+	}
+
+	open := archive.FileOpener(*src)
+	if repository != nil {
+		open = repository.OpenEntry
+		if repository.Encrypted() {
+			fmt.Fprintln(os.Stderr, "Note: the archive holds the decrypted files.")
+		}
+	}
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	res, err := archive.Export(w, f, entries, open)
+	if err != nil {
+		if *out != "-" {
+			os.Remove(*out)
+		}
+		return err
+	}
+	// Reports go to stderr so the archive can be piped
+	fmt.Fprintf(os.Stderr, "Exported %d files (%s) for %d manifest entries.\n", res.Files, backup.FormatBytes(res.Bytes), len(entries))
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "Archive written by export, - for stdin (required)")
+	dest := fs.String("dest", "", "Backup folder to import into (required)")
+	format := fs.String("format", "", fmt.Sprintf("One of %v (default: from the -in extension)", archive.Formats))
+	fs.Parse(args)
+
+	if *in == "" || *dest == "" {
+		return fmt.Errorf("-in and -dest are required")
+	}
+	f, err := archiveFormat(*format, *in)
+	if err != nil {
+		return err
+	}
+	repository, err := unlock(*dest)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.OpenSealed(*dest, repository.Sealer())
+	if err != nil {
+		return fmt.Errorf("existing manifest unreadable: %w", err)
+	}
+	if err := os.MkdirAll(*dest, 0755); err != nil {
+		return err
+	}
+
+	var res *archive.Result
+	if *in == "-" {
+		res, err = archive.Import(os.Stdin, f, *dest, m)
+	} else {
+		res, err = archive.ImportFile(*in, f, *dest, m)
+	}
+	if res != nil && res.Files > 0 {
+		// Keep what arrived before a failure
+		if repository != nil {
+			if _, serr := repository.Import(m); serr != nil {
+				fmt.Println("WARN: imported files not stored in the repository:", serr)
+			}
+		}
+		if serr := m.SaveSealed(*dest, repository.Sealer()); serr != nil {
+			return fmt.Errorf("failed to save manifest: %w", serr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d files (%s), %d already in the backup, %d renamed to free names.\n", res.Files, backup.FormatBytes(res.Bytes), res.Skipped, res.Renamed)
+	return nil
+}
+
+// archiveFormat parses -format, or guesses it from the archive's name
+func archiveFormat(format, name string) (archive.Format, error) {
+	if format != "" {
+		return archive.ParseFormat(format)
+	}
+	if name == "-" {
+		return "", fmt.Errorf("-format is required with -")
+	}
+	return archive.FormatOf(name)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/dedup"
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/snapshot"
+	"AndroidSafeLocal/internal/sorter"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	src := fs.String("src", "/sdcard/DCIM", "Source path on the device")
+	dest := fs.String("dest", "", "Destination folder on this PC, or sftp://, webdav://, s3:// URL (required)")
+	exclude := fs.String("exclude", "", "Comma separated extensions or device paths to skip")
+	workers := fs.Int("workers", 5, "Parallel transfers (starting point when -adaptive)")
+	limit := fs.Float64("limit", 0, "Bandwidth limit in MB/s, 0 = unlimited")
+	limitWindow := fs.String("limit-window", "", "Apply -limit only between these hours, e.g. 09:00-18:00")
+	lowPriority := fs.Bool("low-priority", false, "Run device-side commands under nice/ionice")
+	accessMode := fs.String("access", "shell", "List and pull as shell, root (su) or run-as:<package> for app-private folders")
+	adaptive := fs.Bool("adaptive", true, "Tune the number of parallel transfers from measured throughput")
+	minBattery := fs.Int("min-battery", backup.DefaultBatteryCheck().Refuse, "Refuse to start below this battery level in percent unless charging, 0 = never")
+	attempts := fs.Int("attempts", backup.DefaultRetryPolicy().MaxAttempts, "Tries per file for transient errors (device offline, protocol fault)")
+	reconnectWindow := fs.Duration("reconnect-window", backup.DefaultRetryPolicy().ReconnectWindow, "How long to wait for a wireless device that dropped off before failing its files")
+	repoMode := fs.Bool("repo", false, "Turn -dest into a content-addressed repository (kept on once enabled)")
+	encrypt := fs.Bool("encrypt", false, "Create -dest as an encrypted repository (new, empty folders only)")
+	keep := fs.String("keep", "", "Prune snapshots afterwards with these retention rules, e.g. last=10,daily=7,monthly=12")
+	snapshotName := fs.String("snapshot-name", "", "Name of the snapshot taken after the run (default: date and time)")
+	dryRun := fs.Bool("dry-run", false, "Print the plan and exit")
+	yes := fs.Bool("yes", false, "Start without asking for confirmation")
+	verbose := fs.Bool("v", false, "List every file in the plan and every scan warning")
+	warningsFile := fs.String("warnings", "", "Write the scan warnings (skipped folders, broken links, unreadable lines) to this JSON file")
+	fs.Parse(args)
+
+	if *dest == "" {
+		return fmt.Errorf("-dest is required")
+	}
+	policy, err := snapshot.ParsePolicy(*keep)
+	if err != nil {
+		return err
+	}
+	remote := storage.IsRemote(*dest)
+	if remote && (*repoMode || *encrypt || *keep != "" || *snapshotName != "") {
+		return fmt.Errorf("-repo, -encrypt, -keep and -snapshot-name need a local -dest")
+	}
+
+	access, err := adb.ParseAccess(*accessMode)
+	if err != nil {
+		return err
+	}
+	limiter, err := newLimiter(*limit, *limitWindow)
+	if err != nil {
+		return err
+	}
+	var repository *repo.Repo
+	if !remote {
+		if repository, err = unlock(*dest); err != nil {
+			return err
+		}
+	}
+	if *encrypt && repository != nil && !repository.Encrypted() {
+		return fmt.Errorf("%s is already a repository without encryption, use a new folder", *dest)
+	}
+
+	st, err := storage.Open(*dest)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	// Remote backups are pulled into a staging folder first, each file deleted once uploaded
+	stage := *dest
+	if remote {
+		if stage, err = os.MkdirTemp("", "android-safe-local-stage-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(stage)
+	}
+
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+	client.LowPriority.Store(*lowPriority)
+	client.Access = access
+	profile, err := deviceProfile(client)
+	if err != nil {
+		return err
+	}
+	check := backup.DefaultBatteryCheck()
+	check.Refuse = *minBattery
+	warning, err := check.Check(profile)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		fmt.Println("Warning:", warning)
+	}
+
+	volumes, err := device.ListVolumes(client)
+	if err != nil {
+		fmt.Println("Storage volumes unknown:", err)
+	}
+	volume, onVolume := device.VolumeFor(volumes, *src)
+
+	fmt.Printf("Scanning %s...\n", *src)
+	walker := device.NewWalker(client)
+	files, err := walker.Walk(*src)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %d entries.\n", len(files))
+	if err := reportWarnings(walker.Warnings(), *warningsFile, *verbose); err != nil {
+		return err
+	}
+	if len(walker.Inaccessible()) > 0 && access.Mode == adb.AccessAsShell {
+		fmt.Println("Folders that were not readable may be readable with -access root or run-as:<package>.")
+	}
+
+	registry := dedup.NewRegistry()
+	if err := registry.LoadFrom(st); err != nil {
+		fmt.Println("Registry warning:", err)
+	}
+	if repository.Encrypted() {
+		// No tree to scan, the manifest lists what is backed up
+		m, err := manifest.OpenSealed(*dest, repository.Sealer())
+		if err != nil {
+			return err
+		}
+		registry.AddEntries(m.Entries)
+	}
+
+	plan := backup.BuildPlanOn(st, files, sorter.NewSorter(), backup.ParseFilter(*exclude), registry, stage)
+	if *verbose {
+		for _, item := range plan.Items {
+			fmt.Printf("%-9s %10s  %s", item.Action, backup.FormatBytes(item.File.Size), item.File.Path)
+			if item.Reason != "" {
+				fmt.Printf("  (%s)", item.Reason)
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Println(plan.Summary())
+
+	jobs := plan.Jobs()
+	if *dryRun {
+		return nil
+	}
+	if len(jobs) > 0 && !*yes && !confirm("Start backup?") {
+		fmt.Println("Backup cancelled.")
+		return nil
+	}
+
+	retry := backup.DefaultRetryPolicy()
+	retry.MaxAttempts = *attempts
+	retry.Reconnect = reconnector(client)
+	retry.ReconnectWindow = *reconnectWindow
+
+	backupManifest, err := manifest.OpenFrom(st, repository.Sealer())
+	if err != nil {
+		return fmt.Errorf("existing manifest unreadable: %w", err)
+	}
+	if repository == nil && (*repoMode || *encrypt) {
+		if repository, err = createRepository(*dest, *encrypt); err != nil {
+			return err
+		}
+	}
+	if repository != nil {
+		n, err := repository.Import(backupManifest)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			fmt.Printf("Stored %d files from earlier runs in the repository.\n", n)
+		}
+	}
+	if onVolume {
+		backupManifest.RecordVolume(volume)
+	}
+	session := manifest.Session{Started: time.Now().Format("2006-01-02 15:04"), Source: *src, Device: &profile}
+	var agent backup.Processor = &backup.TransferAgent{Client: client}
+	if remote {
+		agent = &backup.StorageAgent{Pull: agent, Storage: st, StageRoot: stage}
+	}
+	for len(jobs) > 0 {
+		failed := transfer(client, agent, jobs, stage, *workers, *adaptive, retry, limiter, registry, backupManifest, repository)
+		session.Files += len(jobs) - len(failed)
+		session.Failures = len(failed)
+		if err := backupManifest.SaveTo(st, repository.Sealer()); err != nil {
+			return fmt.Errorf("failed to save manifest: %w", err)
+		}
+		fmt.Println("Manifest saved.")
+		if len(failed) == 0 || *yes || !confirm(fmt.Sprintf("Retry %d failed files?", len(failed))) {
+			break
+		}
+		jobs = failed
+	}
+	backupManifest.AddSession(session)
+	if err := backupManifest.SaveTo(st, repository.Sealer()); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if remote {
+		fmt.Println("No snapshot taken, snapshots are kept for local backups only.")
+		return nil
+	}
+
+	// Even without transfers the device may have lost or renamed files since the last snapshot;
+	// a run that changed nothing at all reuses it
+	entries, missing := backup.SnapshotEntries(plan, backupManifest)
+	if name, ok := snapshot.Unchanged(*dest, *src, entries, missing, repository.Sealer()); ok && *snapshotName == "" {
+		fmt.Printf("Nothing changed since snapshot %s, no new snapshot taken.\n", name)
+	} else {
+		info, err := snapshot.Create(*dest, snapshot.Info{Name: *snapshotName, Source: *src, Missing: missing, Device: &profile}, entries, repository.Sealer())
+		if err != nil {
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+		fmt.Printf("Snapshot %s: %d files (%s), %d not backed up.\n", info.Name, info.Files, backup.FormatBytes(info.Bytes), info.Missing)
+	}
+	if policy.IsZero() {
+		return nil
+	}
+	return prune(*dest, policy, false, repository)
+}
+
+// reportWarnings prints a summary of what the scan skipped, each warning when
+// verbose, and writes them all to path if set
+func reportWarnings(warnings []device.Warning, path string, verbose bool) error {
+	if len(warnings) > 0 {
+		fmt.Printf("Scan warnings: %s.\n", device.WarningSummary(warnings))
+	}
+	if verbose || len(warnings) <= 5 {
+		for _, w := range warnings {
+			fmt.Println("  " + w.String())
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	return writeFile(path, func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if warnings == nil {
+			warnings = []device.Warning{}
+		}
+		return enc.Encode(warnings)
+	})
+}
+
+// createRepository turns dest into a repository, encrypted with a new passphrase if encrypt is set
+func createRepository(dest string, encrypt bool) (*repo.Repo, error) {
+	if !encrypt {
+		return repo.Init(dest)
+	}
+	p, err := readPassphrase("New passphrase", true)
+	if err != nil {
+		return nil, err
+	}
+	r, err := repo.InitEncrypted(dest, p)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Created an encrypted repository. Keep the passphrase and a copy of %s safe: without them the backup can't be read.\n", repo.KeyFile)
+	return r, nil
+}
+
+// transfer runs jobs through agent, records them in the manifest (and repository, if not nil)
+// and returns the jobs that failed. dest is the plan's destination root.
+func transfer(client *adb.Client, agent backup.Processor, jobs []backup.Job, dest string, workers int, adaptive bool, retry backup.RetryPolicy, limiter *backup.RateLimiter, registry *dedup.Registry, m *manifest.Manifest, repository *repo.Repo) []backup.Job {
+	var totalBytes int64
+	for _, job := range jobs {
+		totalBytes += job.Size
+	}
+	progress := backup.NewProgress(len(jobs), totalBytes)
+	pool := backup.NewPool(workers, agent, registry)
+	pool.SetProgress(progress)
+	pool.SetRetryPolicy(retry)
+	pool.SetLimiter(limiter)
+	if adaptive {
+		cfg := backup.DefaultAdaptiveConfig()
+		cfg.OnAdjust = func(lane string, from, to int, reason string) {
+			fmt.Printf("Workers (%s files): %d -> %d (%s)\n", lane, from, to, reason)
+		}
+		pool.SetAdaptive(cfg)
+	}
+	pool.Start()
+	stopProgress := reportProgress(progress)
+	go func() {
+		for _, job := range jobs {
+			pool.AddJob(job)
+		}
+		pool.Close()
+	}()
+
+	var failed []backup.Job
+	success := 0
+	for res := range pool.Results() {
+		if res.Error != nil {
+			fmt.Printf("FAIL: %s after %d attempt(s) [%s] (%v)\n", res.Job.SourcePath, res.Attempts, adb.Classify(res.Error), res.Error)
+			failed = append(failed, res.Job)
+			continue
+		}
+		if !res.Skipped {
+			if err := repository.Record(m, dest, res.Job); err != nil {
+				fmt.Printf("WARN: %s not stored in the repository (%v)\n", res.Job.SourcePath, err)
+			}
+		}
+		success++
+	}
+	stopProgress()
+	fmt.Printf("Finished. Processed: %d. Failures: %d\n", success, len(failed))
+	return failed
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/content"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func runContent(args []string) error {
+	fs := flag.NewFlagSet("content", flag.ExitOnError)
+	dest := fs.String("dest", "", "Backup folder or sftp://, webdav://, s3:// URL to write to (required)")
+	only := fs.String("only", strings.Join(content.Kinds, ","), "Comma separated kinds to export")
+	format := fs.String("format", "json", "Format of messages and calls: json or xml")
+	fs.Parse(args)
+
+	if *dest == "" {
+		return fmt.Errorf("-dest is required")
+	}
+	f, err := content.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	if !storage.IsRemote(*dest) {
+		if r, err := repo.Open(*dest); err == nil && r.Encrypted() {
+			return fmt.Errorf("%s is an encrypted repository, contacts and messages would be stored unencrypted next to it", *dest)
+		}
+	}
+	st, err := storage.Open(*dest)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	_, err = content.Export(client, st, strings.Split(*only, ","), f, func(res content.Result) {
+		if res.Err != nil {
+			failures++
+			fmt.Printf("FAIL: %s (%v)\n", res.Kind, res.Err)
+			return
+		}
+		fmt.Printf("%-9s %6d records  %10s  %s\n", res.Kind, res.Data.Records, backup.FormatBytes(res.Data.Size), res.Data.LocalPath)
+	})
+	if err != nil {
+		return err
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d exports failed", failures)
+	}
+	return nil
+}
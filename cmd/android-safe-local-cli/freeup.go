@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func runFreeUp(args []string) error {
+	defaults := backup.DefaultFreeUpPolicy()
+	fs := flag.NewFlagSet("freeup", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder or sftp://, webdav://, s3:// URL holding manifest.json (required)")
+	prefix := fs.String("prefix", "", "Only files under this device folder, e.g. /sdcard/DCIM")
+	minAge := fs.Int("min-age", int(defaults.MinAge/(24*time.Hour)), "Keep files modified in the last N days on the device, 0 to allow any age")
+	protect := fs.String("protect", "", "Comma separated device folders never to delete from, besides "+fmt.Sprint(backup.AlwaysProtected))
+	dryRun := fs.Bool("dry-run", false, "List what would be deleted and exit")
+	verbose := fs.Bool("v", false, "Also list the files that stay and why")
+	yes := fs.Bool("yes", false, "Delete without asking for confirmation")
+	fs.Parse(args)
+
+	if *src == "" {
+		return fmt.Errorf("-src is required")
+	}
+	if *minAge < 0 {
+		return fmt.Errorf("-min-age must not be negative")
+	}
+	policy := backup.FreeUpPolicy{
+		MinAge:    time.Duration(*minAge) * 24 * time.Hour,
+		Protected: backup.ParseProtected(*protect),
+	}
+
+	var repository *repo.Repo
+	if !storage.IsRemote(*src) {
+		// Encrypted manifests are read and written with the repository key
+		r, err := unlock(*src)
+		if err != nil {
+			return err
+		}
+		repository = r
+	}
+	st, err := storage.Open(*src)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	m, err := manifest.LoadFrom(st, repository.Sealer())
+	if err != nil {
+		return fmt.Errorf("cannot read manifest in %s: %w", st, err)
+	}
+	entries := backup.FreeUpCandidates(m, *prefix)
+	if len(entries) == 0 {
+		fmt.Println("No backed up files left on the device to free up.")
+		return nil
+	}
+
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checking %d backed up files against the device...\n", len(entries))
+	now := time.Now()
+	// Objects of a repository are compared by its content IDs, other
+	// destinations by the SHA-256 of the stored file
+	copies := backup.CopyChecker(backup.StorageCopies{Storage: st, Device: client})
+	if repository != nil {
+		copies = repository.Copies(client)
+	}
+	items, err := backup.PlanFreeUp(client, copies, entries, policy, now)
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, it := range items {
+		switch {
+		case it.Delete:
+			n++
+			if *dryRun || *verbose {
+				fmt.Printf("delete  %s (%s)\n", it.Entry.OriginalPath, backup.FormatBytes(it.Entry.Size))
+			}
+		case *verbose:
+			fmt.Printf("keep    %s: %s\n", it.Entry.OriginalPath, it.Reason)
+		}
+	}
+	fmt.Println(backup.FreeUpSummary(items))
+	if *dryRun || n == 0 {
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete %d files from the device? They stay in the backup and can be restored with restore -deleted", n)) {
+		fmt.Println("Free up cancelled.")
+		return nil
+	}
+	// A backup may have saved the manifest while the list was confirmed
+	if m, err = manifest.LoadFrom(st, repository.Sealer()); err != nil {
+		return fmt.Errorf("cannot read manifest in %s: %w", st, err)
+	}
+	deleted, freed, err := backup.FreeUp(client, m, st, repository.Sealer(), items, now, func(it backup.FreeUpItem, err error) {
+		if err != nil {
+			fmt.Printf("FAIL: %s (%v)\n", it.Entry.OriginalPath, err)
+		} else if *verbose {
+			fmt.Printf("Deleted %s\n", it.Entry.OriginalPath)
+		}
+	})
+	fmt.Printf("Deleted %d files, freed %s on the device. The deletion log is in the manifest.\n", deleted, backup.FormatBytes(freed))
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"AndroidSafeLocal/internal/repo"
+)
+
+func runKey(args []string) error {
+	fs := flag.NewFlagSet("key", flag.ExitOnError)
+	src := fs.String("src", "", "Encrypted repository (required)")
+	change := fs.Bool("change-passphrase", false, "Protect the keys with a new passphrase")
+	rotate := fs.Bool("rotate", false, "Re-encrypt everything under a new key and retire the old one")
+	fs.Parse(args)
+
+	if *src == "" || *change == *rotate {
+		return fmt.Errorf("-src and one of -change-passphrase or -rotate are required")
+	}
+	r, err := repo.Open(*src)
+	if err != nil {
+		return err
+	}
+	if !r.Encrypted() {
+		return fmt.Errorf("%s is not an encrypted repository", *src)
+	}
+	current, err := readPassphrase("Current passphrase", false)
+	if err != nil {
+		return err
+	}
+
+	if *change {
+		next, err := readPassphrase("New passphrase", true)
+		if err != nil {
+			return err
+		}
+		if err := r.ChangePassphrase(current, next); err != nil {
+			return err
+		}
+		fmt.Printf("Passphrase changed. Replace your copy of %s.\n", repo.KeyFile)
+		return nil
+	}
+
+	if err := r.Unlock(current); err != nil {
+		return err
+	}
+	fmt.Println("Re-encrypting the repository under a new key...")
+	n, err := r.RotateKey(current)
+	if err != nil {
+		return fmt.Errorf("rotation interrupted, run it again to finish: %w", err)
+	}
+	fmt.Printf("Re-encrypted %d objects and every manifest. Replace your copy of %s.\n", n, repo.KeyFile)
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/repo"
+)
+
+// passphraseEnv lets scripts pass the passphrase of an encrypted backup without a prompt
+const passphraseEnv = "ANDROID_SAFE_LOCAL_PASSPHRASE"
+
+// progressInterval is how often long transfers print a status line
+const progressInterval = 2 * time.Second
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"devices", "List connected devices", runDevices},
+	{"backup", "Scan a device folder and back it up", runBackup},
+	{"restore", "Push files from a backup back to their original locations", runRestore},
+	{"snapshots", "List the snapshots of a backup", runSnapshots},
+	{"prune", "Delete snapshots a retention policy no longer keeps", runPrune},
+	{"materialize", "Rebuild a Year/Month tree from a repository", runMaterialize},
+	{"export", "Write a backup or part of it to a tar or zip archive", runExport},
+	{"import", "Add the files of an exported archive to a backup", runImport},
+	{"key", "Change the passphrase or rotate the key of an encrypted repository", runKey},
+	{"apps", "Back up the APKs of installed apps, or reinstall them", runApps},
+	{"ab", "List, convert or restore Android backup (.ab) archives of app data", runAB},
+	{"content", "Export contacts, messages and the call log to the backup root", runContent},
+	{"wireless", "Pair, connect and discover devices over Wi-Fi", runWireless},
+	{"freeup", "Delete backed up and verified files from the device", runFreeUp},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: android-safe-local-cli <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'android-safe-local-cli <command> -h' for command flags.")
+}
+
+// connect creates the ADB client and makes sure a device is attached
+func connect() (*adb.Client, error) {
+	client, err := adb.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no device connected, check the USB cable and USB debugging or run the wireless command")
+	}
+	fmt.Printf("Device: %s %s\n", devices[0].Model, devices[0].Serial)
+	return client, nil
+}
+
+// stdin is shared by every prompt so buffered input isn't lost between questions
+var stdin = bufio.NewReader(os.Stdin)
+
+// deviceProfile reads the device information and prints it in one line
+func deviceProfile(client *adb.Client) (adb.DeviceInfo, error) {
+	info, err := client.DeviceInfo()
+	if err != nil {
+		return info, err
+	}
+	line := fmt.Sprintf("%s, Android %s (SDK %d), build %s", info.Name(), info.AndroidVersion, info.SDK, info.Build)
+	if info.BatteryLevel >= 0 {
+		line += fmt.Sprintf(", battery %d%%", info.BatteryLevel)
+		if info.Charging {
+			line += " (charging)"
+		}
+	}
+	for _, d := range info.Disks {
+		line += fmt.Sprintf(", %s %s free of %s", d.Name, backup.FormatBytes(d.Free), backup.FormatBytes(d.Total))
+	}
+	fmt.Println(line)
+	return info, nil
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// readPassphrase reads a passphrase from the environment or, without echo, from the terminal.
+// A new passphrase is asked twice and can't come from the environment by accident.
+func readPassphrase(prompt string, isNew bool) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" && !isNew {
+		return p, nil
+	}
+	ask := func(prompt string) (string, error) {
+		fmt.Printf("%s: ", prompt)
+		if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+			p, err := term.ReadPassword(fd)
+			fmt.Println()
+			return string(p), err
+		}
+		line, err := stdin.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			err = nil
+		}
+		return line, err
+	}
+	p, err := ask(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if isNew {
+		again, err := ask("Repeat " + strings.ToLower(prompt[:1]) + prompt[1:])
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errors.New("the passphrases don't match")
+		}
+	}
+	return p, nil
+}
+
+// unlock opens the repository at root and, if it is encrypted, unlocks it with
+// a passphrase. nil without an error means a plain backup folder.
+func unlock(root string) (*repo.Repo, error) {
+	r, err := repo.Open(root)
+	if errors.Is(err, repo.ErrNotRepository) {
+		return nil, nil
+	}
+	if err != nil || !r.Locked() {
+		return r, err
+	}
+	p, err := readPassphrase("Passphrase for "+root, false)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.Unlock(p)
+}
+
+// reportProgress prints a status line every progressInterval until the returned stop func is called
+func reportProgress(p *backup.Progress) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fmt.Println(p.Snapshot())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		fmt.Println(p.Snapshot())
+	}
+}
+
+// newLimiter builds the bandwidth limiter from the -limit (MB/s) and -limit-window flags
+func newLimiter(mbps float64, window string) (*backup.RateLimiter, error) {
+	limiter := backup.NewRateLimiter(int64(mbps * 1024 * 1024))
+	if window != "" {
+		w, err := backup.ParseTimeWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		limiter.SetWindow(w)
+	}
+	if mbps > 0 {
+		fmt.Println("Bandwidth:", limiter)
+	}
+	return limiter, nil
+}
+
+func runDevices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	modes := fs.Bool("access", false, "List the access modes of the first device (shell, root, run-as apps)")
+	volumes := fs.Bool("volumes", false, "List the storage volumes of the first device (internal, SD cards, USB drives)")
+	fs.Parse(args)
+
+	client, err := adb.NewClient()
+	if err != nil {
+		return err
+	}
+	devices, err := client.Devices()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("No devices connected.")
+	}
+	for _, d := range devices {
+		fmt.Printf("%s\t%s\t%s\n", d.Serial, d.State, d.Model)
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	if *volumes {
+		list, err := device.ListVolumes(client)
+		if err != nil {
+			return err
+		}
+		for _, v := range list {
+			fmt.Printf("%-22s %-24s %10s free of %s\n", v.Name(), v.Path, backup.FormatBytes(v.Free), backup.FormatBytes(v.Total))
+		}
+	}
+	if !*modes {
+		return nil
+	}
+	available, err := client.AccessModes()
+	for _, a := range available {
+		fmt.Println("Access:", a)
+	}
+	return err
+}
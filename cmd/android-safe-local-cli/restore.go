@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/snapshot"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder or sftp://, webdav://, s3:// URL holding manifest.json (required)")
+	snapshotName := fs.String("snapshot", "", "Restore the device state of this snapshot instead of the latest files")
+	query := queryFlags(fs)
+	workers := fs.Int("workers", 15, "Parallel transfers (starting point, tuned at runtime)")
+	limit := fs.Float64("limit", 0, "Bandwidth limit in MB/s, 0 = unlimited")
+	limitWindow := fs.String("limit-window", "", "Apply -limit only between these hours, e.g. 09:00-18:00")
+	onConflict := fs.String("on-conflict", backup.ConflictSkipIdentical.String(), "When the file exists on the device: skip-identical, keep-newer, rename or overwrite")
+	hash := fs.Bool("hash", false, "Compare existing device files by SHA-256 instead of size and time")
+	mapping := fs.String("map", "", "Comma separated path mappings for another device, e.g. /storage/ABCD-1234=/storage/9999-0000")
+	autoMap := fs.Bool("auto-map", true, "Map SD card UUIDs and user ids that differ on the connected device")
+	verify := fs.Bool("verify", false, "Check restored files on the device afterwards (by SHA-256 with -hash)")
+	dryRun := fs.Bool("dry-run", false, "Report what would change on the device and exit")
+	yes := fs.Bool("yes", false, "Start without asking for confirmation")
+	fs.Parse(args)
+
+	if *src == "" {
+		return fmt.Errorf("-src is required")
+	}
+	policy, err := backup.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+	rules, err := backup.ParseRemapRules(*mapping)
+	if err != nil {
+		return err
+	}
+	var (
+		repository *repo.Repo
+		remote     storage.Storage
+		m          *manifest.Manifest
+	)
+	root := *src
+	if storage.IsRemote(*src) {
+		if *snapshotName != "" {
+			return fmt.Errorf("-snapshot needs a local -src, remote backups keep no snapshots")
+		}
+		if remote, err = storage.Open(*src); err != nil {
+			return err
+		}
+		defer remote.Close()
+		if m, err = manifest.LoadFrom(remote, nil); err != nil {
+			return fmt.Errorf("cannot read manifest in %s: %w", remote, err)
+		}
+	} else {
+		if repository, err = unlock(*src); err != nil {
+			return err
+		}
+		if *snapshotName != "" {
+			// A snapshot folder is laid out like the backup itself
+			root = snapshot.Path(*src, *snapshotName)
+		}
+		if m, err = manifest.LoadSealed(root, repository.Sealer()); err != nil {
+			return fmt.Errorf("cannot read manifest in %s: %w", root, err)
+		}
+	}
+
+	q, err := query()
+	if err != nil {
+		return err
+	}
+	entries := m.Select(q)
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	fmt.Printf("Selected %d of %d files (%s).\n", len(entries), len(m.Entries), backup.FormatBytes(size))
+	if len(entries) == 0 {
+		return nil
+	}
+	if repository.Encrypted() || remote != nil {
+		// Push from a decrypted or downloaded copy of the selection, deleted afterwards
+		view, err := os.MkdirTemp("", "android-safe-local-view-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(view)
+		if remote != nil {
+			fmt.Printf("Downloading from %s...\n", remote)
+			err = backup.Fetch(remote, entries, view)
+		} else {
+			_, _, err = repository.Materialize(entries, view)
+		}
+		if err != nil {
+			return err
+		}
+		root = view
+	}
+
+	limiter, err := newLimiter(*limit, *limitWindow)
+	if err != nil {
+		return err
+	}
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+	jobs := backup.RestoreJobs(root, entries)
+	var auto []backup.RemapRule
+	if *autoMap {
+		layout, err := backup.DetectLayout(client)
+		if err != nil {
+			return fmt.Errorf("cannot read device storage layout: %w", err)
+		}
+		paths := make([]string, len(jobs))
+		for i, job := range jobs {
+			paths[i] = job.OriginalPath
+		}
+		auto = backup.AutoRemapRules(paths, m.Volumes, layout)
+	}
+	remapper := backup.NewRemapper(rules, auto)
+	changes := remapper.Apply(jobs)
+	for _, r := range remapper.Rules {
+		fmt.Println("Path mapping: " + r.String())
+	}
+	if len(remapper.Rules) > 0 {
+		fmt.Printf("%d files remapped.\n", len(changes))
+	}
+	checker := backup.NewConflictChecker(client, policy, *hash)
+
+	if *dryRun {
+		decisions, err := checker.Plan(jobs)
+		if err != nil {
+			return err
+		}
+		for _, d := range decisions {
+			fmt.Printf("%-11s %s", d.Action, d.Target)
+			if d.Reason != "" {
+				fmt.Printf("  (%s)", d.Reason)
+			}
+			fmt.Println()
+		}
+		fmt.Println(backup.SummarizeDecisions(decisions))
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Restore these files to their original locations (%s)?", policy)) {
+		fmt.Println("Restore cancelled.")
+		return nil
+	}
+
+	var verifier *backup.RestoreVerifier
+	if *verify {
+		verifier = backup.NewRestoreVerifier(client, *hash)
+	}
+	for {
+		failed, pushed := push(client, jobs, *workers, limiter, checker)
+		// Re-pushes overwrite the bad copy, so they run without the conflict checker.
+		// With -yes there is a single automatic re-push.
+		mismatched := 0
+		for round := 0; verifier != nil && len(pushed) > 0; round++ {
+			report, err := verifier.Verify(pushed)
+			if err != nil {
+				fmt.Printf("WARN: verification failed (%v)\n", err)
+				break
+			}
+			for _, p := range report.Problems {
+				fmt.Printf("%-9s %s %s\n", strings.ToUpper(p.Status.String()), p.Decision.Target, p.Detail)
+			}
+			fmt.Println("Verification: " + report.Summary())
+			mismatched = len(report.Problems)
+			if mismatched == 0 || (*yes && round > 0) ||
+				(!*yes && !confirm(fmt.Sprintf("Push the %d files that don't match again?", mismatched))) {
+				break
+			}
+			// Files that fail to push again are retried with the others
+			var again []backup.RestoreJob
+			again, pushed = push(client, report.Jobs(), *workers, limiter, nil)
+			failed = append(failed, again...)
+			mismatched = 0
+		}
+		if len(failed) == 0 {
+			if mismatched > 0 {
+				return fmt.Errorf("%d restored files don't match the backup", mismatched)
+			}
+			return nil
+		}
+		if *yes || !confirm(fmt.Sprintf("Retry %d failed files?", len(failed))) {
+			return fmt.Errorf("%d files failed to restore", len(failed))
+		}
+		jobs = failed
+	}
+}
+
+// queryFlags adds the manifest selection flags to fs and returns a func
+// building the query once fs is parsed
+func queryFlags(fs *flag.FlagSet) func() (manifest.Query, error) {
+	prefix := fs.String("prefix", "", "Only files under this original device folder")
+	from := fs.String("from", "", "Only files captured on or after this date (YYYY-MM or YYYY-MM-DD)")
+	to := fs.String("to", "", "Only files captured on or before this date (YYYY-MM or YYYY-MM-DD)")
+	mediaType := fs.String("type", "", "Only this media type: image, video, audio or document")
+	ext := fs.String("ext", "", "Only these comma separated extensions, e.g. jpg,mp4")
+	glob := fs.String("glob", "", "Only names matching this pattern (full path if it contains a slash)")
+	deleted := fs.Bool("deleted", false, "Only files freeup deleted from the device")
+	return func() (manifest.Query, error) {
+		query := manifest.Query{PathPrefix: *prefix, Glob: *glob, MediaType: manifest.MediaType(*mediaType), Deleted: *deleted}
+		if query.MediaType != manifest.MediaAny && !slices.Contains(manifest.MediaTypes, query.MediaType) {
+			return query, fmt.Errorf("unknown -type %q, use one of %v", *mediaType, manifest.MediaTypes)
+		}
+		var err error
+		if query.From, query.To, err = manifest.ParseDateRange(*from, *to); err != nil {
+			return query, err
+		}
+		for _, e := range strings.Split(*ext, ",") {
+			if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+				query.Extensions = append(query.Extensions, "."+strings.TrimPrefix(e, "."))
+			}
+		}
+		return query, nil
+	}
+}
+
+// push restores jobs to the device and returns the ones that failed and what was written
+func push(client *adb.Client, jobs []backup.RestoreJob, workers int, limiter *backup.RateLimiter, checker *backup.ConflictChecker) (failed []backup.RestoreJob, pushed []backup.RestoreDecision) {
+	var totalBytes int64
+	for _, job := range jobs {
+		totalBytes += job.Size
+	}
+	progress := backup.NewProgress(len(jobs), totalBytes)
+	pool := backup.NewRestorePool(workers, client)
+	pool.SetProgress(progress)
+	retry := backup.DefaultRetryPolicy()
+	retry.Reconnect = reconnector(client)
+	pool.SetRetryPolicy(retry)
+	pool.SetAdaptive(backup.DefaultAdaptiveConfig())
+	pool.SetLimiter(limiter)
+	pool.SetConflictChecker(checker)
+	pool.Start()
+	stopProgress := reportProgress(progress)
+	go func() {
+		for _, job := range jobs {
+			pool.AddJob(job)
+		}
+		pool.Close()
+	}()
+
+	skipped := 0
+	for res := range pool.Results() {
+		switch {
+		case res.Error != nil:
+			fmt.Printf("FAIL: %s after %d attempt(s) [%s] (%v)\n", res.Job.OriginalPath, res.Attempts, adb.Classify(res.Error), res.Error)
+			failed = append(failed, res.Job)
+		case res.Skipped:
+			skipped++
+		default:
+			if res.Decision.Action == backup.RestoreRename {
+				fmt.Printf("RENAMED: %s -> %s\n", res.Job.OriginalPath, res.Decision.Target)
+			}
+			if res.TimeErr != nil {
+				fmt.Printf("WARN: %s restored without its original date (%v)\n", res.Decision.Target, res.TimeErr)
+			}
+			pushed = append(pushed, res.Decision)
+		}
+	}
+	stopProgress()
+	fmt.Printf("Restore complete. Success: %d, Kept on device: %d, Failures: %d\n", len(jobs)-len(failed)-skipped, skipped, len(failed))
+	if len(pushed) > 0 {
+		restored := make([]string, len(pushed))
+		for i, d := range pushed {
+			restored[i] = d.Target
+		}
+		if err := client.ScanMedia(restored); err != nil {
+			fmt.Printf("WARN: media scan failed, files will appear after the next device rescan (%v)\n", err)
+		}
+	}
+	return failed, pushed
+}
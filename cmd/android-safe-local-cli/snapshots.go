@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/snapshot"
+)
+
+func runSnapshots(args []string) error {
+	fs := flag.NewFlagSet("snapshots", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder (required)")
+	fs.Parse(args)
+
+	if *src == "" {
+		return fmt.Errorf("-src is required")
+	}
+	infos, err := snapshot.List(*src)
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		fmt.Println("No snapshots yet, one is taken after every backup run.")
+		return nil
+	}
+	for _, s := range infos {
+		fmt.Printf("%-20s %7d files %10s  %s", s.Name, s.Files, backup.FormatBytes(s.Bytes), s.Source)
+		if s.Missing > 0 {
+			fmt.Printf("  (%d not backed up)", s.Missing)
+		}
+		if s.Device != nil {
+			fmt.Printf("  [%s]", s.Device.Name())
+		}
+		fmt.Println()
+	}
+	fmt.Println("Restore one with: android-safe-local-cli restore -src", *src, "-snapshot <name>")
+	return nil
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder (required)")
+	keep := fs.String("keep", "", "Retention rules: last=N,daily=N,weekly=N,monthly=N,yearly=N,within=30d (required)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be deleted and exit")
+	yes := fs.Bool("yes", false, "Delete without asking for confirmation")
+	fs.Parse(args)
+
+	if *src == "" || *keep == "" {
+		return fmt.Errorf("-src and -keep are required")
+	}
+	policy, err := snapshot.ParsePolicy(*keep)
+	if err != nil {
+		return err
+	}
+	repository, err := unlock(*src)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		return prune(*src, policy, true, repository)
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete the snapshots not kept by %s?", policy)) {
+		fmt.Println("Prune cancelled.")
+		return nil
+	}
+	return prune(*src, policy, false, repository)
+}
+
+// prune prints what the policy keeps and removes, then deletes unless dryRun.
+// repository is nil for a plain backup folder.
+func prune(src string, policy snapshot.Policy, dryRun bool, repository *repo.Repo) error {
+	pp, err := snapshot.PlanPrune(src, policy, time.Now(), repository.Sealer())
+	if err != nil {
+		return err
+	}
+	for _, d := range pp.Decisions {
+		if d.Keep {
+			fmt.Printf("keep    %s  (%s)\n", d.Info.Name, strings.Join(d.Reasons, ", "))
+		} else {
+			fmt.Printf("remove  %s\n", d.Info.Name)
+		}
+	}
+	removed := pp.Removed()
+	fmt.Printf("%d of %d snapshots removed, %d backup files (%s) no longer referenced.\n",
+		len(removed), len(pp.Decisions), len(pp.Files), backup.FormatBytes(pp.Bytes))
+	if dryRun || len(removed) == 0 {
+		return nil
+	}
+	if err := pp.Execute(src); err != nil {
+		return err
+	}
+	fmt.Println("Pruned.")
+	if repository != nil {
+		n, freed, err := repository.GC()
+		if err != nil {
+			return fmt.Errorf("repository cleanup failed: %w", err)
+		}
+		fmt.Printf("Removed %d unreferenced objects (%s).\n", n, backup.FormatBytes(freed))
+	}
+	return nil
+}
+
+func runMaterialize(args []string) error {
+	fs := flag.NewFlagSet("materialize", flag.ExitOnError)
+	src := fs.String("src", "", "Backup folder in repository mode (required)")
+	snapshotName := fs.String("snapshot", "", "Build the tree of this snapshot instead of the latest files")
+	dest := fs.String("dest", "", "Folder to build the Year/Month tree in (default: the backup folder itself)")
+	fs.Parse(args)
+
+	if *src == "" {
+		return fmt.Errorf("-src is required")
+	}
+	r, err := unlock(*src)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("%s: %w", *src, repo.ErrNotRepository)
+	}
+	if r.Encrypted() && *dest == "" {
+		return fmt.Errorf("-dest is required for an encrypted repository, the files are decrypted into it")
+	}
+	m, err := manifest.LoadSealed(*src, r.Sealer())
+	if *snapshotName != "" {
+		_, m, err = snapshot.Load(*src, *snapshotName, r.Sealer())
+	}
+	if err != nil {
+		return err
+	}
+	target := *dest
+	if target == "" {
+		target = *src
+	}
+	linked, missing, err := r.Materialize(m.Entries, target)
+	if err != nil {
+		return err
+	}
+	verb := "Linked"
+	if r.Encrypted() {
+		verb = "Decrypted"
+	}
+	fmt.Printf("%s %d files into %s, %d were already there.\n", verb, linked, target, len(m.Entries)-linked-missing)
+	if missing > 0 {
+		fmt.Printf("%d entries have no object (backed up before repository mode and since deleted).\n", missing)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+func runWireless(args []string) error {
+	fs := flag.NewFlagSet("wireless", flag.ExitOnError)
+	pair := fs.String("pair", "", "Pair with the host:port shown under \"Pair device with pairing code\"")
+	code := fs.String("code", "", "Six digit pairing code for -pair")
+	connectAddr := fs.String("connect", "", "Connect to a paired device at host:port, or to a known device by mDNS name")
+	disconnect := fs.String("disconnect", "", "Disconnect from host:port, or \"all\"")
+	discover := fs.Bool("discover", false, "Look for devices with wireless debugging on the local network")
+	timeout := fs.Duration("timeout", 3*time.Second, "How long -discover listens")
+	list := fs.Bool("list", false, "List the known wireless devices")
+	forget := fs.String("forget", "", "Remove a device from the known list by host:port")
+	fs.Parse(args)
+
+	path, err := adb.KnownDevicesPath()
+	if err != nil {
+		return err
+	}
+	known, err := adb.LoadKnownDevices(path)
+	if err != nil {
+		return err
+	}
+	if *list {
+		if len(known.Devices) == 0 {
+			fmt.Println("No known wireless devices.")
+		}
+		for _, d := range known.Devices {
+			fmt.Printf("%-40s %-30s last seen %s\n", d, d.Name, d.LastSeen.Format("2006-01-02 15:04"))
+		}
+		return nil
+	}
+	if *forget != "" {
+		if _, ok := known.Find(*forget, ""); !ok {
+			return fmt.Errorf("%s is not a known device", *forget)
+		}
+		known.Forget(*forget)
+		return known.Save()
+	}
+
+	client, err := adb.NewClient()
+	if err != nil {
+		return err
+	}
+	switch {
+	case *pair != "":
+		if *code == "" {
+			return fmt.Errorf("-pair needs -code")
+		}
+		if err := client.Pair(*pair, *code); err != nil {
+			return err
+		}
+		fmt.Println("Paired. Connect with the address on the Wireless debugging screen (not the pairing port).")
+		return nil
+	case *connectAddr != "":
+		return connectWireless(client, known, *connectAddr)
+	case *disconnect != "":
+		addr := *disconnect
+		if addr == "all" {
+			addr = ""
+		}
+		return client.Disconnect(addr)
+	case *discover:
+		services, err := client.DiscoverWireless(*timeout)
+		if err != nil {
+			return err
+		}
+		if len(services) == 0 {
+			fmt.Println("No devices found. Is Wireless debugging on and the PC on the same network?")
+		}
+		for _, s := range services {
+			fmt.Printf("%-40s %s\n", s.Instance, s.Addr)
+		}
+		return nil
+	}
+	fs.Usage()
+	return nil
+}
+
+// connectWireless connects to addr, which may also be the mDNS name of a known
+// device, and remembers the device with its model
+func connectWireless(client *adb.Client, known *adb.KnownDevices, addr string) error {
+	d, ok := known.Find(addr, addr)
+	if !ok {
+		d = adb.WirelessDevice{Address: addr}
+	}
+	if err := client.ConnectDevice(&d); err != nil {
+		return err
+	}
+	if info, err := client.DeviceInfo(); err == nil {
+		d.Model = info.Name()
+	}
+	d.LastSeen = time.Time{}
+	known.Remember(d)
+	fmt.Println("Connected to", d)
+	return known.Save()
+}
+
+// reconnector returns a RetryPolicy.Reconnect for the connected device when it
+// is attached over Wi-Fi, nil otherwise
+func reconnector(client *adb.Client) func() error {
+	devices, err := client.Devices()
+	if err != nil || len(devices) == 0 || !adb.IsWireless(devices[0].Serial) {
+		return nil
+	}
+	var known *adb.KnownDevices
+	if path, err := adb.KnownDevicesPath(); err == nil {
+		known, _ = adb.LoadKnownDevices(path)
+	}
+	if known == nil {
+		known = &adb.KnownDevices{}
+	}
+	return client.Reconnector(known.ForSerial(devices[0].Serial))
+}
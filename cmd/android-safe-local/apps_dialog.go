@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showAppsDialog lets the user tick which apps to back up or reinstall, all
+// ticked at first. onChosen gets the indexes of the ticked labels.
+func showAppsDialog(w fyne.Window, title, action string, labels []string, onChosen func(chosen []int)) {
+	checks := widget.NewCheckGroup(labels, nil)
+	checks.SetSelected(labels)
+	countLabel := widget.NewLabel("")
+	checks.OnChanged = func(selected []string) {
+		countLabel.SetText(fmt.Sprintf("%d of %d apps selected", len(selected), len(labels)))
+	}
+	checks.OnChanged(checks.Selected)
+
+	buttons := container.NewHBox(
+		widget.NewButton("All", func() { checks.SetSelected(labels) }),
+		widget.NewButton("None", func() { checks.SetSelected(nil) }),
+		countLabel,
+	)
+	content := container.NewBorder(buttons, nil, nil, nil, container.NewVScroll(checks))
+	d := dialog.NewCustomConfirm(title, action, "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		var chosen []int
+		for i, label := range labels {
+			if slices.Contains(checks.Selected, label) {
+				chosen = append(chosen, i)
+			}
+		}
+		onChosen(chosen)
+	}, w)
+	d.Resize(fyne.NewSize(600, 500))
+	d.Show()
+}
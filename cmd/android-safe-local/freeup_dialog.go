@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"AndroidSafeLocal/internal/backup"
+)
+
+// showFreeUpDialog asks which device folder to free up and with which age
+// threshold and protected folders; onCheck plans it without deleting anything
+func showFreeUpDialog(w fyne.Window, folder string, onCheck func(prefix string, policy backup.FreeUpPolicy)) {
+	defaults := backup.DefaultFreeUpPolicy()
+	folderEntry := widget.NewEntry()
+	folderEntry.SetText(folder)
+	folderEntry.SetPlaceHolder("Device folder, empty for the whole backup")
+	ageEntry := widget.NewEntry()
+	ageEntry.SetText(strconv.Itoa(int(defaults.MinAge / (24 * time.Hour))))
+	protectedEntry := widget.NewMultiLineEntry()
+	protectedEntry.SetPlaceHolder("One device folder per line")
+	protectedEntry.SetMinRowsVisible(3)
+	hint := widget.NewLabel("Only files that are in the saved manifest and have the same SHA-256 on the device and in the backup are deleted. Nothing is deleted before you confirm the list. " + strings.Join(backup.AlwaysProtected, ", ") + " is always protected.")
+	hint.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm(
+		widget.NewFormItem("Folder", folderEntry),
+		widget.NewFormItem("Older than (days)", ageEntry),
+		widget.NewFormItem("Never delete from", protectedEntry),
+	)
+	d := dialog.NewCustomConfirm("Free Up Space", "Check Files", "Cancel", container.NewVBox(form, hint), func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(ageEntry.Text))
+		if err != nil || days < 0 {
+			dialog.ShowError(fmt.Errorf("age must be a number of days, 0 for any age"), w)
+			return
+		}
+		onCheck(strings.TrimSpace(folderEntry.Text), backup.FreeUpPolicy{
+			MinAge:    time.Duration(days) * 24 * time.Hour,
+			Protected: backup.ParseProtected(protectedEntry.Text),
+		})
+	}, w)
+	d.Resize(fyne.NewSize(600, 360))
+	d.Show()
+}
+
+// showFreeUpPlan lists what a free up would delete, with the files that stay
+// and why under details; onDelete runs only when the list is confirmed
+func showFreeUpPlan(w fyne.Window, items []backup.FreeUpItem, onDelete func()) {
+	var remove, keep []backup.FreeUpItem
+	for _, it := range items {
+		if it.Delete {
+			remove = append(remove, it)
+		} else {
+			keep = append(keep, it)
+		}
+	}
+	list := func(items []backup.FreeUpItem, text func(backup.FreeUpItem) string) fyne.CanvasObject {
+		l := widget.NewList(
+			func() int { return len(items) },
+			func() fyne.CanvasObject { return widget.NewLabel("") },
+			func(id widget.ListItemID, o fyne.CanvasObject) {
+				o.(*widget.Label).SetText(text(items[id]))
+			},
+		)
+		return container.NewGridWrap(fyne.NewSize(640, 220), l)
+	}
+	summary := widget.NewLabelWithStyle(backup.FreeUpSummary(items), fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	summary.Wrapping = fyne.TextWrapWord
+	toDelete := widget.NewAccordionItem(fmt.Sprintf("To delete (%d)", len(remove)), list(remove, func(it backup.FreeUpItem) string {
+		return fmt.Sprintf("%s (%s)", it.Entry.OriginalPath, backup.FormatBytes(it.Entry.Size))
+	}))
+	toDelete.Open = true
+	kept := widget.NewAccordionItem(fmt.Sprintf("Kept on the device (%d)", len(keep)), list(keep, func(it backup.FreeUpItem) string {
+		return fmt.Sprintf("%s: %s", it.Entry.OriginalPath, it.Reason)
+	}))
+	content := container.NewVBox(summary, widget.NewAccordion(toDelete, kept))
+
+	if len(remove) == 0 {
+		d := dialog.NewCustom("Free Up Space", "Close", container.NewVScroll(content), w)
+		d.Resize(fyne.NewSize(700, 480))
+		d.Show()
+		return
+	}
+	d := dialog.NewCustomConfirm("Free Up Space", fmt.Sprintf("Delete %d Files", len(remove)), "Cancel", container.NewVScroll(content), func(confirmed bool) {
+		if confirmed {
+			onDelete()
+		}
+	}, w)
+	d.Resize(fyne.NewSize(700, 480))
+	d.Show()
+}
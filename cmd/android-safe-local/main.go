@@ -1,24 +1,36 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
 	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/apps"
 	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/content"
 	"AndroidSafeLocal/internal/dedup"
 	device_pkg "AndroidSafeLocal/internal/device"
 	"AndroidSafeLocal/internal/gallery"
 	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"AndroidSafeLocal/internal/snapshot"
 	"AndroidSafeLocal/internal/sorter"
+	"AndroidSafeLocal/internal/storage"
 )
 
 func main() {
@@ -34,8 +46,10 @@ func main() {
 	statusLabel := widget.NewLabel("Checking connection...")
 	statusLabel.Wrapping = fyne.TextWrapWord
 	deviceIcon := widget.NewIcon(theme.ComputerIcon()) // Placeholder for phone icon
+	refreshDeviceBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), nil)
+	wirelessBtn := widget.NewButton("Wireless", nil)
 	statusCard := widget.NewCard("Device Status", "", container.NewVBox(
-		container.NewHBox(deviceIcon, widget.NewLabel("Android Device")),
+		container.NewHBox(deviceIcon, widget.NewLabel("Android Device"), layout.NewSpacer(), wirelessBtn, refreshDeviceBtn),
 		statusLabel,
 	))
 
@@ -43,13 +57,19 @@ func main() {
 	sourceEntry := widget.NewEntry()
 	sourceEntry.SetText("/sdcard/DCIM")
 
-	sourceSelect := widget.NewSelect([]string{
+	sourceFolders := []string{
 		"/sdcard",
 		"/sdcard/DCIM",
 		"/sdcard/Download",
 		"/sdcard/Pictures",
 		"/storage/emulated/0",
-	}, func(s string) {
+	}
+	// Storage volume entries of the quick select and the root each one stands for
+	volumeRoots := make(map[string]string)
+	sourceSelect := widget.NewSelect(sourceFolders, func(s string) {
+		if root, ok := volumeRoots[s]; ok {
+			s = root
+		}
 		sourceEntry.SetText(s)
 	})
 	sourceSelect.PlaceHolder = "Quick Select..."
@@ -57,11 +77,41 @@ func main() {
 	destEntry := widget.NewEntry()
 	destEntry.SetText("C:\\Backup\\Android")
 
+	excludeEntry := widget.NewEntry()
+	excludeEntry.SetPlaceHolder(".tmp, .thumbnails, /sdcard/Android")
+
+	limitEntry := widget.NewEntry()
+	limitEntry.SetPlaceHolder("MB/s, empty = unlimited")
+	windowEntry := widget.NewEntry()
+	windowEntry.SetPlaceHolder("09:00-18:00, empty = always")
+	lowPriorityCheck := widget.NewCheck("Low priority on device (nice/ionice)", nil)
+	// Filled with the modes the device offers once it is connected
+	accessSelect := widget.NewSelect([]string{adb.Access{}.String()}, nil)
+	accessSelect.SetSelectedIndex(0)
+
+	repoCheck := widget.NewCheck("Repository mode: store each content once, tree and snapshots link to it", nil)
+	encryptCheck := widget.NewCheck("Encrypt the repository (new, empty destination folders only)", nil)
+	passphraseEntry := widget.NewPasswordEntry()
+	passphraseEntry.SetPlaceHolder("Passphrase of an encrypted backup")
+
+	retentionEntry := widget.NewEntry()
+	retentionEntry.SetPlaceHolder("last=10,daily=7,weekly=4,monthly=12,within=30d, empty = keep all")
+
 	configCard := widget.NewCard("Configuration", "", container.NewVBox(
 		widget.NewLabelWithStyle("Source Path (Mobile)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		container.NewBorder(nil, nil, nil, sourceSelect, sourceEntry),
-		widget.NewLabelWithStyle("Destination Path (PC)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Destination Path (PC, or sftp://, webdav://, s3:// URL)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		destEntry,
+		widget.NewLabelWithStyle("Exclude (extensions or device paths)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		excludeEntry,
+		widget.NewLabelWithStyle("Bandwidth Limit", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		container.NewGridWithColumns(2, limitEntry, windowEntry),
+		container.NewGridWithColumns(2, lowPriorityCheck,
+			container.NewBorder(nil, nil, widget.NewLabel("Access (app folders):"), nil, accessSelect)),
+		widget.NewLabelWithStyle("Keep Snapshots (pruned after each backup)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		retentionEntry,
+		repoCheck,
+		container.NewGridWithColumns(2, encryptCheck, passphraseEntry),
 	))
 
 	// 3. LOGS
@@ -80,20 +130,221 @@ func main() {
 	// 4. Progress
 	progressBar := widget.NewProgressBar()
 	progressBar.Hide()
+	progressLabel := widget.NewLabel("")
+	progressLabel.Hide()
+
+	// trackProgress mirrors a byte progress tracker on the bar and label until stop is closed
+	trackProgress := func(p *backup.Progress, stop <-chan struct{}) {
+		progressBar.Max = 1
+		progressBar.SetValue(0)
+		progressLabel.SetText("")
+		progressLabel.Show()
+		go func() {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					progressLabel.Hide()
+					return
+				case <-ticker.C:
+					s := p.Snapshot()
+					progressBar.SetValue(s.Fraction())
+					progressLabel.SetText(s.String())
+				}
+			}
+		}()
+	}
 
 	// -- STATE --
 	var client *adb.Client
 	var files []device_pkg.File
+	// profile is the device information read before the current backup, stored with its session
+	var profile *adb.DeviceInfo
+	// volumes of the connected device, the one a backup reads from is recorded in its manifest
+	var volumes []device_pkg.Volume
+
+	// showDevice fills the status card from the device information
+	showDevice := func(info adb.DeviceInfo, serial string) {
+		lines := []string{"Connected:", info.Name(), serial,
+			fmt.Sprintf("Android %s (SDK %d)", info.AndroidVersion, info.SDK), "Build " + info.Build}
+		if info.BatteryLevel >= 0 {
+			battery := fmt.Sprintf("Battery %d%%", info.BatteryLevel)
+			if info.Charging {
+				battery += " (charging)"
+			}
+			lines = append(lines, battery)
+		}
+		for _, d := range info.Disks {
+			lines = append(lines, fmt.Sprintf("%s: %s free of %s", d.Name, backup.FormatBytes(d.Free), backup.FormatBytes(d.Total)))
+		}
+		statusLabel.SetText(strings.Join(lines, "\n"))
+	}
+
+	// Decrypted temporary views of encrypted backups, deleted when the window closes
+	var views []string
+	var viewsMu sync.Mutex
+
+	// One limiter shared by every backup and restore pool
+	limiter := backup.NewRateLimiter(0)
+	lowPriorityCheck.OnChanged = func(on bool) {
+		if client != nil {
+			client.LowPriority.Store(on)
+		}
+	}
+	accessSelect.OnChanged = func(s string) {
+		access, err := adb.ParseAccess(s)
+		if err != nil || client == nil {
+			return
+		}
+		client.Access = access
+		logPrint("Listing and pulling as " + access.String())
+	}
+
+	// detectVolumes adds the internal storage, SD cards and USB drives to the source quick select
+	detectVolumes := func() {
+		found, err := device_pkg.ListVolumes(client)
+		if err != nil {
+			logPrint("Storage volumes: " + err.Error())
+			return
+		}
+		roots := make(map[string]string)
+		options := slices.Clone(sourceFolders)
+		for _, v := range found {
+			label := fmt.Sprintf("%s (%s free)", v.Name(), backup.FormatBytes(v.Free))
+			roots[label] = v.Path
+			options = append(options, label)
+			if v.Kind != device_pkg.VolumeInternal {
+				logPrint(fmt.Sprintf("%s at %s, %s free", v.Name(), v.Path, backup.FormatBytes(v.Free)))
+			}
+		}
+		fyne.Do(func() {
+			volumes = found
+			volumeRoots = roots
+			sourceSelect.SetOptions(options)
+		})
+	}
+
+	// detectAccess offers root and run-as in the access select when the device allows them
+	detectAccess := func() {
+		modes, err := client.AccessModes()
+		if err != nil {
+			logPrint("Access modes: " + err.Error())
+		}
+		options := make([]string, len(modes))
+		for i, m := range modes {
+			options[i] = m.String()
+		}
+		fyne.Do(func() {
+			accessSelect.SetOptions(options)
+			accessSelect.SetSelected(adb.Access{}.String())
+		})
+		if len(modes) > 1 {
+			logPrint(fmt.Sprintf("Access modes available: %s", strings.Join(options, ", ")))
+		}
+	}
+
+	// applyThrottle copies the bandwidth settings into the shared limiter
+	applyThrottle := func() {
+		mbps, err := strconv.ParseFloat(strings.TrimSpace(limitEntry.Text), 64)
+		if err != nil || mbps <= 0 {
+			limiter.SetRate(0)
+		} else {
+			limiter.SetRate(int64(mbps * 1024 * 1024))
+		}
+		limiter.ClearWindow()
+		if strings.TrimSpace(windowEntry.Text) != "" {
+			window, err := backup.ParseTimeWindow(windowEntry.Text)
+			if err != nil {
+				logPrint("Ignoring bandwidth window: " + err.Error())
+			} else {
+				limiter.SetWindow(window)
+			}
+		}
+		logPrint("Bandwidth: " + limiter.String())
+	}
 
 	// -- ACTIONS --
 	var scanBtn *widget.Button
 
+	// adaptiveConfig lets the pools find the worker count the phone and disk can sustain
+	adaptiveConfig := func() backup.AdaptiveConfig {
+		cfg := backup.DefaultAdaptiveConfig()
+		cfg.OnAdjust = func(lane string, from, to int, reason string) {
+			logPrint(fmt.Sprintf("Workers (%s files): %d → %d (%s)", lane, from, to, reason))
+		}
+		return cfg
+	}
+
 	backgroundOp := func(action func()) {
 		go func() {
 			action()
 		}()
 	}
 
+	// retryPolicy reconnects a device attached over Wi-Fi before retrying, so a
+	// backup carries on when the phone comes back after a Wi-Fi drop or sleep
+	retryPolicy := func() backup.RetryPolicy {
+		rp := backup.DefaultRetryPolicy()
+		devices, err := client.Devices()
+		if err != nil || len(devices) == 0 || !adb.IsWireless(devices[0].Serial) {
+			return rp
+		}
+		known := &adb.KnownDevices{}
+		if path, err := adb.KnownDevicesPath(); err == nil {
+			if k, err := adb.LoadKnownDevices(path); err == nil {
+				known = k
+			}
+		}
+		rp.Reconnect = client.Reconnector(known.ForSerial(devices[0].Serial))
+		return rp
+	}
+
+	// Battery and storage change during a backup, the status card is refreshed on request
+	refreshDeviceBtn.OnTapped = func() {
+		if client == nil {
+			return
+		}
+		backgroundOp(func() {
+			devices, err := client.Devices()
+			if err != nil || len(devices) == 0 {
+				statusLabel.SetText("No Device Connected.\nCheck USB Cable or connect over Wireless.")
+				return
+			}
+			info, err := client.DeviceInfo()
+			if err != nil {
+				logPrint("Device information unavailable: " + err.Error())
+				return
+			}
+			showDevice(info, devices[0].Serial)
+		})
+	}
+
+	wirelessBtn.OnTapped = func() {
+		if client == nil {
+			dialog.ShowError(fmt.Errorf("ADB not initialized"), w)
+			return
+		}
+		path, err := adb.KnownDevicesPath()
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		known, err := adb.LoadKnownDevices(path)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		showWirelessDialog(w, client, known, func(d adb.WirelessDevice) {
+			logPrint("Connected over Wi-Fi: " + d.String())
+			refreshDeviceBtn.OnTapped()
+			backgroundOp(func() {
+				detectVolumes()
+				detectAccess()
+			})
+		})
+	}
+
 	// Scan Action
 	scanBtn = widget.NewButtonWithIcon("Scan Files", theme.SearchIcon(), func() {
 		if client == nil {
@@ -116,55 +367,263 @@ func main() {
 			}
 			logPrint(fmt.Sprintf("Found %d files.", len(files)))
 			progressBar.Hide()
+			if warnings := walker.Warnings(); len(warnings) > 0 {
+				logPrint("Scan warnings: " + device_pkg.WarningSummary(warnings))
+				access := client.Access
+				fyne.Do(func() { showScanWarnings(w, warnings, access) })
+			}
 		})
 	})
 
 	// Backup Action
-	backupBtn := widget.NewButtonWithIcon("Start Backup", theme.DownloadIcon(), func() {
-		if len(files) == 0 {
-			dialog.ShowInformation("Info", "Please scan for files first.", w)
+	var backupBtn *widget.Button
+
+	// Retry Action: re-runs the files that failed in the last backup or restore
+	var retryFailed func()
+	retryBtn := widget.NewButtonWithIcon("Retry Failed", theme.ViewRefreshIcon(), func() {
+		if retryFailed != nil {
+			retryFailed()
+		}
+	})
+	retryBtn.Disable()
+	setRetry := func(fn func()) {
+		retryFailed = fn
+		if fn != nil {
+			retryBtn.Enable()
+		} else {
+			retryBtn.Disable()
+		}
+	}
+
+	// pruneSnapshots applies the retention rules to the snapshots of a backup.
+	// repository may be nil for a plain backup folder.
+	pruneSnapshots := func(destRoot, spec string, repository *repo.Repo) {
+		policy, err := snapshot.ParsePolicy(spec)
+		if err != nil {
+			logPrint("Snapshots not pruned: " + err.Error())
 			return
 		}
-		logPrint("Starting backup...")
-		progressBar.SetValue(0)
+		if policy.IsZero() {
+			return
+		}
+		pp, err := snapshot.PlanPrune(destRoot, policy, time.Now(), repository.Sealer())
+		if err != nil {
+			logPrint("Snapshots not pruned: " + err.Error())
+			return
+		}
+		removed := pp.Removed()
+		if len(removed) == 0 {
+			return
+		}
+		for _, s := range removed {
+			logPrint("Pruning snapshot " + s.Name)
+		}
+		if err := pp.Execute(destRoot); err != nil {
+			logPrint("Pruning failed: " + err.Error())
+			return
+		}
+		logPrint(fmt.Sprintf("Pruned %d snapshots (%s), freed %d files (%s)", len(removed), policy, len(pp.Files), backup.FormatBytes(pp.Bytes)))
+		if repository != nil {
+			if n, freed, err := repository.GC(); err != nil {
+				logPrint("Repository cleanup failed: " + err.Error())
+			} else if n > 0 {
+				logPrint(fmt.Sprintf("Removed %d unreferenced objects (%s)", n, backup.FormatBytes(freed)))
+			}
+		}
+	}
+
+	// unlockRepository returns the repository at root, unlocked with the passphrase
+	// if it is encrypted. nil without an error means a plain backup folder.
+	unlockRepository := func(root string) (*repo.Repo, error) {
+		r, err := repo.Open(root)
+		if errors.Is(err, repo.ErrNotRepository) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Locked() {
+			if passphraseEntry.Text == "" {
+				return nil, errors.New("this backup is encrypted, enter its passphrase")
+			}
+			if err := r.Unlock(passphraseEntry.Text); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+
+	// openRepository returns the repository at destRoot, creating it when repository mode is
+	// ticked. nil means a plain backup folder; an error means the backup must not start.
+	openRepository := func(destRoot string) (*repo.Repo, error) {
+		r, err := unlockRepository(destRoot)
+		if err != nil || r != nil || !repoCheck.Checked {
+			return r, err
+		}
+		if encryptCheck.Checked {
+			if passphraseEntry.Text == "" {
+				return nil, errors.New("enter a passphrase for the encrypted repository")
+			}
+			r, err = repo.InitEncrypted(destRoot, passphraseEntry.Text)
+			if err != nil {
+				return nil, err
+			}
+			logPrint("Created an encrypted repository. Keep the passphrase and a copy of " + repo.KeyFile + " safe: without them the backup can't be read.")
+			return r, nil
+		}
+		r, err = repo.Init(destRoot)
+		if err != nil {
+			logPrint("Repository mode off: " + err.Error())
+			return nil, nil
+		}
+		logPrint("Backup folder converted to repository mode.")
+		return r, nil
+	}
+
+	// newView decrypts entries of an encrypted repository into a temporary folder
+	newView := func(r *repo.Repo, entries []manifest.Entry) (string, error) {
+		dir, err := os.MkdirTemp("", "android-safe-local-view-")
+		if err != nil {
+			return "", err
+		}
+		viewsMu.Lock()
+		views = append(views, dir)
+		viewsMu.Unlock()
+		logPrint(fmt.Sprintf("Decrypting %d files into a temporary view...", len(entries)))
+		_, missing, err := r.Materialize(entries, dir)
+		if missing > 0 {
+			logPrint(fmt.Sprintf("Warning: %d files have no stored content", missing))
+		}
+		return dir, err
+	}
+
+	// openRemote connects to a remote backup and makes a folder to stage pulled
+	// files in, deleted when the app closes
+	openRemote := func(location string) (storage.Storage, string, error) {
+		if repoCheck.Checked {
+			return nil, "", errors.New("repository mode and encryption need a local destination folder")
+		}
+		st, err := storage.Open(location)
+		if err != nil {
+			return nil, "", err
+		}
+		stage, err := os.MkdirTemp("", "android-safe-local-stage-")
+		if err != nil {
+			st.Close()
+			return nil, "", err
+		}
+		viewsMu.Lock()
+		views = append(views, stage)
+		viewsMu.Unlock()
+		return st, stage, nil
+	}
+
+	// fetchJobs downloads entries of a remote backup into a temporary folder and
+	// returns the jobs restoring them
+	fetchJobs := func(location string, entries []manifest.Entry) ([]backup.RestoreJob, error) {
+		st, err := storage.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		defer st.Close()
+		dir, err := os.MkdirTemp("", "android-safe-local-view-")
+		if err != nil {
+			return nil, err
+		}
+		viewsMu.Lock()
+		views = append(views, dir)
+		viewsMu.Unlock()
+		logPrint(fmt.Sprintf("Downloading %d files from %s...", len(entries), st))
+		if err := backup.Fetch(st, entries, dir); err != nil {
+			return nil, err
+		}
+		return backup.RestoreJobs(dir, entries), nil
+	}
+
+	// takeSnapshot records the device as the plan saw it, linking each file to its backup copy
+	takeSnapshot := func(plan *backup.Plan, m *manifest.Manifest, source string, repository *repo.Repo) {
+		entries, missing := backup.SnapshotEntries(plan, m)
+		if name, ok := snapshot.Unchanged(plan.DestRoot, source, entries, missing, repository.Sealer()); ok {
+			logPrint("Nothing changed since snapshot " + name + ", no new snapshot taken")
+			pruneSnapshots(plan.DestRoot, retentionEntry.Text, repository)
+			return
+		}
+		info, err := snapshot.Create(plan.DestRoot, snapshot.Info{Source: source, Missing: missing, Device: profile}, entries, repository.Sealer())
+		if err != nil {
+			logPrint("Warning: snapshot failed: " + err.Error())
+			return
+		}
+		msg := fmt.Sprintf("Snapshot %s: %d files (%s)", info.Name, info.Files, backup.FormatBytes(info.Bytes))
+		if info.Missing > 0 {
+			msg += fmt.Sprintf(", %d not backed up", info.Missing)
+		}
+		if info.Copied > 0 {
+			msg += fmt.Sprintf(", %d copied because the drive has no hardlinks", info.Copied)
+		}
+		logPrint(msg)
+		pruneSnapshots(plan.DestRoot, retentionEntry.Text, repository)
+	}
+
+	// runBackup transfers the jobs of a confirmed plan (or the failures of a previous run)
+	// and snapshots the plan's files once the manifest is saved. repository is nil for a
+	// plain backup folder, remote nil for a local one; a remote backup is staged in
+	// plan.DestRoot and has no snapshots. Retries carry on the session of the first run.
+	var runBackup func(jobs []backup.Job, plan *backup.Plan, registry *dedup.Registry, repository *repo.Repo, remote storage.Storage, session manifest.Session)
+	runBackup = func(jobs []backup.Job, plan *backup.Plan, registry *dedup.Registry, repository *repo.Repo, remote storage.Storage, session manifest.Session) {
+		destRoot := plan.DestRoot
+		source := session.Source
+		var totalBytes int64
+		for _, job := range jobs {
+			totalBytes += job.Size
+		}
+		logPrint(fmt.Sprintf("Starting backup of %d files (%s)...", len(jobs), backup.FormatBytes(totalBytes)))
+		applyThrottle()
+		backupBtn.Disable()
+		setRetry(nil)
 		progressBar.Show()
-		progressBar.Max = float64(len(files))
+		progress := backup.NewProgress(len(jobs), totalBytes)
+		stopProgress := make(chan struct{})
+		trackProgress(progress, stopProgress)
 
 		backgroundOp(func() {
-			// Initialize Registry
-			registry := dedup.NewRegistry()
-			logPrint("Loading local index...")
-			if err := registry.Load(destEntry.Text); err != nil {
-				logPrint("Registry warning: " + err.Error())
+			defer backupBtn.Enable()
+			defer close(stopProgress)
+			var agent backup.Processor = &backup.TransferAgent{Client: client}
+			var st storage.Storage = storage.NewLocal(destRoot)
+			if remote != nil {
+				agent = &backup.StorageAgent{Pull: agent, Storage: remote, StageRoot: destRoot}
+				st = remote
 			}
-
-			agent := &backup.TransferAgent{Client: client}
 			pool := backup.NewPool(5, agent, registry)
+			pool.SetProgress(progress)
+			pool.SetRetryPolicy(retryPolicy())
+			pool.SetAdaptive(adaptiveConfig())
+			pool.SetLimiter(limiter)
 			pool.Start()
 
-			fileSorter := sorter.NewSorter()
-			destRoot := destEntry.Text
 			failures := 0
 			success := 0
+			var failed []backup.Job
 
-			// Initialize Manifest
-			backupManifest := manifest.New()
+			// Extend the manifest of earlier runs into the same folder
+			backupManifest, err := manifest.OpenFrom(st, repository.Sealer())
+			if err != nil {
+				logPrint("Warning: existing manifest unreadable, starting a new one: " + err.Error())
+				backupManifest = manifest.New()
+			}
+			if v, ok := device_pkg.VolumeFor(volumes, source); ok {
+				backupManifest.RecordVolume(v)
+			}
+			if n, err := repository.Import(backupManifest); err != nil {
+				logPrint("Warning: could not store earlier files in the repository: " + err.Error())
+			} else if n > 0 {
+				logPrint(fmt.Sprintf("Stored %d files from earlier runs in the repository", n))
+			}
 
 			// Feeder
 			go func() {
-				for _, f := range files {
-					if f.IsDir {
-						progressBar.Max = progressBar.Max - 1
-						continue
-					}
-					relDest := fileSorter.GetDestination(f)
-					fullDest := filepath.Join(destRoot, relDest)
-					pool.AddJob(backup.Job{
-						SourcePath: f.Path,
-						DestPath:   fullDest,
-						Size:       f.Size,
-						Timestamp:  f.Timestamp,
-					})
+				for _, job := range jobs {
+					pool.AddJob(job)
 				}
 				pool.Close()
 			}()
@@ -172,30 +631,153 @@ func main() {
 			// Collector
 			for res := range pool.Results() {
 				if res.Error != nil {
-					logPrint(fmt.Sprintf("FAIL: %s (%v)", filepath.Base(res.Job.SourcePath), res.Error))
+					logPrint(fmt.Sprintf("FAIL: %s after %d attempt(s) [%s] (%v)", filepath.Base(res.Job.SourcePath), res.Attempts, adb.Classify(res.Error), res.Error))
 					failures++
+					failed = append(failed, res.Job)
 				} else if res.Skipped {
 					logPrint(fmt.Sprintf("SKIP: %s", filepath.Base(res.Job.SourcePath)))
 					success++
 				} else {
 					// Add to manifest on success
-					relPath, _ := filepath.Rel(destRoot, res.Job.DestPath)
-					backupManifest.Add(res.Job.SourcePath, relPath, res.Job.Size, res.Job.Timestamp)
+					if err := repository.Record(backupManifest, destRoot, res.Job); err != nil {
+						logPrint(fmt.Sprintf("Warning: %s not stored in the repository: %v", filepath.Base(res.Job.SourcePath), err))
+					}
 					success++
 				}
-				progressBar.SetValue(progressBar.Value + 1)
+				if res.Attempts > 1 && res.Error == nil {
+					logPrint(fmt.Sprintf("OK after %d attempts: %s", res.Attempts, filepath.Base(res.Job.SourcePath)))
+				}
 			}
 
 			logPrint(fmt.Sprintf("Finished. Processed: %d. Failures: %d", success, failures))
-
+			logPrint(progress.Snapshot().String())
 			// Save manifest
-			if err := backupManifest.Save(destRoot); err != nil {
+			session.Files += success
+			session.Failures = failures
+			backupManifest.UpdateSession(session)
+			if len(failed) > 0 {
+				logPrint(fmt.Sprintf("%d files failed. Use Retry Failed to try them again.", len(failed)))
+				setRetry(func() { runBackup(failed, plan, registry, repository, remote, session) })
+			}
+			if err := backupManifest.SaveTo(st, repository.Sealer()); err != nil {
 				logPrint("Warning: Failed to save manifest: " + err.Error())
+			} else if remote != nil {
+				logPrint("Manifest saved to " + remote.String() + ". Snapshots are kept for local backups only.")
 			} else {
 				logPrint("Manifest saved.")
+				takeSnapshot(plan, backupManifest, source, repository)
+			}
+			if remote != nil && len(failed) == 0 {
+				remote.Close()
 			}
 			progressBar.Hide()
 		})
+	}
+
+	backupBtn = widget.NewButtonWithIcon("Start Backup", theme.DownloadIcon(), func() {
+		if len(files) == 0 {
+			dialog.ShowInformation("Info", "Please scan for files first.", w)
+			return
+		}
+		logPrint("Planning backup...")
+		backupBtn.Disable()
+		destRoot := destEntry.Text
+		source := sourceEntry.Text
+		filter := backup.ParseFilter(excludeEntry.Text)
+
+		backgroundOp(func() {
+			var (
+				repository *repo.Repo
+				remote     storage.Storage
+				err        error
+			)
+			stageRoot := destRoot
+			if storage.IsRemote(destRoot) {
+				remote, stageRoot, err = openRemote(destRoot)
+			} else {
+				repository, err = openRepository(destRoot)
+			}
+			if err != nil {
+				logPrint("Backup not started: " + err.Error())
+				backupBtn.Enable()
+				return
+			}
+			if info, err := client.DeviceInfo(); err != nil {
+				logPrint("Warning: device information unavailable: " + err.Error())
+				profile = nil
+			} else {
+				profile = &info
+				if warning, err := backup.DefaultBatteryCheck().Check(info); err != nil {
+					logPrint("Backup not started: " + err.Error())
+					fyne.Do(func() { dialog.ShowError(err, w) })
+					if remote != nil {
+						remote.Close()
+					}
+					backupBtn.Enable()
+					return
+				} else if warning != "" {
+					logPrint("Warning: " + warning)
+				}
+			}
+			var st storage.Storage = storage.NewLocal(destRoot)
+			if remote != nil {
+				st = remote
+			}
+
+			// Initialize Registry
+			registry := dedup.NewRegistry()
+			logPrint("Loading index of " + st.String() + "...")
+			if err := registry.LoadFrom(st); err != nil {
+				logPrint("Registry warning: " + err.Error())
+			}
+			if repository.Encrypted() {
+				// No tree to scan, the manifest lists what is backed up
+				m, err := manifest.OpenSealed(destRoot, repository.Sealer())
+				if err != nil {
+					logPrint("Backup not started: " + err.Error())
+					backupBtn.Enable()
+					return
+				}
+				registry.AddEntries(m.Entries)
+			}
+
+			plan := backup.BuildPlanOn(st, files, sorter.NewSorter(), filter, registry, stageRoot)
+			logPrint("Backup plan:\n" + plan.Summary())
+
+			if len(plan.Jobs()) == 0 {
+				logPrint("Nothing to back up.")
+				// The device may still have lost or renamed files since the last snapshot
+				if remote != nil {
+					remote.Close()
+				} else if m, err := manifest.OpenSealed(destRoot, repository.Sealer()); err == nil {
+					takeSnapshot(plan, m, source, repository)
+				}
+				backupBtn.Enable()
+				return
+			}
+
+			message := plan.Summary()
+			if !plan.HasSpace() {
+				message += "\n\nThe backup will likely fail part way through."
+			}
+			fyne.Do(func() {
+				dialog.ShowCustomConfirm("Confirm Backup", "Start Backup", "Cancel",
+					widget.NewLabelWithStyle(message, fyne.TextAlignLeading, fyne.TextStyle{Monospace: true}),
+					func(confirmed bool) {
+						if !confirmed {
+							logPrint("Backup cancelled.")
+							if remote != nil {
+								remote.Close()
+							}
+							backupBtn.Enable()
+							return
+						}
+						logPrint(fmt.Sprintf("Skipped by plan: %d", plan.Count(backup.ActionSkip)))
+						session := manifest.Session{Started: time.Now().Format("2006-01-02 15:04"), Source: source, Device: profile}
+						runBackup(plan.Jobs(), plan, registry, repository, remote, session)
+					}, w)
+			})
+		})
 	})
 
 	// Gallery Action
@@ -207,10 +789,49 @@ func main() {
 
 		backgroundOp(func() {
 			gen := gallery.NewGenerator()
-			count, err := gen.Generate(dest, func(current, total int) {
+			onProgress := func(current, total int) {
 				progressBar.Max = float64(total)
 				progressBar.SetValue(float64(current))
-			})
+			}
+			if storage.IsRemote(dest) {
+				// Thumbnails and index.html are uploaded next to the photos
+				st, err := storage.Open(dest)
+				if err != nil {
+					logPrint("Gallery Error: " + err.Error())
+					progressBar.Hide()
+					return
+				}
+				defer st.Close()
+				count, err := gen.GenerateOn(st, onProgress)
+				if err != nil {
+					logPrint(fmt.Sprintf("Gallery Error (%d items done): %s", count, err.Error()))
+				} else {
+					logPrint(fmt.Sprintf("Gallery Created in %s (%d items)", st, count))
+				}
+				progressBar.Hide()
+				return
+			}
+
+			repository, err := unlockRepository(dest)
+			if err != nil {
+				logPrint("Gallery Error: " + err.Error())
+				progressBar.Hide()
+				return
+			}
+			if repository.Encrypted() {
+				// Thumbnails are never written next to the encrypted objects
+				m, err := manifest.LoadSealed(dest, repository.Sealer())
+				if err == nil {
+					dest, err = newView(repository, m.Entries)
+				}
+				if err != nil {
+					logPrint("Gallery Error: " + err.Error())
+					progressBar.Hide()
+					return
+				}
+				logPrint("Gallery of the encrypted backup is in " + dest + ", deleted when the app closes")
+			}
+			count, err := gen.Generate(dest, onProgress)
 			if err != nil {
 				if count > 0 {
 					logPrint(fmt.Sprintf("Gallery incomplete (%d items). Error: %s", count, err.Error()))
@@ -228,6 +849,306 @@ func main() {
 		})
 	})
 
+	// Apps Actions: APKs go to the Apps folder of the destination
+	appsBackupBtn := widget.NewButtonWithIcon("Backup Apps", theme.StorageIcon(), func() {
+		if client == nil {
+			dialog.ShowError(fmt.Errorf("ADB not initialized"), w)
+			return
+		}
+		dest := destEntry.Text
+		if !storage.IsRemote(dest) {
+			if r, err := repo.Open(dest); err == nil && r.Encrypted() {
+				dialog.ShowError(errors.New("the APKs would be stored unencrypted next to this encrypted repository, choose another folder"), w)
+				return
+			}
+		}
+		logPrint("Listing installed apps...")
+		backgroundOp(func() {
+			pkgs, err := client.Packages()
+			if err != nil {
+				logPrint("Apps Error: " + err.Error())
+				return
+			}
+			if len(pkgs) == 0 {
+				logPrint("No user-installed apps found.")
+				return
+			}
+			labels := make([]string, len(pkgs))
+			for i, p := range pkgs {
+				labels[i] = p.Name
+			}
+			fyne.Do(func() {
+				showAppsDialog(w, "Back Up Apps", "Back Up", labels, func(chosen []int) {
+					names := make([]string, len(chosen))
+					for i, c := range chosen {
+						names[i] = labels[c]
+					}
+					progressBar.Max = float64(len(names))
+					progressBar.SetValue(0)
+					progressBar.Show()
+					backgroundOp(func() {
+						defer progressBar.Hide()
+						st, err := storage.Open(dest)
+						if err != nil {
+							logPrint("Apps Error: " + err.Error())
+							return
+						}
+						defer st.Close()
+						done, stored := 0, 0
+						_, err = apps.Backup(client, st, names, func(res apps.Result) {
+							done++
+							progressBar.SetValue(float64(done))
+							switch {
+							case res.Err != nil:
+								logPrint(fmt.Sprintf("FAIL: %s (%v)", res.App.Package, res.Err))
+							case !res.Skipped:
+								stored++
+								logPrint(fmt.Sprintf("Stored %s (%d APKs, %s)", res.App, len(res.App.APKs), backup.FormatBytes(res.App.Size)))
+							}
+						})
+						if err != nil {
+							logPrint("Apps Error: " + err.Error())
+						}
+						logPrint(fmt.Sprintf("App backup finished: %d stored, %d already in the backup.", stored, done-stored))
+					})
+				})
+			})
+		})
+	})
+
+	appsRestoreBtn := widget.NewButtonWithIcon("Reinstall Apps", theme.ViewRefreshIcon(), func() {
+		if client == nil {
+			dialog.ShowError(fmt.Errorf("ADB not initialized"), w)
+			return
+		}
+		dest := destEntry.Text
+		backgroundOp(func() {
+			st, err := storage.Open(dest)
+			if err != nil {
+				logPrint("Apps Error: " + err.Error())
+				return
+			}
+			ix, err := apps.Load(st)
+			st.Close()
+			if err != nil {
+				logPrint("Apps Error: " + err.Error())
+				return
+			}
+			latest := ix.Latest()
+			if len(latest) == 0 {
+				logPrint("No apps in this backup. Use Backup Apps first.")
+				return
+			}
+			labels := make([]string, len(latest))
+			for i, app := range latest {
+				labels[i] = fmt.Sprintf("%s (%s, %s)", app, backup.FormatBytes(app.Size), app.BackedUp)
+			}
+			fyne.Do(func() {
+				showAppsDialog(w, "Reinstall Apps", "Reinstall", labels, func(chosen []int) {
+					selected := make([]apps.App, len(chosen))
+					for i, c := range chosen {
+						selected[i] = latest[c]
+					}
+					progressBar.Max = float64(len(selected))
+					progressBar.SetValue(0)
+					progressBar.Show()
+					backgroundOp(func() {
+						defer progressBar.Hide()
+						st, err := storage.Open(dest)
+						if err != nil {
+							logPrint("Apps Error: " + err.Error())
+							return
+						}
+						defer st.Close()
+						done, failures := 0, 0
+						apps.Restore(client, st, selected, func(res apps.Result) {
+							done++
+							progressBar.SetValue(float64(done))
+							if res.Err != nil {
+								failures++
+								logPrint(fmt.Sprintf("FAIL: %s (%v)", res.App, res.Err))
+							} else {
+								logPrint("Installed " + res.App.String())
+							}
+						})
+						logPrint(fmt.Sprintf("Reinstalled %d apps. Failures: %d", done-failures, failures))
+					})
+				})
+			})
+		})
+	})
+
+	// Phone Data Action: contacts, messages and calls go to the backup root
+	contentBtn := widget.NewButtonWithIcon("Contacts & SMS", theme.AccountIcon(), func() {
+		if client == nil {
+			dialog.ShowError(fmt.Errorf("ADB not initialized"), w)
+			return
+		}
+		dest := destEntry.Text
+		if !storage.IsRemote(dest) {
+			if r, err := repo.Open(dest); err == nil && r.Encrypted() {
+				dialog.ShowError(errors.New("contacts and messages would be stored unencrypted next to this encrypted repository, choose another folder"), w)
+				return
+			}
+		}
+		logPrint("Exporting contacts, messages and call log...")
+		backgroundOp(func() {
+			st, err := storage.Open(dest)
+			if err != nil {
+				logPrint("Export Error: " + err.Error())
+				return
+			}
+			defer st.Close()
+			_, err = content.Export(client, st, content.Kinds, content.JSON, func(res content.Result) {
+				if res.Err != nil {
+					logPrint(fmt.Sprintf("FAIL: %s (%v)", res.Kind, res.Err))
+					return
+				}
+				logPrint(fmt.Sprintf("Exported %d %s to %s (%s)", res.Data.Records, res.Kind, res.Data.LocalPath, backup.FormatBytes(res.Data.Size)))
+			})
+			if err != nil {
+				logPrint("Export Error: " + err.Error())
+			}
+		})
+	})
+
+	// runRestore pushes files back to the device (a manifest restore or the failures of a previous one).
+	// checker may be nil to push without looking at the device first, verifier nil to skip
+	// checking the pushed files afterwards.
+	var runRestore func(jobs []backup.RestoreJob, checker *backup.ConflictChecker, verifier *backup.RestoreVerifier)
+	runRestore = func(jobs []backup.RestoreJob, checker *backup.ConflictChecker, verifier *backup.RestoreVerifier) {
+		setRetry(nil)
+		applyThrottle()
+		progressBar.Show()
+		var totalBytes int64
+		for _, job := range jobs {
+			totalBytes += job.Size
+		}
+		progress := backup.NewProgress(len(jobs), totalBytes)
+		stopProgress := make(chan struct{})
+		trackProgress(progress, stopProgress)
+
+		backgroundOp(func() {
+			defer close(stopProgress)
+			// Start with more workers than backup, pushes are mostly small files
+			restorePool := backup.NewRestorePool(15, client)
+			restorePool.SetProgress(progress)
+			restorePool.SetRetryPolicy(retryPolicy())
+			restorePool.SetAdaptive(adaptiveConfig())
+			restorePool.SetLimiter(limiter)
+			restorePool.SetConflictChecker(checker)
+			restorePool.Start()
+
+			total := len(jobs)
+
+			// Feeder goroutine - send all jobs
+			go func() {
+				for _, job := range jobs {
+					restorePool.AddJob(job)
+				}
+				restorePool.Close()
+			}()
+
+			// Collector - process results with optimized logging
+			success := 0
+			failures := 0
+			skipped := 0
+			timeFailures := 0
+			var failed []backup.RestoreJob
+			var pushed []backup.RestoreDecision
+			lastLoggedProgress := 0
+			logInterval := max(1, total/20) // Log every 5% or at least every file if < 20 files
+
+			for res := range restorePool.Results() {
+				if res.Error != nil {
+					// Always log failures
+					logPrint(fmt.Sprintf("✗ FAIL: %s after %d attempt(s) [%s] - %s", filepath.Base(res.Job.LocalPath), res.Attempts, adb.Classify(res.Error), res.Error.Error()))
+					failures++
+					failed = append(failed, res.Job)
+				} else if res.Skipped {
+					skipped++
+				} else {
+					if res.Decision.Action == backup.RestoreRename {
+						logPrint(fmt.Sprintf("RENAMED: %s → %s", res.Job.OriginalPath, res.Decision.Target))
+					}
+					if res.TimeErr != nil {
+						timeFailures++
+					}
+					pushed = append(pushed, res.Decision)
+					success++
+				}
+
+				// Log progress periodically to avoid UI slowdown
+				processed := success + failures + skipped
+				if processed-lastLoggedProgress >= logInterval || processed == total {
+					logPrint("Progress: " + progress.Snapshot().String())
+					lastLoggedProgress = processed
+				}
+			}
+			logPrint(fmt.Sprintf("Restore Complete. Success: %d, Kept on device: %d, Failures: %d", success, skipped, failures))
+			if timeFailures > 0 {
+				logPrint(fmt.Sprintf("Warning: could not restore the original date of %d files", timeFailures))
+			}
+			if len(pushed) > 0 {
+				restored := make([]string, len(pushed))
+				for i, d := range pushed {
+					restored[i] = d.Target
+				}
+				logPrint(fmt.Sprintf("Asking the gallery to index %d restored files...", len(restored)))
+				if err := client.ScanMedia(restored); err != nil {
+					logPrint("Media scan failed, files will appear after the next device rescan: " + err.Error())
+				}
+			}
+			if len(failed) > 0 {
+				logPrint(fmt.Sprintf("%d files failed. Use Retry Failed to try them again.", len(failed)))
+				setRetry(func() { runRestore(failed, checker, verifier) })
+			}
+			if verifier != nil && len(pushed) > 0 {
+				logPrint(fmt.Sprintf("Verifying %d restored files on the device...", len(pushed)))
+				report, err := verifier.Verify(pushed)
+				if err != nil {
+					logPrint("Verification failed: " + err.Error())
+				} else {
+					for _, p := range report.Problems {
+						logPrint(fmt.Sprintf("✗ %s: %s %s", strings.ToUpper(p.Status.String()), p.Decision.Target, p.Detail))
+					}
+					logPrint("Verification: " + report.Summary())
+					if len(report.Problems) > 0 {
+						fyne.Do(func() {
+							dialog.ShowConfirm("Verification Problems",
+								fmt.Sprintf("%d restored files don't match the backup (%s).\nPush them again?", len(report.Problems), report.Summary()),
+								func(ok bool) {
+									if ok {
+										runRestore(report.Jobs(), nil, verifier)
+									}
+								}, w)
+						})
+					}
+				}
+			}
+			progressBar.Hide()
+		})
+	}
+
+	// remapJobs points jobs at the connected device, applying the user's path
+	// mapping and the SD card and user changes detected on the device
+	remapJobs := func(jobs []backup.RestoreJob, source []device_pkg.Volume, opts restoreOptions) (*backup.Remapper, []backup.PathChange, error) {
+		rules, err := backup.ParseRemapRules(opts.mapping)
+		if err != nil {
+			return nil, nil, err
+		}
+		layout, err := backup.DetectLayout(client)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read device storage layout: %w", err)
+		}
+		paths := make([]string, len(jobs))
+		for i, job := range jobs {
+			paths[i] = job.OriginalPath
+		}
+		remapper := backup.NewRemapper(rules, backup.AutoRemapRules(paths, source, layout))
+		return remapper, remapper.Apply(jobs), nil
+	}
+
 	// Restore Action
 	restoreBtn := widget.NewButtonWithIcon("Restore", theme.UploadIcon(), func() {
 		if client == nil {
@@ -235,9 +1156,31 @@ func main() {
 			return
 		}
 		localPath := destEntry.Text
+		remote := storage.IsRemote(localPath)
+		var repository *repo.Repo
+		var err error
+		if !remote {
+			if repository, err = unlockRepository(localPath); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+		}
 
 		// Try to load manifest
-		backupManifest, err := manifest.Load(localPath)
+		var backupManifest *manifest.Manifest
+		if remote {
+			var st storage.Storage
+			if st, err = storage.Open(localPath); err == nil {
+				backupManifest, err = manifest.LoadFrom(st, nil)
+				st.Close()
+			}
+		} else {
+			backupManifest, err = manifest.LoadSealed(localPath, repository.Sealer())
+		}
+		if err != nil && (repository.Encrypted() || remote) {
+			dialog.ShowError(err, w) // Never push the encrypted objects, and a URL isn't a folder
+			return
+		}
 		if err != nil {
 			// No manifest, fallback to folder push
 			remotePath := "/sdcard/Restored"
@@ -266,76 +1209,210 @@ func main() {
 			return
 		}
 
-		// Manifest found - restore to original locations
-		cnf2 := dialog.NewCustomConfirm(
-			"Confirm Restore",
-			"Restore to Original", "Cancel",
-			widget.NewLabel(fmt.Sprintf("Manifest found with %d files.\nRestore each file to its ORIGINAL location on the device?\n\nExisting files with same name will be overwritten.", len(backupManifest.Entries))),
-			func(confirmed bool) {
-				if !confirmed {
-					logPrint("Restore cancelled.")
-					return
+		// Manifest found - pick what to restore to original locations.
+		// localPath is the backup root or one of its snapshots.
+		restoreFrom := func(localPath string, backupManifest *manifest.Manifest) {
+			// restoreJobs reads encrypted backups from a decrypted view of the selected
+			// files, remote ones from a downloaded copy
+			restoreJobs := func(entries []manifest.Entry) ([]backup.RestoreJob, error) {
+				if remote {
+					return fetchJobs(localPath, entries)
 				}
-				logPrint("Restoring to original locations...")
-				progressBar.SetValue(0)
-				progressBar.Max = float64(len(backupManifest.Entries))
-				progressBar.Show()
-
+				if !repository.Encrypted() {
+					return backup.RestoreJobs(localPath, entries), nil
+				}
+				view, err := newView(repository, entries)
+				if err != nil {
+					return nil, err
+				}
+				return backup.RestoreJobs(view, entries), nil
+			}
+			preview := func(entries []manifest.Entry, opts restoreOptions) {
+				logPrint(fmt.Sprintf("Checking %d files on the device...", len(entries)))
 				backgroundOp(func() {
-					// Use parallel restore pool with more workers for small files
-					restorePool := backup.NewRestorePool(15, client)
-					restorePool.Start()
-
-					total := len(backupManifest.Entries)
-
-					// Feeder goroutine - send all jobs
-					go func() {
-						for i, entry := range backupManifest.Entries {
-							localFile := filepath.Join(localPath, entry.LocalPath)
-							restorePool.AddJob(backup.RestoreJob{
-								LocalPath:    localFile,
-								OriginalPath: entry.OriginalPath,
-								Index:        i + 1,
-								Total:        total,
-							})
+					jobs, err := restoreJobs(entries)
+					if err != nil {
+						logPrint("Preview failed: " + err.Error())
+						return
+					}
+					remapper, changes, err := remapJobs(jobs, backupManifest.Volumes, opts)
+					if err != nil {
+						logPrint("Preview failed: " + err.Error())
+						return
+					}
+					checker := backup.NewConflictChecker(client, opts.policy, opts.hash)
+					decisions, err := checker.Plan(jobs)
+					if err != nil {
+						logPrint("Preview failed: " + err.Error())
+						return
+					}
+					var report strings.Builder
+					if len(remapper.Rules) > 0 {
+						fmt.Fprintf(&report, "Path mapping (%d files moved):\n", len(changes))
+						for _, r := range remapper.Rules {
+							fmt.Fprintf(&report, "  %s\n", r)
 						}
-						restorePool.Close()
-					}()
-
-					// Collector - process results with optimized logging
-					success := 0
-					failures := 0
-					lastLoggedProgress := 0
-					logInterval := max(1, total/20) // Log every 5% or at least every file if < 20 files
-
-					for res := range restorePool.Results() {
-						if res.Error != nil {
-							// Always log failures
-							logPrint(fmt.Sprintf("✗ FAIL: %s - %s", filepath.Base(res.Job.LocalPath), res.Error.Error()))
-							failures++
-						} else {
-							success++
+						report.WriteString("\n")
+					}
+					for _, d := range decisions {
+						fmt.Fprintf(&report, "%-11s %s", d.Action, d.Target)
+						if d.Reason != "" {
+							fmt.Fprintf(&report, "  (%s)", d.Reason)
 						}
+						report.WriteString("\n")
+					}
+					summary := backup.SummarizeDecisions(decisions)
+					logPrint("Restore preview: " + summary)
+					fyne.Do(func() {
+						text := widget.NewMultiLineEntry()
+						text.SetText(report.String())
+						text.TextStyle = fyne.TextStyle{Monospace: true}
+						d := dialog.NewCustom("Restore Preview", "Close",
+							container.NewBorder(widget.NewLabel(summary), nil, nil, nil, text), w)
+						d.Resize(fyne.NewSize(800, 500))
+						d.Show()
+					})
+				})
+			}
+			showRestoreDialog(w, backupManifest, preview, func(entries []manifest.Entry, opts restoreOptions) {
+				if len(entries) == 0 {
+					logPrint("Nothing selected to restore.")
+					return
+				}
+				backgroundOp(func() {
+					jobs, err := restoreJobs(entries)
+					if err != nil {
+						logPrint("Restore failed: " + err.Error())
+						return
+					}
+					remapper, changes, err := remapJobs(jobs, backupManifest.Volumes, opts)
+					if err != nil {
+						logPrint("Restore failed: " + err.Error())
+						return
+					}
+					for _, r := range remapper.Rules {
+						logPrint("Path mapping: " + r.String())
+					}
+					if len(changes) > 0 {
+						logPrint(fmt.Sprintf("%d files will be restored to remapped paths", len(changes)))
+					}
+					logPrint(fmt.Sprintf("Restoring %d of %d files to original locations (%s)...", len(entries), len(backupManifest.Entries), opts.policy))
+					var verifier *backup.RestoreVerifier
+					if opts.verify {
+						verifier = backup.NewRestoreVerifier(client, opts.hash)
+					}
+					runRestore(jobs, backup.NewConflictChecker(client, opts.policy, opts.hash), verifier)
+				})
+			})
+		}
 
-						// Update progress bar always (lightweight)
-						processed := success + failures
-						progressBar.SetValue(float64(processed))
+		if remote {
+			restoreFrom(localPath, backupManifest) // Remote backups keep no snapshots
+			return
+		}
+		snapshots, err := snapshot.List(localPath)
+		if err != nil {
+			logPrint("Warning: cannot list snapshots: " + err.Error())
+		}
+		if len(snapshots) == 0 {
+			restoreFrom(localPath, backupManifest)
+			return
+		}
+		showSnapshotDialog(w, snapshots, func(name string) {
+			if name == "" {
+				restoreFrom(localPath, backupManifest)
+				return
+			}
+			_, m, err := snapshot.Load(localPath, name, repository.Sealer())
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			logPrint("Restoring from snapshot " + name)
+			restoreFrom(snapshot.Path(localPath, name), m)
+		})
+	})
 
-						// Log progress periodically to avoid UI slowdown
-						if processed-lastLoggedProgress >= logInterval || processed == total {
-							logPrint(fmt.Sprintf("Progress: %d/%d files restored...", processed, total))
-							lastLoggedProgress = processed
-						}
-					}
-					logPrint(fmt.Sprintf("Restore Complete. Success: %d, Failures: %d", success, failures))
-					progressBar.Hide()
+	// freeUpBtn deletes files from the phone that are safely in the backup,
+	// after listing them for confirmation
+	freeUpBtn := widget.NewButtonWithIcon("Free Up Space", theme.DeleteIcon(), func() {
+		if client == nil {
+			dialog.ShowError(fmt.Errorf("ADB not initialized"), w)
+			return
+		}
+		dest := destEntry.Text
+		var repository *repo.Repo
+		if !storage.IsRemote(dest) {
+			// Encrypted manifests are read and written with the repository key
+			r, err := unlockRepository(dest)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			repository = r
+		}
+		showFreeUpDialog(w, sourceEntry.Text, func(prefix string, policy backup.FreeUpPolicy) {
+			logPrint("Checking backed up files against the device...")
+			backgroundOp(func() {
+				st, err := storage.Open(dest)
+				if err != nil {
+					logPrint("Free Up Error: " + err.Error())
+					return
+				}
+				defer st.Close()
+				m, err := manifest.LoadFrom(st, repository.Sealer())
+				if err != nil {
+					logPrint("Free Up Error: cannot read manifest: " + err.Error())
+					return
+				}
+				now := time.Now()
+				// Objects of a repository are compared by its content IDs, other
+				// destinations by the SHA-256 of the stored file
+				copies := backup.CopyChecker(backup.StorageCopies{Storage: st, Device: client})
+				if repository != nil {
+					copies = repository.Copies(client)
+				}
+				items, err := backup.PlanFreeUp(client, copies, backup.FreeUpCandidates(m, prefix), policy, now)
+				if err != nil {
+					logPrint("Free Up Error: " + err.Error())
+					return
+				}
+				logPrint(backup.FreeUpSummary(items))
+				fyne.Do(func() {
+					showFreeUpPlan(w, items, func() {
+						backgroundOp(func() {
+							st, err := storage.Open(dest)
+							if err != nil {
+								logPrint("Free Up Error: " + err.Error())
+								return
+							}
+							defer st.Close()
+							// A backup may have saved the manifest while the list was confirmed
+							m, err := manifest.LoadFrom(st, repository.Sealer())
+							if err != nil {
+								logPrint("Free Up Error: cannot read manifest: " + err.Error())
+								return
+							}
+							deleted, freed, err := backup.FreeUp(client, m, st, repository.Sealer(), items, now, func(it backup.FreeUpItem, err error) {
+								if err != nil {
+									logPrint(fmt.Sprintf("FAIL: %s (%v)", it.Entry.OriginalPath, err))
+								}
+							})
+							logPrint(fmt.Sprintf("Freed %s on the device: deleted %d files, logged in the manifest", backup.FormatBytes(freed), deleted))
+							if err != nil {
+								logPrint("Free Up Error: " + err.Error())
+							}
+						})
+					})
 				})
-			}, w)
-		cnf2.Show()
+			})
+		})
 	})
 
 	actionsCard := widget.NewCard("Actions", "", container.NewGridWithColumns(4,
 		scanBtn, backupBtn, galleryBtn, restoreBtn,
+		appsBackupBtn, appsRestoreBtn, contentBtn, freeUpBtn,
+		retryBtn,
 	))
 
 	// -- LAYOUT ASSEMBLY --
@@ -357,6 +1434,7 @@ func main() {
 		configCard,
 		actionsCard,
 		progressBar,
+		progressLabel,
 		widget.NewSeparator(),
 		logAccordion,
 	)
@@ -376,6 +1454,7 @@ func main() {
 			logPrint("ADB Error: " + err.Error())
 			return
 		}
+		client.LowPriority.Store(lowPriorityCheck.Checked)
 		devices, err := client.Devices()
 		if err != nil {
 			statusLabel.SetText("ADB Error: " + err.Error())
@@ -384,7 +1463,12 @@ func main() {
 		if len(devices) > 0 {
 			statusLabel.SetText(fmt.Sprintf("Connected:\n%s\n%s", devices[0].Model, devices[0].Serial))
 			statusLabel.TextStyle = fyne.TextStyle{Bold: true}
+			if info, err := client.DeviceInfo(); err == nil {
+				showDevice(info, devices[0].Serial)
+			}
 			logPrint("Device connected: " + devices[0].Serial)
+			detectVolumes()
+			detectAccess()
 		} else {
 			statusLabel.SetText("No Device Connected.\nCheck USB Cable.")
 			logPrint("Waiting for device...")
@@ -396,6 +1480,11 @@ func main() {
 		if client != nil {
 			client.KillServer()
 		}
+		viewsMu.Lock()
+		for _, dir := range views {
+			os.RemoveAll(dir)
+		}
+		viewsMu.Unlock()
 	})
 
 	w.ShowAndRun()
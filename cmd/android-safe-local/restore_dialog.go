@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/snapshot"
+)
+
+// restoreOptions are the conflict and path mapping settings chosen in the restore dialog
+type restoreOptions struct {
+	policy  backup.ConflictPolicy
+	hash    bool
+	mapping string // User path mapping rules, see backup.ParseRemapRules
+	verify  bool   // Check the pushed files on the device afterwards
+}
+
+// showRestoreDialog lets the user pick which manifest entries to restore:
+// a folder from the browsable tree plus optional date range, type and glob,
+// what to do with files that already exist on the device, and where paths
+// should land when the target device is laid out differently
+func showRestoreDialog(w fyne.Window, m *manifest.Manifest, onPreview, onRestore func(entries []manifest.Entry, opts restoreOptions)) {
+	folders := m.Folders()
+	var query manifest.Query
+	var selected []manifest.Entry
+
+	folderLabel := widget.NewLabel("Folder: (all)")
+	summaryLabel := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	errorLabel := widget.NewLabel("")
+
+	fromEntry := widget.NewEntry()
+	fromEntry.SetPlaceHolder("From: YYYY-MM or YYYY-MM-DD")
+	toEntry := widget.NewEntry()
+	toEntry.SetPlaceHolder("To: YYYY-MM or YYYY-MM-DD")
+	globEntry := widget.NewEntry()
+	globEntry.SetPlaceHolder("Name pattern, e.g. IMG_*.jpg")
+
+	typeOptions := []string{"Any type"}
+	for _, t := range manifest.MediaTypes {
+		typeOptions = append(typeOptions, string(t))
+	}
+	typeSelect := widget.NewSelect(typeOptions, nil)
+	typeSelect.SetSelectedIndex(0)
+	deletedCheck := widget.NewCheck("Only files freed up from the device", nil)
+	if len(m.Deletions) == 0 {
+		deletedCheck.Disable()
+	}
+
+	var policyOptions []string
+	for _, p := range backup.ConflictPolicies {
+		policyOptions = append(policyOptions, p.String())
+	}
+	opts := restoreOptions{policy: backup.ConflictPolicies[0]}
+	policySelect := widget.NewSelect(policyOptions, func(s string) {
+		opts.policy, _ = backup.ParseConflictPolicy(s)
+	})
+	policySelect.SetSelectedIndex(0)
+	hashCheck := widget.NewCheck("Compare content (SHA-256, slower)", func(on bool) {
+		opts.hash = on
+	})
+	verifyCheck := widget.NewCheck("Verify files on the device after restore", func(on bool) {
+		opts.verify = on
+	})
+	mappingEntry := widget.NewMultiLineEntry()
+	mappingEntry.SetPlaceHolder("Path mapping, one per line: /storage/ABCD-1234=/storage/9999-0000\nSD card and user changes are detected automatically")
+	mappingEntry.SetMinRowsVisible(2)
+	mappingEntry.OnChanged = func(s string) {
+		opts.mapping = s
+	}
+	previewBtn := widget.NewButton("Preview Changes", func() {
+		onPreview(selected, opts)
+	})
+
+	refresh := func() {
+		selected = nil
+		summaryLabel.SetText("")
+		from, to, err := manifest.ParseDateRange(fromEntry.Text, toEntry.Text)
+		if err != nil {
+			errorLabel.SetText(err.Error())
+			return
+		}
+		errorLabel.SetText("")
+		query.From, query.To = from, to
+		query.Glob = globEntry.Text
+		query.Deleted = deletedCheck.Checked
+		query.MediaType = manifest.MediaAny
+		if typeSelect.SelectedIndex() > 0 {
+			query.MediaType = manifest.MediaType(typeSelect.Selected)
+		}
+		if _, err := path.Match(query.Glob, ""); err != nil {
+			errorLabel.SetText("Bad pattern: " + err.Error())
+			return
+		}
+
+		selected = m.Select(query)
+		var size int64
+		for _, e := range selected {
+			size += e.Size
+		}
+		summaryLabel.SetText(fmt.Sprintf("%d of %d files selected (%s)", len(selected), len(m.Entries), backup.FormatBytes(size)))
+	}
+
+	tree := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID { return folders[id] },
+		func(id widget.TreeNodeID) bool { return id == "" || len(folders[id]) > 0 },
+		func(branch bool) fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(path.Base(id))
+		},
+	)
+	tree.OnSelected = func(id widget.TreeNodeID) {
+		query.PathPrefix = id
+		folderLabel.SetText("Folder: " + id)
+		refresh()
+	}
+	tree.OnUnselected = func(id widget.TreeNodeID) {
+		query.PathPrefix = ""
+		folderLabel.SetText("Folder: (all)")
+		refresh()
+	}
+	for _, top := range folders[""] {
+		tree.OpenBranch(top)
+	}
+
+	fromEntry.OnChanged = func(string) { refresh() }
+	toEntry.OnChanged = func(string) { refresh() }
+	globEntry.OnChanged = func(string) { refresh() }
+	typeSelect.OnChanged = func(string) { refresh() }
+	deletedCheck.OnChanged = func(bool) { refresh() }
+	refresh()
+
+	filters := container.NewVBox(
+		folderLabel,
+		container.NewGridWithColumns(2, fromEntry, toEntry),
+		container.NewGridWithColumns(2, typeSelect, globEntry),
+		deletedCheck,
+		errorLabel,
+		summaryLabel,
+		widget.NewLabelWithStyle("If the file exists on the device", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		container.NewGridWithColumns(2, policySelect, hashCheck),
+		mappingEntry,
+		verifyCheck,
+		previewBtn,
+	)
+	content := container.NewBorder(nil, filters, nil, nil, container.NewScroll(tree))
+
+	d := dialog.NewCustomConfirm("Restore to Original Locations", "Restore Selected", "Cancel", content, func(confirmed bool) {
+		if confirmed {
+			onRestore(selected, opts)
+		}
+	}, w)
+	d.Resize(fyne.NewSize(700, 600))
+	d.Show()
+}
+
+// showSnapshotDialog asks which state of the backup to restore from: the latest
+// files (name "") or one of its snapshots, newest first
+func showSnapshotDialog(w fyne.Window, snapshots []snapshot.Info, onChosen func(name string)) {
+	options := []string{"Latest backup (all files)"}
+	names := []string{""}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		label := fmt.Sprintf("%s  %d files, %s", s.Name, s.Files, backup.FormatBytes(s.Bytes))
+		if s.Source != "" {
+			label += "  " + s.Source
+		}
+		options = append(options, label)
+		names = append(names, s.Name)
+	}
+	list := widget.NewRadioGroup(options, nil)
+	list.SetSelected(options[0])
+	list.Required = true
+
+	d := dialog.NewCustomConfirm("Restore From", "Next", "Cancel", container.NewVScroll(list), func(ok bool) {
+		if ok {
+			onChosen(names[slices.Index(options, list.Selected)])
+		}
+	}, w)
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"AndroidSafeLocal/internal/adb"
+	device_pkg "AndroidSafeLocal/internal/device"
+)
+
+// showScanWarnings sums up what a scan skipped by kind, with every warning
+// in a details list
+func showScanWarnings(w fyne.Window, warnings []device_pkg.Warning, access adb.Access) {
+	counts := device_pkg.CountWarnings(warnings)
+	summary := container.NewVBox()
+	for _, k := range device_pkg.WarningKinds {
+		if counts[k] > 0 {
+			summary.Add(widget.NewLabel(fmt.Sprintf("%d × %s", counts[k], k)))
+		}
+	}
+	if counts[device_pkg.WarnPermissionDenied] > 0 && access.Mode == adb.AccessAsShell {
+		hint := widget.NewLabel("Folders that were not readable as the shell user may be readable with root or run-as, see Access.")
+		hint.Wrapping = fyne.TextWrapWord
+		summary.Add(hint)
+	}
+
+	details := widget.NewList(
+		func() int { return len(warnings) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(warnings[id].String())
+		},
+	)
+	detailsItem := widget.NewAccordionItem(fmt.Sprintf("Details (%d)", len(warnings)), container.NewGridWrap(fyne.NewSize(640, 280), details))
+	content := container.NewVBox(summary, widget.NewAccordion(detailsItem))
+
+	d := dialog.NewCustom("Scan Warnings", "Close", container.NewVScroll(content), w)
+	d.Resize(fyne.NewSize(700, 480))
+	d.Show()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+// showWirelessDialog pairs, discovers and connects devices over Wi-Fi. Known
+// devices are saved on every successful connection; onConnected runs after one.
+func showWirelessDialog(w fyne.Window, client *adb.Client, known *adb.KnownDevices, onConnected func(d adb.WirelessDevice)) {
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+
+	// A device to connect to, from the known list or from discovery
+	var chosen *adb.WirelessDevice
+	var found []adb.Service
+
+	knownList := widget.NewList(
+		func() int { return len(known.Devices) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			d := known.Devices[id]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s, last seen %s", d, d.LastSeen.Format("2006-01-02 15:04")))
+		},
+	)
+	foundList := widget.NewList(
+		func() int { return len(found) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(found[id].Instance + "  " + found[id].Addr)
+		},
+	)
+	knownList.OnSelected = func(id widget.ListItemID) {
+		d := known.Devices[id]
+		chosen = &d
+		foundList.UnselectAll()
+	}
+	foundList.OnSelected = func(id widget.ListItemID) {
+		chosen = &adb.WirelessDevice{Name: found[id].Instance, Address: found[id].Addr}
+		if d, ok := known.Find(found[id].Addr, found[id].Instance); ok {
+			chosen.Model = d.Model
+		}
+		knownList.UnselectAll()
+	}
+
+	var connectBtn, discoverBtn, pairBtn *widget.Button
+	connectBtn = widget.NewButton("Connect", func() {
+		if chosen == nil {
+			statusLabel.SetText("Select a known or discovered device first.")
+			return
+		}
+		d := *chosen
+		statusLabel.SetText("Connecting to " + d.String() + "...")
+		connectBtn.Disable()
+		go func() {
+			defer fyne.Do(connectBtn.Enable)
+			if err := client.ConnectDevice(&d); err != nil {
+				fyne.Do(func() { statusLabel.SetText(err.Error()) })
+				return
+			}
+			if info, err := client.DeviceInfo(); err == nil {
+				d.Model = info.Name()
+			}
+			fyne.Do(func() {
+				d.LastSeen = time.Time{}
+				known.Remember(d)
+				if err := known.Save(); err != nil {
+					statusLabel.SetText("Connected, but the device list was not saved: " + err.Error())
+				} else {
+					statusLabel.SetText("Connected to " + d.String())
+				}
+				knownList.UnselectAll()
+				knownList.Refresh()
+				chosen = nil
+				onConnected(d)
+			})
+		}()
+	})
+	forgetBtn := widget.NewButton("Forget", func() {
+		if chosen == nil {
+			return
+		}
+		if _, ok := known.Find(chosen.Address, ""); !ok {
+			statusLabel.SetText("Only known devices can be forgotten.")
+			return
+		}
+		known.Forget(chosen.Address)
+		if err := known.Save(); err != nil {
+			statusLabel.SetText(err.Error())
+		}
+		chosen = nil
+		knownList.UnselectAll()
+		knownList.Refresh()
+	})
+	discoverBtn = widget.NewButton("Discover", func() {
+		statusLabel.SetText("Looking for devices with Wireless debugging on...")
+		discoverBtn.Disable()
+		go func() {
+			services, err := client.DiscoverWireless(3 * time.Second)
+			fyne.Do(func() {
+				discoverBtn.Enable()
+				if err != nil {
+					statusLabel.SetText("Discovery failed: " + err.Error())
+					return
+				}
+				found = services
+				foundList.UnselectAll()
+				foundList.Refresh()
+				statusLabel.SetText(fmt.Sprintf("Found %d device(s).", len(found)))
+			})
+		}()
+	})
+
+	pairAddrEntry := widget.NewEntry()
+	pairAddrEntry.SetPlaceHolder("IP address & port, e.g. 192.168.1.23:41234")
+	pairCodeEntry := widget.NewEntry()
+	pairCodeEntry.SetPlaceHolder("Wi-Fi pairing code")
+	pairBtn = widget.NewButton("Pair", func() {
+		addr, code := strings.TrimSpace(pairAddrEntry.Text), strings.TrimSpace(pairCodeEntry.Text)
+		if addr == "" || code == "" {
+			statusLabel.SetText("Enter the address and code shown under \"Pair device with pairing code\".")
+			return
+		}
+		statusLabel.SetText("Pairing with " + addr + "...")
+		pairBtn.Disable()
+		go func() {
+			err := client.Pair(addr, code)
+			fyne.Do(func() {
+				pairBtn.Enable()
+				if err != nil {
+					statusLabel.SetText(err.Error())
+					return
+				}
+				pairCodeEntry.SetText("")
+				statusLabel.SetText("Paired. Discover the device or connect with the address on the Wireless debugging screen.")
+			})
+		}()
+	})
+
+	knownScroll := container.NewVScroll(knownList)
+	knownScroll.SetMinSize(fyne.NewSize(0, 120))
+	foundScroll := container.NewVScroll(foundList)
+	foundScroll.SetMinSize(fyne.NewSize(0, 90))
+	content := container.NewVBox(
+		widget.NewLabelWithStyle("Known Devices", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		knownScroll,
+		container.NewBorder(nil, nil, widget.NewLabelWithStyle("On This Network", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), discoverBtn),
+		foundScroll,
+		container.NewGridWithColumns(2, connectBtn, forgetBtn),
+		widget.NewSeparator(),
+		widget.NewLabelWithStyle("Pair New Device (Android 11+, Developer options > Wireless debugging)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		container.NewBorder(nil, nil, nil, pairBtn, container.NewGridWithColumns(2, pairAddrEntry, pairCodeEntry)),
+		statusLabel,
+	)
+	d := dialog.NewCustom("Wireless Devices", "Close", content, w)
+	d.Resize(fyne.NewSize(600, 560))
+	d.Show()
+}
@@ -0,0 +1,334 @@
+package ab
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Magic is the first line of every Android backup
+const Magic = "ANDROID BACKUP"
+
+// Version is the format version written by NewWriter, the one of Android 8 and later
+const Version = 5
+
+// encryption names in the header
+const (
+	encryptionNone = "none"
+	encryptionAES  = "AES-256"
+)
+
+// defaultRounds matches what Android uses for new backups
+const defaultRounds = 10000
+
+var (
+	// ErrNotBackup is returned when the data doesn't start with an Android backup header
+	ErrNotBackup = errors.New("not an Android backup (.ab) file")
+
+	// ErrPasswordRequired is returned for an encrypted backup opened without password
+	ErrPasswordRequired = errors.New("the backup is encrypted, a password is required")
+
+	// ErrWrongPassword is returned when the password does not open the backup
+	ErrWrongPassword = errors.New("wrong backup password")
+)
+
+// Header is the plain text start of a .ab file
+type Header struct {
+	Version    int
+	Compressed bool
+	Encryption string // "none" or "AES-256"
+
+	// AES-256 only: the master key is encrypted with a key derived from the password
+	UserSalt      []byte
+	ChecksumSalt  []byte
+	Rounds        int
+	UserIV        []byte
+	MasterKeyBlob []byte
+}
+
+// Encrypted reports whether the backup needs a password
+func (h Header) Encrypted() bool {
+	return h.Encryption != encryptionNone
+}
+
+// Reader decodes a .ab file to the tar stream inside it
+type Reader struct {
+	Header Header
+	r      io.Reader
+	zr     io.ReadCloser // nil for uncompressed backups
+}
+
+// NewReader reads the header and, for an encrypted backup, unlocks it with
+// password. Reading from the Reader gives the plain tar stream.
+func NewReader(r io.Reader, password string) (*Reader, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	ar := &Reader{Header: h, r: br}
+	if h.Encrypted() {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		key, iv, err := h.masterKey(password)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		ar.r = &cbcReader{mode: cipher.NewCBCDecrypter(block, iv), r: br}
+	}
+	if h.Compressed {
+		// Android's Deflater writes a zlib stream
+		zr, err := zlib.NewReader(ar.r)
+		if err != nil {
+			if h.Encrypted() {
+				return nil, fmt.Errorf("%w (or corrupt data: %v)", ErrWrongPassword, err)
+			}
+			return nil, fmt.Errorf("corrupt backup data: %w", err)
+		}
+		ar.zr, ar.r = zr, zr
+	}
+	return ar, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Close releases the decompressor; it does not close the underlying reader
+func (r *Reader) Close() error {
+	if r.zr != nil {
+		return r.zr.Close()
+	}
+	return nil
+}
+
+func readHeader(br *bufio.Reader) (Header, error) {
+	readLine := func() (string, error) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", ErrNotBackup
+		}
+		return strings.TrimRight(line, "\n"), nil
+	}
+
+	var h Header
+	magic, err := readLine()
+	if err != nil || magic != Magic {
+		return h, ErrNotBackup
+	}
+	version, err := readLine()
+	if err != nil {
+		return h, err
+	}
+	if h.Version, err = strconv.Atoi(version); err != nil || h.Version < 1 || h.Version > Version {
+		return h, fmt.Errorf("unsupported Android backup version %q", version)
+	}
+	compressed, err := readLine()
+	if err != nil {
+		return h, err
+	}
+	h.Compressed = compressed == "1"
+	if h.Encryption, err = readLine(); err != nil {
+		return h, err
+	}
+	switch h.Encryption {
+	case encryptionNone:
+		return h, nil
+	case encryptionAES:
+	default:
+		return h, fmt.Errorf("unsupported backup encryption %q", h.Encryption)
+	}
+
+	hexFields := []*[]byte{&h.UserSalt, &h.ChecksumSalt, nil, &h.UserIV, &h.MasterKeyBlob}
+	for i, field := range hexFields {
+		line, err := readLine()
+		if err != nil {
+			return h, err
+		}
+		if field == nil {
+			if h.Rounds, err = strconv.Atoi(line); err != nil || h.Rounds <= 0 {
+				return h, fmt.Errorf("invalid key derivation rounds %q", line)
+			}
+			continue
+		}
+		if *field, err = hex.DecodeString(line); err != nil {
+			return h, fmt.Errorf("invalid encryption header line %d: %w", i+5, err)
+		}
+	}
+	return h, nil
+}
+
+func (h Header) write(w io.Writer) error {
+	compressed := "0"
+	if h.Compressed {
+		compressed = "1"
+	}
+	lines := []string{Magic, strconv.Itoa(h.Version), compressed, h.Encryption}
+	if h.Encrypted() {
+		lines = append(lines,
+			strings.ToUpper(hex.EncodeToString(h.UserSalt)),
+			strings.ToUpper(hex.EncodeToString(h.ChecksumSalt)),
+			strconv.Itoa(h.Rounds),
+			strings.ToUpper(hex.EncodeToString(h.UserIV)),
+			strings.ToUpper(hex.EncodeToString(h.MasterKeyBlob)))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// masterKey decrypts the master key blob with the password and checks it
+// against the stored checksum
+func (h Header) masterKey(password string) (key, iv []byte, err error) {
+	userKey := pbkdf2.Key(passwordBytes(h.Version, password), h.UserSalt, h.Rounds, 32, sha1.New)
+	blob, err := decryptCBC(userKey, h.UserIV, h.MasterKeyBlob)
+	if err != nil {
+		return nil, nil, ErrWrongPassword
+	}
+	// The blob holds three length-prefixed fields: IV, key and checksum
+	var fields [][]byte
+	for len(fields) < 3 {
+		if len(blob) == 0 || int(blob[0]) > len(blob)-1 {
+			return nil, nil, ErrWrongPassword
+		}
+		n := int(blob[0])
+		fields = append(fields, blob[1:1+n])
+		blob = blob[1+n:]
+	}
+	iv, key, checksum := fields[0], fields[1], fields[2]
+	if len(key) != 32 || len(iv) != aes.BlockSize {
+		return nil, nil, ErrWrongPassword
+	}
+	for _, candidate := range checksumPasswords(h.Version, key) {
+		if subtle.ConstantTimeCompare(pbkdf2.Key(candidate, h.ChecksumSalt, h.Rounds, 32, sha1.New), checksum) == 1 {
+			return key, iv, nil
+		}
+	}
+	return nil, nil, ErrWrongPassword
+}
+
+// passwordBytes encodes the password the way Java's PBKDF2 does: version 1
+// backups used PBKDF2WithHmacSHA1And8bit (the low byte of each UTF-16 unit),
+// later ones UTF-8
+func passwordBytes(version int, password string) []byte {
+	if version >= 2 {
+		return []byte(password)
+	}
+	units := utf16.Encode([]rune(password))
+	b := make([]byte, len(units))
+	for i, u := range units {
+		b[i] = byte(u)
+	}
+	return b
+}
+
+// checksumPasswords returns the master key as password for the checksum.
+// Android turns each signed byte into a Java char, so bytes from 0x80 become
+// U+FF80 to U+FFFF before the UTF-8 encoding. Some builds wrote the 8-bit
+// form even in version 2+ backups, so both are tried.
+func checksumPasswords(version int, key []byte) [][]byte {
+	if version < 2 {
+		return [][]byte{key}
+	}
+	mangled := make([]byte, 0, 3*len(key))
+	for _, b := range key {
+		if b < 0x80 {
+			mangled = append(mangled, b)
+		} else {
+			mangled = utf8.AppendRune(mangled, rune(0xFF00|uint16(b)))
+		}
+	}
+	return [][]byte{mangled, key}
+}
+
+// Writer encodes a tar stream as a compressed .ab file
+type Writer struct {
+	zw *zlib.Writer
+	cw *cbcWriter // nil without password
+}
+
+// NewWriter writes the header of a version 5, compressed backup to w. With a
+// password the backup is encrypted the way adb backup does it. Close must be
+// called to flush the end of the data.
+func NewWriter(w io.Writer, password string) (*Writer, error) {
+	h := Header{Version: Version, Compressed: true, Encryption: encryptionNone}
+	aw := &Writer{}
+	out := w
+	if password != "" {
+		h.Encryption = encryptionAES
+		h.Rounds = defaultRounds
+		key, iv, err := h.newMasterKey(password)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aw.cw = &cbcWriter{mode: cipher.NewCBCEncrypter(block, iv), w: w}
+		out = aw.cw
+	}
+	if err := h.write(w); err != nil {
+		return nil, err
+	}
+	aw.zw = zlib.NewWriter(out)
+	return aw, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.zw.Write(p)
+}
+
+// Close flushes the compressed data and the padded last cipher block. The
+// underlying writer is not closed.
+func (w *Writer) Close() error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
+
+// newMasterKey fills in the encryption fields of h with a random master key
+// wrapped with password, and returns the key and IV the data is encrypted with
+func (h *Header) newMasterKey(password string) (key, iv []byte, err error) {
+	h.UserSalt = make([]byte, 64)
+	h.ChecksumSalt = make([]byte, 64)
+	h.UserIV = make([]byte, aes.BlockSize)
+	key = make([]byte, 32)
+	iv = make([]byte, aes.BlockSize)
+	for _, b := range [][]byte{h.UserSalt, h.ChecksumSalt, h.UserIV, key, iv} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	checksum := pbkdf2.Key(checksumPasswords(h.Version, key)[0], h.ChecksumSalt, h.Rounds, 32, sha1.New)
+	var blob []byte
+	for _, field := range [][]byte{iv, key, checksum} {
+		blob = append(blob, byte(len(field)))
+		blob = append(blob, field...)
+	}
+	userKey := pbkdf2.Key(passwordBytes(h.Version, password), h.UserSalt, h.Rounds, 32, sha1.New)
+	h.MasterKeyBlob, err = encryptCBC(userKey, h.UserIV, blob)
+	return key, iv, err
+}
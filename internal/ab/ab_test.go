@@ -0,0 +1,107 @@
+package ab
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures were made with Python's tarfile, zlib and hashlib and openssl
+// enc, not with this package. notes.tar is the tar stream inside both; the
+// master key of encrypted.ab has bytes above 0x7f to cover the Java checksum
+// encoding. Its password is "correct horse".
+const fixturePassword = "correct horse"
+
+func TestReadFixtures(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "notes.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file     string
+		password string
+		err      error
+	}{
+		{"plain.ab", "", nil},
+		{"plain.ab", "ignored", nil},
+		{"encrypted.ab", fixturePassword, nil},
+		{"encrypted.ab", "", ErrPasswordRequired},
+		{"encrypted.ab", "battery staple", ErrWrongPassword},
+		{"notes.tar", "", ErrNotBackup},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		h, err := ToTar(&out, bytes.NewReader(data), tt.password)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s with %q: expected %v, got %v", tt.file, tt.password, tt.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if h.Version != 5 || !h.Compressed || h.Encrypted() != (tt.file == "encrypted.ab") {
+			t.Errorf("%s: header %+v", tt.file, h)
+		}
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%s: tar stream differs from notes.tar", tt.file)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "encrypted.ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, entries, err := List(f, fixturePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Package: "org.example.notes", Domain: "_manifest"},
+		{Package: "org.example.notes", Domain: "db", Path: "notes.db", Size: 116},
+		{Package: "org.example.notes", Domain: "sp", Path: "settings.xml"},
+		{Domain: "shared", Path: "0/Download/hello.txt", Size: 21},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Got %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Package != w.Package || e.Domain != w.Domain || e.Path != w.Path || (w.Size != 0 && e.Size != w.Size) {
+			t.Errorf("Entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestFromTarRoundTrip(t *testing.T) {
+	tarData, err := os.ReadFile(filepath.Join("testdata", "notes.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"", "new password"} {
+		var packed bytes.Buffer
+		files, err := FromTar(&packed, bytes.NewReader(tarData), password)
+		if err != nil || files != 4 {
+			t.Fatalf("FromTar with %q: %d files, %v", password, files, err)
+		}
+		if bytes.Contains(packed.Bytes(), []byte("hello from the phone")) {
+			t.Errorf("FromTar with %q: file content not compressed", password)
+		}
+		var out bytes.Buffer
+		if _, err := ToTar(&out, bytes.NewReader(packed.Bytes()), password); err != nil || !bytes.Equal(out.Bytes(), tarData) {
+			t.Errorf("Round trip with %q failed (%v)", password, err)
+		}
+	}
+
+	if _, err := FromTar(&bytes.Buffer{}, bytes.NewReader(tarData[:1300]), ""); err == nil {
+		t.Error("FromTar accepted a truncated tar")
+	}
+}
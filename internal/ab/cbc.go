@@ -0,0 +1,135 @@
+package ab
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// errPadding means the last block did not decrypt to valid PKCS#5 padding,
+// which is what a wrong key looks like
+var errPadding = errors.New("invalid padding")
+
+func encryptCBC(key, iv, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pad(plain)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data, nil
+}
+
+func decryptCBC(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errPadding
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	return unpad(plain)
+}
+
+func pad(plain []byte) []byte {
+	n := aes.BlockSize - len(plain)%aes.BlockSize
+	return append(bytes.Clone(plain), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func unpad(plain []byte) ([]byte, error) {
+	if len(plain) == 0 {
+		return nil, errPadding
+	}
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > aes.BlockSize || n > len(plain) {
+		return nil, errPadding
+	}
+	for _, b := range plain[len(plain)-n:] {
+		if int(b) != n {
+			return nil, errPadding
+		}
+	}
+	return plain[:len(plain)-n], nil
+}
+
+// cbcReader decrypts a stream, holding back the last block until EOF so the
+// padding can be removed
+type cbcReader struct {
+	mode cipher.BlockMode
+	r    io.Reader
+	buf  []byte // Decrypted, not yet returned
+	last []byte // Decrypted last block seen, may hold the padding
+	eof  bool
+}
+
+func (c *cbcReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, 32*1024)
+		n, err := io.ReadFull(c.r, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		if n%aes.BlockSize != 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		chunk = chunk[:n]
+		c.mode.CryptBlocks(chunk, chunk)
+		data := append(c.last, chunk...)
+		if c.eof {
+			plain, err := unpad(data)
+			if err != nil {
+				return 0, err
+			}
+			c.buf, c.last = plain, nil
+			continue
+		}
+		if len(data) < aes.BlockSize {
+			c.last = data
+			continue
+		}
+		cut := len(data) - aes.BlockSize
+		c.buf, c.last = data[:cut], bytes.Clone(data[cut:])
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// cbcWriter encrypts a stream, padding the last block on Close
+type cbcWriter struct {
+	mode    cipher.BlockMode
+	w       io.Writer
+	pending []byte // Less than one block
+}
+
+func (c *cbcWriter) Write(p []byte) (int, error) {
+	data := append(c.pending, p...)
+	full := len(data) - len(data)%aes.BlockSize
+	if full > 0 {
+		out := make([]byte, full)
+		c.mode.CryptBlocks(out, data[:full])
+		if _, err := c.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	c.pending = bytes.Clone(data[full:])
+	return len(p), nil
+}
+
+// Close writes the padded last block
+func (c *cbcWriter) Close() error {
+	last := pad(c.pending)
+	c.mode.CryptBlocks(last, last)
+	c.pending = nil
+	_, err := c.w.Write(last)
+	return err
+}
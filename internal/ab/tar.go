@@ -0,0 +1,132 @@
+package ab
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Domains names the folder tokens adb backup uses below apps/<package>/
+var Domains = map[string]string{
+	"_manifest": "manifest",
+	"a":         "APK",
+	"obb":       "OBB expansion files",
+	"r":         "app data root",
+	"f":         "files",
+	"db":        "databases",
+	"sp":        "shared_prefs",
+	"c":         "cache",
+	"nb":        "no_backup",
+	"ef":        "external files",
+	"k":         "key/value data",
+	"d_r":       "device protected root",
+	"d_f":       "device protected files",
+	"d_db":      "device protected databases",
+	"d_sp":      "device protected shared_prefs",
+	"shared":    "shared storage",
+}
+
+// Entry is one member of the tar stream in a backup
+type Entry struct {
+	Name    string // Tar name, e.g. apps/org.example.notes/db/notes.db
+	Package string // Empty for shared storage
+	Domain  string // Key of Domains
+	Path    string // Inside the domain
+	Size    int64
+	Mode    int64
+	ModTime time.Time
+	Dir     bool
+}
+
+// ParseName splits a tar name into package, domain and path:
+// apps/<package>/<domain>/<path> or shared/<user>/<path>
+func ParseName(name string) (pkg, domain, path string) {
+	parts := strings.SplitN(strings.TrimSuffix(name, "/"), "/", 4)
+	switch {
+	case parts[0] == "shared":
+		return "", "shared", strings.Join(parts[1:], "/")
+	case parts[0] == "apps" && len(parts) >= 3:
+		if len(parts) == 4 {
+			path = parts[3]
+		}
+		return parts[1], parts[2], path
+	}
+	return "", "", name
+}
+
+// List reads the members of a backup without extracting them
+func List(r io.Reader, password string) (Header, []Entry, error) {
+	ar, err := NewReader(r, password)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer ar.Close()
+	var entries []Entry
+	err = walk(ar, func(hdr *tar.Header) {
+		pkg, domain, path := ParseName(hdr.Name)
+		entries = append(entries, Entry{
+			Name:    hdr.Name,
+			Package: pkg,
+			Domain:  domain,
+			Path:    path,
+			Size:    hdr.Size,
+			Mode:    hdr.Mode,
+			ModTime: hdr.ModTime,
+			Dir:     hdr.Typeflag == tar.TypeDir,
+		})
+	})
+	return ar.Header, entries, err
+}
+
+// ToTar writes the tar stream of a backup to w unchanged, so it can be
+// stored, inspected with any tar tool and turned back with FromTar
+func ToTar(w io.Writer, r io.Reader, password string) (Header, error) {
+	ar, err := NewReader(r, password)
+	if err != nil {
+		return Header{}, err
+	}
+	defer ar.Close()
+	if _, err := io.Copy(w, ar); err != nil {
+		return ar.Header, fmt.Errorf("backup data: %w", err)
+	}
+	return ar.Header, nil
+}
+
+// FromTar packs a tar stream into a .ab file that adb restore accepts,
+// encrypted if password is set. The tar is checked while it is copied;
+// adb restore expects each app's _manifest before its other files.
+func FromTar(w io.Writer, r io.Reader, password string) (int, error) {
+	aw, err := NewWriter(w, password)
+	if err != nil {
+		return 0, err
+	}
+	files := 0
+	if err := walk(io.TeeReader(r, aw), func(*tar.Header) { files++ }); err != nil {
+		return files, err
+	}
+	// Whatever follows the end-of-archive blocks is kept as well
+	if _, err := io.Copy(aw, r); err != nil {
+		return files, err
+	}
+	return files, aw.Close()
+}
+
+// walk calls fn for every member of a tar stream, reading it to the end
+func walk(r io.Reader, fn func(*tar.Header)) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar data: %w", err)
+		}
+		fn(hdr)
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+}
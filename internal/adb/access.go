@@ -0,0 +1,120 @@
+package adb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AccessMode selects the user device files are read as
+type AccessMode int
+
+const (
+	AccessAsShell AccessMode = iota // The adb shell user: shared storage only
+	AccessAsRoot                    // su -c, on rooted devices
+	AccessAsApp                     // run-as <package>, the private folders of a debuggable app
+)
+
+// Access is an access mode with the package for AccessAsApp. The zero value
+// is the plain shell.
+type Access struct {
+	Mode    AccessMode
+	Package string
+}
+
+// ParseAccess reads "shell", "root" or "run-as:<package>"; empty is the shell
+func ParseAccess(s string) (Access, error) {
+	switch s = strings.TrimSpace(s); {
+	case s == "" || s == "shell":
+		return Access{}, nil
+	case s == "root":
+		return Access{Mode: AccessAsRoot}, nil
+	case strings.HasPrefix(s, "run-as:") && len(s) > len("run-as:"):
+		return Access{Mode: AccessAsApp, Package: strings.TrimPrefix(s, "run-as:")}, nil
+	}
+	return Access{}, fmt.Errorf("unknown access mode %q, use shell, root or run-as:<package>", s)
+}
+
+func (a Access) String() string {
+	switch a.Mode {
+	case AccessAsRoot:
+		return "root"
+	case AccessAsApp:
+		return "run-as:" + a.Package
+	}
+	return "shell"
+}
+
+// wrap turns a device command line into one that runs with this access
+func (a Access) wrap(cmd string) string {
+	switch a.Mode {
+	case AccessAsRoot:
+		return "su -c " + QuoteArgs(cmd)
+	case AccessAsApp:
+		return "run-as " + QuoteArgs(a.Package) + " sh -c " + QuoteArgs(cmd)
+	}
+	return cmd
+}
+
+// AccessShell runs a device command like Shell, but with the client's Access
+func (c *Client) AccessShell(args ...string) (string, error) {
+	return c.RunCommand("shell", c.Access.wrap(c.priority()+QuoteArgs(args...)))
+}
+
+// AccessPull copies a device file to a local path with the client's Access.
+// adb pull reads as the shell user, so root and run-as stream the file
+// through cat instead. exec-out passes on neither the exit status nor a
+// separate stderr, so a refused su or a failing cat would arrive as the file
+// content: the size is read with stat first and what arrived must match it.
+func (c *Client) AccessPull(remotePath, localPath string) error {
+	if c.Access.Mode == AccessAsShell {
+		_, err := c.RunCommand("pull", remotePath, localPath)
+		return err
+	}
+	out, err := c.AccessShell("stat", "-c", "%s", remotePath)
+	if err != nil {
+		return err
+	}
+	want, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot stat %s as %s: %s", remotePath, c.Access, out)
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	err = c.RunCommandTo(f, "exec-out", c.Access.wrap("cat "+QuoteArgs(remotePath)+" 2>/dev/null"))
+	var got int64
+	if info, serr := f.Stat(); serr == nil {
+		got = info.Size()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && got != want {
+		err = fmt.Errorf("read %d of %d bytes of %s as %s", got, want, remotePath, c.Access)
+	}
+	if err != nil {
+		os.Remove(localPath)
+	}
+	return err
+}
+
+// AccessModes lists the modes the device offers: always the shell, root when
+// su grants uid 0, and run-as for each debuggable user-installed app
+func (c *Client) AccessModes() ([]Access, error) {
+	modes := []Access{{}}
+	if out, err := c.RunCommand("shell", "su -c id"); err == nil && strings.Contains(out, "uid=0") {
+		modes = append(modes, Access{Mode: AccessAsRoot})
+	}
+	// One round trip: run-as refuses apps that are not debuggable
+	out, err := c.RunCommand("shell", `for p in $(pm list packages -3); do p=${p#package:}; run-as "$p" true 2>/dev/null && echo "$p"; done`)
+	if err != nil {
+		return modes, err
+	}
+	for _, pkg := range strings.Fields(out) {
+		modes = append(modes, Access{Mode: AccessAsApp, Package: pkg})
+	}
+	return modes, nil
+}
@@ -3,14 +3,30 @@ package adb
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
 // Client wraps the adb executable commands
 type Client struct {
 	Path string
+
+	// LowPriority runs device-side shell commands under nice (and ionice when the
+	// device has it) so scans and hashing don't make the phone sluggish.
+	// Transfers themselves are served by adbd and are not affected. Atomic, as
+	// the UI switches it while scans read it.
+	LowPriority atomic.Bool
+
+	// Access is how files are listed and pulled: as the shell user, through
+	// su or through run-as. See AccessShell and AccessPull.
+	Access Access
+
+	priorityOnce   sync.Once
+	priorityPrefix string
 }
 
 // NewClient creates a new ADB client, verifying adb is in PATH
@@ -31,6 +47,13 @@ type Device struct {
 
 // RunCommand executes a raw adb command and returns output
 func (c *Client) RunCommand(args ...string) (string, error) {
+	out, _, err := c.runCommand(args...)
+	return out, err
+}
+
+// runCommand is RunCommand that also returns stderr, for callers that read
+// the device command's error lines
+func (c *Client) runCommand(args ...string) (string, string, error) {
 	cmd := exec.Command(c.Path, args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 	var out bytes.Buffer
@@ -41,9 +64,62 @@ func (c *Client) RunCommand(args ...string) (string, error) {
 	err := cmd.Run()
 	if err != nil {
 		// Return output even if failed, so caller can decide if partial output is useful
-		return strings.TrimSpace(out.String()), fmt.Errorf("adb command failed: %s. Stderr: %s", err, stderr.String())
+		return strings.TrimSpace(out.String()), stderr.String(), fmt.Errorf("adb command failed: %s. Stderr: %s", err, stderr.String())
+	}
+	return strings.TrimSpace(out.String()), stderr.String(), nil
+}
+
+// RunCommandTo executes an adb command with its standard output going to w,
+// for output too large to keep in memory
+func (c *Client) RunCommandTo(w io.Writer, args ...string) error {
+	cmd := exec.Command(c.Path, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("adb command failed: %s. Stderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// Shell runs a command on the device through 'adb shell'. Arguments are quoted
+// for the device shell, so paths with spaces are passed through intact.
+func (c *Client) Shell(args ...string) (string, error) {
+	return c.RunCommand("shell", c.priority()+QuoteArgs(args...))
+}
+
+// priority returns the prefix for device commands, empty unless LowPriority is set
+func (c *Client) priority() string {
+	if !c.LowPriority.Load() {
+		return ""
+	}
+	return c.lowPriorityPrefix()
+}
+
+// lowPriorityPrefix probes the device once for ionice, which older toybox builds lack
+func (c *Client) lowPriorityPrefix() string {
+	c.priorityOnce.Do(func() {
+		c.priorityPrefix = "nice -n 19 "
+		if out, err := c.RunCommand("shell", "command -v ionice"); err == nil && out != "" {
+			c.priorityPrefix += "ionice -c 3 "
+		}
+	})
+	return c.priorityPrefix
+}
+
+// QuoteArgs joins arguments into a POSIX shell command line, single-quoting
+// any argument that contains characters the shell would interpret
+func QuoteArgs(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=+,@%") == "" {
+			quoted[i] = a
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
 	}
-	return strings.TrimSpace(out.String()), nil
+	return strings.Join(quoted, " ")
 }
 
 // Push copies a local file or directory to the device
@@ -0,0 +1,239 @@
+package adb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestQuoteArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls", "-R", "-l", "/sdcard/DCIM"}, "ls -R -l /sdcard/DCIM"},
+		{[]string{"ls", "/sdcard/My Photos"}, "ls '/sdcard/My Photos'"},
+		{[]string{"stat", "/sdcard/Bob's $HOME;rm"}, `stat '/sdcard/Bob'\''s $HOME;rm'`},
+		{[]string{"touch", ""}, "touch ''"},
+	}
+	for _, tt := range tests {
+		if got := QuoteArgs(tt.args...); got != tt.want {
+			t.Errorf("QuoteArgs(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	out := "1234 1709632210 /sdcard/DCIM/a.jpg\n" +
+		"0 1709632211 /sdcard/My Photos/b c.jpg\r\n" +
+		"stat: '/sdcard/missing.jpg': No such file or directory\n"
+	stats := parseStat(out)
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 entries, got %d: %v", len(stats), stats)
+	}
+	a := stats["/sdcard/DCIM/a.jpg"]
+	if !a.Exists || a.Size != 1234 || a.ModTime.Unix() != 1709632210 {
+		t.Errorf("Unexpected stat for a.jpg: %+v", a)
+	}
+	if !stats["/sdcard/My Photos/b c.jpg"].Exists {
+		t.Error("Path with spaces not parsed")
+	}
+}
+
+func TestStatMissing(t *testing.T) {
+	out := "stat: '/sdcard/missing.jpg': No such file or directory\n" +
+		"stat: cannot stat '/sdcard/it's gone.jpg': No such file or directory\r\n" +
+		"stat: '/data/data/app/a.db': Permission denied\n"
+	missing := statMissing(out)
+	if len(missing) != 2 || !missing["/sdcard/missing.jpg"] || !missing["/sdcard/it's gone.jpg"] {
+		t.Errorf("statMissing = %v", missing)
+	}
+}
+
+func TestScanCommand(t *testing.T) {
+	got := QuoteArgs(scanCommand("/sdcard/My Photos/a#1.jpg")...)
+	want := "am broadcast -a android.intent.action.MEDIA_SCANNER_SCAN_FILE -d file:///sdcard/My%20Photos/a%231.jpg"
+	if got != want {
+		t.Errorf("scanCommand = %s, want %s", got, want)
+	}
+}
+
+func TestParsePackages(t *testing.T) {
+	out := "package:/data/app/~~Xq3a==/org.telegram.messenger-Ab1==/base.apk=org.telegram.messenger\r\n" +
+		"package:/data/app/com.example.notes-1/base.apk=com.example.notes\n" +
+		"WARNING: linker: something\n"
+	pkgs := parsePackages(out)
+	if len(pkgs) != 2 || pkgs[0].Name != "com.example.notes" || pkgs[1].Name != "org.telegram.messenger" {
+		t.Fatalf("parsePackages = %+v", pkgs)
+	}
+	if pkgs[1].APKs[0] != "/data/app/~~Xq3a==/org.telegram.messenger-Ab1==/base.apk" {
+		t.Errorf("APK path with '=' cut wrongly: %s", pkgs[1].APKs[0])
+	}
+
+	paths := parsePackagePaths("package:/data/app/x/split_config.arm64_v8a.apk\npackage:/data/app/x/base.apk\npackage:/data/app/x/split_config.de.apk\n")
+	if len(paths) != 3 || paths[0] != "/data/app/x/base.apk" || paths[1] != "/data/app/x/split_config.arm64_v8a.apk" {
+		t.Errorf("parsePackagePaths = %v", paths)
+	}
+
+	dump := "Packages:\n  Package [org.telegram.messenger] (1a2b):\n    versionCode=51432 minSdk=21 targetSdk=34\n    versionName=11.2.3 (beta)\n" +
+		"Hidden system packages:\n    versionCode=100 minSdk=21 targetSdk=30\n    versionName=1.0\n"
+	if name, code := parseVersion(dump); name != "11.2.3 (beta)" || code != 51432 {
+		t.Errorf("parseVersion = %q, %d", name, code)
+	}
+}
+
+func TestParseDeviceInfo(t *testing.T) {
+	props := parseGetprop("[ro.product.manufacturer]: [Google]\n[ro.product.model]: [Pixel 8 Pro]\n[ro.build.version.release]: [14]\n" +
+		"[ro.build.version.sdk]: [34]\n[ro.build.display.id]: [UP1A.231005.007]\n[persist.sys.locale]: []\r\n")
+	info := infoFromProps(props)
+	if info.Name() != "Google Pixel 8 Pro" || info.AndroidVersion != "14" || info.SDK != 34 || info.Build != "UP1A.231005.007" {
+		t.Errorf("infoFromProps = %+v", info)
+	}
+	if (DeviceInfo{Manufacturer: "samsung", Model: "SAMSUNG-SM-G900A"}).Name() != "SAMSUNG-SM-G900A" {
+		t.Error("Manufacturer repeated in the name")
+	}
+
+	tests := []struct {
+		out      string
+		level    int
+		charging bool
+	}{
+		{"Current Battery Service state:\n  AC powered: false\n  USB powered: true\n  status: 2\n  level: 85\n  scale: 100\n", 85, true},
+		{"  AC powered: false\n  USB powered: false\n  Wireless powered: false\n  status: 3\n  level: 120\n  scale: 200\n", 60, false},
+		{"Can't find service: battery", -1, false},
+	}
+	for _, tt := range tests {
+		if level, charging := parseBattery(tt.out); level != tt.level || charging != tt.charging {
+			t.Errorf("parseBattery(%q) = %d, %v", tt.out, level, charging)
+		}
+	}
+
+	df := "Filesystem            1K-blocks    Used Available Use% Mounted on\n" +
+		"/dev/block/dm-5       113037396 5049832 107856492   5% /data\n" +
+		"/dev/fuse             113037396 5049832 107856492   5% /storage/emulated\n" +
+		"/dev/block/vold/public:179,1 62494720 1024 62493696 1% /mnt/media_rw/1A2B-3C4D\n" +
+		"/dev/fuse              62494720 1024 62493696   1% /storage/1A2B-3C4D\n" +
+		"/dev/fuse              250000000 1024 249998976  1% /storage/0123456789ABCDEF\n"
+	mounts := ParseDf(df)
+	if len(mounts) != 5 || mounts[2].Mount != "/mnt/media_rw/1A2B-3C4D" {
+		t.Errorf("ParseDf = %+v", mounts)
+	}
+	disks := storageDisks(mounts)
+	if len(disks) != 3 || disks[0].Name != "Internal storage" || disks[0].Free != 107856492*1024 ||
+		disks[1].Name != "SD card 1A2B-3C4D" || disks[2].Name != "SD card 0123456789ABCDEF" {
+		t.Errorf("storageDisks = %+v", disks)
+	}
+}
+
+func TestWirelessDiscovery(t *testing.T) {
+	// A phone's answer, split over two packets like some responders do
+	instance := dnsmessage.MustNewName("adb-R5CR1234-AbCdEf._adb-tls-connect._tcp.local.")
+	host := dnsmessage.MustNewName("Android-3.local.")
+	packet := func(build func(b *dnsmessage.Builder)) []byte {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+		b.StartAnswers()
+		build(&b)
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	rec := newMDNSRecords()
+	rec.collect(packet(func(b *dnsmessage.Builder) {
+		b.PTRResource(dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("_adb-tls-connect._tcp.local."), Class: dnsmessage.ClassINET}, dnsmessage.PTRResource{PTR: instance})
+		b.SRVResource(dnsmessage.ResourceHeader{Name: instance, Class: dnsmessage.ClassINET}, dnsmessage.SRVResource{Target: host, Port: 37123})
+	}))
+	if len(rec.services(ConnectService)) != 0 {
+		t.Error("Service listed before its address is known")
+	}
+	rec.collect(packet(func(b *dnsmessage.Builder) {
+		b.AResource(dnsmessage.ResourceHeader{Name: host, Class: dnsmessage.ClassINET}, dnsmessage.AResource{A: [4]byte{192, 168, 1, 23}})
+	}))
+	services := rec.services(ConnectService)
+	if len(services) != 1 || services[0].Instance != "adb-R5CR1234-AbCdEf" || services[0].Addr != "192.168.1.23:37123" {
+		t.Errorf("services = %+v", services)
+	}
+
+	out := "List of discovered mdns services\nadb-R5CR1234-AbCdEf\t_adb-tls-connect._tcp\t192.168.1.23:37123\n" +
+		"adb-R5CR1234-AbCdEf\t_adb-tls-pairing._tcp.\t192.168.1.23:41234\n"
+	parsed := parseMDNSServices(out)
+	if len(parsed) != 2 || parsed[0].Addr != "192.168.1.23:37123" || parsed[1].Type != PairingService {
+		t.Errorf("parseMDNSServices = %+v", parsed)
+	}
+
+	for out, want := range map[string]bool{
+		"connected to 192.168.1.23:37123":                               true,
+		"already connected to 192.168.1.23:37123":                       true,
+		"failed to connect to '192.168.1.23:37123': Connection refused": false,
+		"cannot connect to 192.168.1.23:5555: No route to host (113)":   false,
+	} {
+		if connected(out) != want {
+			t.Errorf("connected(%q) = %v", out, !want)
+		}
+	}
+	if !IsWireless("192.168.1.23:37123") || !IsWireless("adb-R5CR1234-AbCdEf._adb-tls-connect._tcp") || IsWireless("R5CR1234") {
+		t.Error("IsWireless misclassified a serial")
+	}
+}
+
+func TestKnownDevices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "wireless.json")
+	k, err := LoadKnownDevices(path)
+	if err != nil || len(k.Devices) != 0 {
+		t.Fatalf("LoadKnownDevices of a missing file = %+v, %v", k, err)
+	}
+	k.Remember(WirelessDevice{Name: "adb-A-1", Address: "192.168.1.23:37123", Model: "Pixel 8"})
+	k.Remember(WirelessDevice{Address: "192.168.1.40:5555"})
+	// Same phone on a new port after wireless debugging was turned off and on
+	k.Remember(WirelessDevice{Name: "adb-A-1", Address: "192.168.1.23:40001"})
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+	k, err = LoadKnownDevices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Devices) != 2 || k.Devices[0].Address != "192.168.1.23:40001" || k.Devices[0].Model != "Pixel 8" {
+		t.Errorf("Devices = %+v", k.Devices)
+	}
+	k.Forget("192.168.1.40:5555")
+	if _, ok := k.Find("192.168.1.40:5555", ""); ok || len(k.Devices) != 1 {
+		t.Errorf("Forget left %+v", k.Devices)
+	}
+	if d := k.ForSerial("adb-A-1._adb-tls-connect._tcp"); d.Address != "192.168.1.23:40001" {
+		t.Errorf("ForSerial of an mDNS serial = %+v", d)
+	}
+	if d := k.ForSerial("192.168.1.50:5555"); d.Address != "192.168.1.50:5555" || d.Name != "" {
+		t.Errorf("ForSerial of a new device = %+v", d)
+	}
+}
+
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wrapped string
+		wantErr bool
+	}{
+		{"", "shell", "ls -R /sdcard", false},
+		{"root", "root", "su -c 'ls -R /sdcard'", false},
+		{"run-as:org.example.notes", "run-as:org.example.notes", "run-as org.example.notes sh -c 'ls -R /sdcard'", false},
+		{"run-as:", "", "", true},
+		{"admin", "", "", true},
+	}
+	for _, tt := range tests {
+		a, err := ParseAccess(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAccess(%q) error = %v", tt.in, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if a.String() != tt.want || a.wrap("ls -R /sdcard") != tt.wrapped {
+			t.Errorf("ParseAccess(%q) = %s, wraps to %q", tt.in, a, a.wrap("ls -R /sdcard"))
+		}
+	}
+}
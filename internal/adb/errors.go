@@ -0,0 +1,71 @@
+package adb
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ErrorKind classifies a failed adb command by its cause
+type ErrorKind int
+
+const (
+	KindUnknown          ErrorKind = iota
+	KindDeviceOffline              // Device unplugged, rebooting or adbd restarting
+	KindProtocol                   // Transport broke mid-transfer
+	KindPermissionDenied           // Shell user can't read or write the path
+	KindNoSpace                    // Phone or PC storage is full
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindDeviceOffline:
+		return "device offline"
+	case KindProtocol:
+		return "protocol fault"
+	case KindPermissionDenied:
+		return "permission denied"
+	case KindNoSpace:
+		return "no space"
+	}
+	return "unknown"
+}
+
+// Transient reports whether running the same command again may succeed
+func (k ErrorKind) Transient() bool {
+	return k == KindDeviceOffline || k == KindProtocol
+}
+
+// Markers found in adb's stderr (or in the OS error for local writes), lower-case
+var errorMarkers = []struct {
+	kind    ErrorKind
+	markers []string
+}{
+	// Checked first: a full disk often also breaks the transfer
+	{KindNoSpace, []string{"no space left", "not enough space", "disk full"}},
+	{KindPermissionDenied, []string{"permission denied", "operation not permitted", "read-only file system", "access is denied"}},
+	{KindDeviceOffline, []string{"device offline", "no devices/emulators found", "device unauthorized", "cannot connect to daemon", "device still authorizing"}},
+	{KindProtocol, []string{"protocol fault", "connection reset", "broken pipe", "failed to read", "failed to write", "unexpected eof", "error: closed"}},
+}
+
+// deviceNotFound is adb's "device '<serial>' not found"; a bare "not found"
+// is also how the shell reports a missing command, which retrying won't fix
+var deviceNotFound = regexp.MustCompile(`device '[^']*' not found`)
+
+// Classify inspects an error returned by the client
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return KindUnknown
+	}
+	msg := strings.ToLower(err.Error())
+	for _, group := range errorMarkers {
+		for _, m := range group.markers {
+			if strings.Contains(msg, m) {
+				return group.kind
+			}
+		}
+	}
+	if deviceNotFound.MatchString(msg) {
+		return KindDeviceOffline
+	}
+	return KindUnknown
+}
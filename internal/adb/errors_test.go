@@ -0,0 +1,38 @@
+package adb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		stderr    string
+		kind      ErrorKind
+		transient bool
+	}{
+		{"adb: error: device offline", KindDeviceOffline, true},
+		{"error: device 'R58M12345' not found", KindDeviceOffline, true},
+		{"adb: error: failed to copy '/sdcard/a.jpg' to 'C:\\a.jpg': protocol fault (couldn't read status): connection reset", KindProtocol, true},
+		{"adb: error: failed to stat remote object '/data/x': Permission denied", KindPermissionDenied, false},
+		{"adb: error: failed to copy 'a.mp4' to '/sdcard/a.mp4': remote No space left on device", KindNoSpace, false},
+		{"adb: error: remote object '/sdcard/missing' does not exist", KindUnknown, false},
+		{"/system/bin/sh: touch: not found", KindUnknown, false},
+		{"nice: not found", KindUnknown, false},
+	}
+	for _, tt := range tests {
+		// Errors reach Classify wrapped by RunCommand and the transfer agent
+		err := fmt.Errorf("adb pull failed for /sdcard/x: %w", errors.New("adb command failed: exit status 1. Stderr: "+tt.stderr))
+		kind := Classify(err)
+		if kind != tt.kind {
+			t.Errorf("Classify(%q) = %s, want %s", tt.stderr, kind, tt.kind)
+		}
+		if kind.Transient() != tt.transient {
+			t.Errorf("%s.Transient() = %v, want %v", kind, kind.Transient(), tt.transient)
+		}
+	}
+	if Classify(nil) != KindUnknown {
+		t.Error("Classify(nil) should be KindUnknown")
+	}
+}
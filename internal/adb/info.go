@@ -0,0 +1,171 @@
+package adb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DeviceInfo is the profile of a device: what it is, its battery and storage
+type DeviceInfo struct {
+	Serial         string `json:"serial,omitempty"`
+	Manufacturer   string `json:"manufacturer,omitempty"`
+	Brand          string `json:"brand,omitempty"`
+	Model          string `json:"model,omitempty"`
+	Device         string `json:"device,omitempty"` // Code name, e.g. "husky"
+	AndroidVersion string `json:"android_version,omitempty"`
+	SDK            int    `json:"sdk,omitempty"`
+	Build          string `json:"build,omitempty"`
+	SecurityPatch  string `json:"security_patch,omitempty"`
+	BatteryLevel   int    `json:"battery_level"` // Percent, -1 if unknown
+	Charging       bool   `json:"charging"`
+	Disks          []Disk `json:"disks,omitempty"`
+}
+
+// Disk is the usage of internal storage or an SD card
+type Disk struct {
+	Name  string `json:"name"`  // "Internal storage" or "SD card XXXX-XXXX"
+	Mount string `json:"mount"` // Mount point on the device
+	Total int64  `json:"total"` // Bytes
+	Used  int64  `json:"used"`
+	Free  int64  `json:"free"`
+}
+
+// Name is manufacturer and model, e.g. "Google Pixel 8 Pro"
+func (d DeviceInfo) Name() string {
+	if d.Manufacturer == "" || strings.HasPrefix(strings.ToLower(d.Model), strings.ToLower(d.Manufacturer)) {
+		return d.Model
+	}
+	return strings.TrimSpace(strings.ToUpper(d.Manufacturer[:1]) + d.Manufacturer[1:] + " " + d.Model)
+}
+
+// DeviceInfo collects the device properties (getprop), the battery state
+// (dumpsys battery) and the storage usage (df). Only getprop has to work,
+// the battery level is -1 if it can't be read.
+func (c *Client) DeviceInfo() (DeviceInfo, error) {
+	out, err := c.Shell("getprop")
+	if err != nil {
+		return DeviceInfo{BatteryLevel: -1}, err
+	}
+	info := infoFromProps(parseGetprop(out))
+	if out, err := c.Shell("dumpsys", "battery"); err == nil {
+		info.BatteryLevel, info.Charging = parseBattery(out)
+	}
+	if out, err := c.Shell("df", "-k"); err == nil {
+		info.Disks = storageDisks(ParseDf(out))
+	}
+	return info, nil
+}
+
+var propLine = regexp.MustCompile(`^\[([^\]]+)\]: \[(.*)\]$`)
+
+// parseGetprop parses "[ro.product.model]: [Pixel 8 Pro]" lines
+func parseGetprop(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if m := propLine.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			props[m[1]] = m[2]
+		}
+	}
+	return props
+}
+
+func infoFromProps(props map[string]string) DeviceInfo {
+	sdk, _ := strconv.Atoi(props["ro.build.version.sdk"])
+	return DeviceInfo{
+		Serial:         props["ro.serialno"],
+		Manufacturer:   props["ro.product.manufacturer"],
+		Brand:          props["ro.product.brand"],
+		Model:          props["ro.product.model"],
+		Device:         props["ro.product.device"],
+		AndroidVersion: props["ro.build.version.release"],
+		SDK:            sdk,
+		Build:          props["ro.build.display.id"],
+		SecurityPatch:  props["ro.build.version.security_patch"],
+		BatteryLevel:   -1,
+	}
+}
+
+// parseBattery reads level, scale, status and the powered lines of dumpsys battery
+func parseBattery(out string) (level int, charging bool) {
+	level, scale := -1, 100
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ": ")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "level":
+			level, _ = strconv.Atoi(value)
+		case key == "scale":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				scale = n
+			}
+		case key == "status":
+			// BatteryManager.BATTERY_STATUS_CHARGING and _FULL
+			charging = charging || value == "2" || value == "5"
+		case strings.HasSuffix(key, " powered"):
+			charging = charging || value == "true"
+		}
+	}
+	if level >= 0 {
+		level = level * 100 / scale
+	}
+	return level, charging
+}
+
+// UUIDPattern matches the filesystem IDs removable volumes are mounted under:
+// ABCD-1234 for FAT, 16 hex digits for exFAT and NTFS on some devices
+const UUIDPattern = `[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}|[0-9A-Fa-f]{16}`
+
+var sdCardMount = regexp.MustCompile(`^/storage/(` + UUIDPattern + `)$`)
+
+// ParseDf reads every mount point in toybox df -k output, with its usage in
+// bytes; Name is left empty:
+//
+//	Filesystem     1K-blocks    Used Available Use% Mounted on
+//	/dev/block/dm-5 113037396 5049832 107856492   5% /data
+func ParseDf(out string) []Disk {
+	var disks []Disk
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		var kb [3]int64
+		valid := true
+		for i := range kb {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			kb[i] = n * 1024
+		}
+		mount := strings.Join(fields[5:], " ")
+		if !valid || seen[mount] {
+			continue
+		}
+		seen[mount] = true
+		disks = append(disks, Disk{Mount: mount, Total: kb[0], Used: kb[1], Free: kb[2]})
+	}
+	return disks
+}
+
+// storageDisks picks the data partition and SD cards from the mounts of df
+func storageDisks(mounts []Disk) []Disk {
+	var disks []Disk
+	for _, d := range mounts {
+		switch m := sdCardMount.FindStringSubmatch(d.Mount); {
+		case d.Mount == "/data":
+			d.Name = "Internal storage"
+		case m != nil:
+			d.Name = "SD card " + m[1]
+		default:
+			continue
+		}
+		disks = append(disks, d)
+	}
+	return disks
+}
@@ -0,0 +1,201 @@
+package adb
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mDNS service types of Android 11+ wireless debugging
+const (
+	ConnectService = "_adb-tls-connect._tcp"
+	PairingService = "_adb-tls-pairing._tcp"
+)
+
+// Service is a device advertising wireless debugging
+type Service struct {
+	Instance string // e.g. adb-R5CR1234-AbCdEf
+	Type     string // ConnectService or PairingService
+	Addr     string // host:port
+}
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Discover browses the local network for a service type over mDNS for the
+// given time. It asks for unicast answers and also listens to the multicast
+// group, where some phones answer regardless.
+func Discover(service string, timeout time.Duration) ([]Service, error) {
+	query, err := mdnsQuery(service)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conns := []*net.UDPConn{conn}
+	// Port 5353 may be taken by the system's own responder
+	if group, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup); err == nil {
+		defer group.Close()
+		conns = append(conns, group)
+	}
+	if _, err := conn.WriteToUDP(query, mdnsGroup); err != nil {
+		return nil, err
+	}
+
+	rec := newMDNSRecords()
+	packets := make(chan []byte)
+	deadline := time.Now().Add(timeout)
+	for _, c := range conns {
+		c.SetReadDeadline(deadline)
+		go func(c *net.UDPConn) {
+			buf := make([]byte, 9000)
+			for {
+				n, _, err := c.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				select {
+				case packets <- append([]byte(nil), buf[:n]...):
+				case <-time.After(time.Until(deadline)):
+					return
+				}
+			}
+		}(c)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case p := <-packets:
+			rec.collect(p)
+		case <-timer.C:
+			return rec.services(service), nil
+		}
+	}
+}
+
+// mdnsQuery asks for the PTR records of a service, with the unicast-response bit set
+func mdnsQuery(service string) ([]byte, error) {
+	name, err := dnsmessage.NewName(service + ".local.")
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  name,
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET | 1<<15,
+	}}}
+	return msg.Pack()
+}
+
+type srvTarget struct {
+	host string
+	port uint16
+}
+
+// mdnsRecords gathers the records of all answers; a phone may send the
+// PTR, SRV and A records in separate packets
+type mdnsRecords struct {
+	instances map[string]bool // Full instance names from PTR records
+	srv       map[string]srvTarget
+	addrs     map[string]net.IP
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{instances: make(map[string]bool), srv: make(map[string]srvTarget), addrs: make(map[string]net.IP)}
+}
+
+func (r *mdnsRecords) collect(packet []byte) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil || !msg.Header.Response {
+		return
+	}
+	for _, rr := range append(append(msg.Answers, msg.Authorities...), msg.Additionals...) {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			r.instances[body.PTR.String()] = true
+		case *dnsmessage.SRVResource:
+			r.srv[name] = srvTarget{strings.ToLower(body.Target.String()), body.Port}
+		case *dnsmessage.AResource:
+			r.addrs[name] = net.IP(body.A[:])
+		}
+	}
+}
+
+func (r *mdnsRecords) services(service string) []Service {
+	suffix := "." + service + ".local."
+	var services []Service
+	for full := range r.instances {
+		if !strings.HasSuffix(strings.ToLower(full), suffix) {
+			continue
+		}
+		target, ok := r.srv[strings.ToLower(full)]
+		if !ok {
+			continue
+		}
+		ip, ok := r.addrs[target.host]
+		if !ok {
+			continue
+		}
+		services = append(services, Service{
+			Instance: full[:len(full)-len(suffix)],
+			Type:     service,
+			Addr:     net.JoinHostPort(ip.String(), strconv.Itoa(int(target.port))),
+		})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Instance < services[j].Instance })
+	return services
+}
+
+// MDNSServices lists what adb's own mDNS discovery found (adb mdns services)
+func (c *Client) MDNSServices() ([]Service, error) {
+	out, err := c.RunCommand("mdns", "services")
+	if err != nil {
+		return nil, err
+	}
+	return parseMDNSServices(out), nil
+}
+
+// parseMDNSServices parses "<instance>\t<type>\t<host:port>" lines
+func parseMDNSServices(out string) []Service {
+	var services []Service
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[1], "_adb") {
+			continue
+		}
+		services = append(services, Service{
+			Instance: fields[0],
+			Type:     strings.TrimSuffix(strings.TrimSuffix(fields[1], "."), ".local"),
+			Addr:     fields[2],
+		})
+	}
+	return services
+}
+
+// DiscoverWireless finds devices ready for a wireless connection, with our own
+// mDNS browser and with adb's, which is off in some adb builds
+func (c *Client) DiscoverWireless(timeout time.Duration) ([]Service, error) {
+	found, err := Discover(ConnectService, timeout)
+	adbFound, adbErr := c.MDNSServices()
+	if err != nil && adbErr != nil {
+		return nil, errors.Join(err, adbErr)
+	}
+	seen := make(map[string]bool)
+	var services []Service
+	for _, s := range append(found, adbFound...) {
+		if s.Type == ConnectService && !seen[s.Instance] {
+			seen[s.Instance] = true
+			services = append(services, s)
+		}
+	}
+	return services, nil
+}
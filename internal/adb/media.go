@@ -0,0 +1,40 @@
+package adb
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// scanBatch is how many media scan broadcasts go into one 'adb shell' call
+const scanBatch = 20
+
+// SetModTime sets the modification time of a device file, interpreted in the
+// device's time zone. The file is not created when missing.
+func (c *Client) SetModTime(path string, t time.Time) error {
+	_, err := c.Shell("touch", "-c", "-m", "-t", t.Format("200601021504.05"), path)
+	return err
+}
+
+// ScanMedia asks MediaStore to index the given device files so they show up
+// in the gallery without waiting for the next full rescan
+func (c *Client) ScanMedia(paths []string) error {
+	for start := 0; start < len(paths); start += scanBatch {
+		batch := paths[start:min(start+scanBatch, len(paths))]
+		cmds := make([]string, len(batch))
+		for i, p := range batch {
+			cmds[i] = c.priority() + QuoteArgs(scanCommand(p)...)
+		}
+		// && so a failing broadcast isn't hidden behind the exit status of the last one
+		if _, err := c.RunCommand("shell", strings.Join(cmds, " && ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanCommand builds the media scanner broadcast for one file
+func scanCommand(path string) []string {
+	uri := url.URL{Scheme: "file", Path: path}
+	return []string{"am", "broadcast", "-a", "android.intent.action.MEDIA_SCANNER_SCAN_FILE", "-d", uri.String()}
+}
@@ -0,0 +1,136 @@
+package adb
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is an app installed on the device
+type Package struct {
+	Name        string   // e.g. org.telegram.messenger
+	APKs        []string // Device paths, base.apk first, then the split APKs
+	VersionName string
+	VersionCode int64
+}
+
+// Packages lists the user-installed apps (pm list packages -3), with their
+// base APK only. Call PackageInfo for the splits and version.
+func (c *Client) Packages() ([]Package, error) {
+	out, err := c.Shell("pm", "list", "packages", "-3", "-f")
+	if err != nil {
+		return nil, err
+	}
+	return parsePackages(out), nil
+}
+
+// PackageInfo resolves every APK of an app (pm path) and its version (dumpsys package)
+func (c *Client) PackageInfo(name string) (Package, error) {
+	out, err := c.Shell("pm", "path", name)
+	if err != nil {
+		return Package{}, err
+	}
+	p := Package{Name: name, APKs: parsePackagePaths(out)}
+	if len(p.APKs) == 0 {
+		return p, fmt.Errorf("%s is not installed", name)
+	}
+	out, err = c.Shell("dumpsys", "package", name)
+	if err != nil {
+		return p, err
+	}
+	p.VersionName, p.VersionCode = parseVersion(out)
+	return p, nil
+}
+
+// Pull copies a device file to a local path
+func (c *Client) Pull(remotePath, localPath string) error {
+	_, err := c.RunCommand("pull", remotePath, localPath)
+	return err
+}
+
+// InstallMultiple installs an app from its base and split APKs on this PC,
+// replacing an installed version (install-multiple -r). Downgrades are refused
+// by the device.
+func (c *Client) InstallMultiple(apks []string) error {
+	out, err := c.RunCommand(append([]string{"install-multiple", "-r"}, apks...)...)
+	if err != nil {
+		return err
+	}
+	// Older adb versions exit 0 on a failed install
+	if i := strings.Index(out, "Failure"); i >= 0 {
+		return fmt.Errorf("install failed: %s", strings.TrimSpace(out[i:]))
+	}
+	return nil
+}
+
+// parsePackages parses "package:<apk path>=<name>" lines. The path itself may
+// contain '=' (/data/app/~~Xq==/...), the name never does.
+func parsePackages(out string) []Package {
+	var pkgs []Package
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		rest, ok := strings.CutPrefix(line, "package:")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, "=")
+		if i <= 0 || i == len(rest)-1 {
+			continue
+		}
+		pkgs = append(pkgs, Package{Name: rest[i+1:], APKs: []string{rest[:i]}})
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs
+}
+
+// parsePackagePaths parses pm path output, putting base.apk first
+func parsePackagePaths(out string) []string {
+	var paths []string
+	for _, line := range strings.Split(out, "\n") {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(line), "package:"); ok && p != "" {
+			paths = append(paths, p)
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return path.Base(paths[i]) == "base.apk" && path.Base(paths[j]) != "base.apk"
+	})
+	return paths
+}
+
+// parseVersion finds the first versionName and versionCode in dumpsys package
+// output; an updated system app lists the installed version first
+func parseVersion(out string) (name string, code int64) {
+	foundName, foundCode := false, false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		// The name may contain spaces and takes the whole line
+		if value, ok := strings.CutPrefix(line, "versionName="); ok && !foundName {
+			name, foundName = value, true
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if value, ok := strings.CutPrefix(field, "versionCode="); ok && !foundCode {
+				code, _ = strconv.ParseInt(value, 10, 64)
+				foundCode = true
+			}
+		}
+	}
+	return name, code
+}
+
+// BackupArchive runs adb backup of the app data of the given packages into an
+// Android backup (.ab) file. The user has to confirm on the device, where a
+// password for encryption can be set too. APKs are left out (see Pull).
+func (c *Client) BackupArchive(path string, packages []string) error {
+	_, err := c.RunCommand(append([]string{"backup", "-f", path, "-noapk"}, packages...)...)
+	return err
+}
+
+// RestoreArchive runs adb restore of an Android backup (.ab) file; the user has
+// to confirm on the device and enter the backup password there
+func (c *Client) RestoreArchive(path string) error {
+	_, err := c.RunCommand("restore", path)
+	return err
+}
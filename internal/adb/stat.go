@@ -0,0 +1,120 @@
+package adb
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statBatch is how many paths go into one 'adb shell stat' call, keeping the
+// command line well under the limits of older devices
+const statBatch = 50
+
+// RemoteStat is the metadata of a path on the device
+type RemoteStat struct {
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+}
+
+// Stat returns the size and modification time of a device path.
+// A missing path is not an error, it comes back with Exists false.
+func (c *Client) Stat(path string) (RemoteStat, error) {
+	stats, err := c.StatMany([]string{path})
+	if err != nil {
+		return RemoteStat{}, err
+	}
+	return stats[path], nil
+}
+
+// StatMany stats many device paths with few adb round trips.
+// Paths that don't exist are present in the result with Exists false; a path
+// stat says nothing about, e.g. denied or cut off, fails the call.
+func (c *Client) StatMany(paths []string) (map[string]RemoteStat, error) {
+	stats := make(map[string]RemoteStat, len(paths))
+	for start := 0; start < len(paths); start += statBatch {
+		batch := paths[start:min(start+statBatch, len(paths))]
+		args := append([]string{"stat", "-c", "%s %Y %n"}, batch...)
+		// stat exits non-zero when any path is missing but still prints the others.
+		// Older devices mix its error lines into stdout.
+		out, stderr, err := c.runCommand("shell", c.priority()+QuoteArgs(args...))
+		for path, st := range parseStat(out) {
+			stats[path] = st
+		}
+		missing := statMissing(out + "\n" + stderr)
+		for _, p := range batch {
+			if _, ok := stats[p]; ok {
+				continue
+			}
+			if !missing[p] {
+				if err == nil {
+					err = fmt.Errorf("stat printed nothing for %s", p)
+				}
+				return nil, err
+			}
+			stats[p] = RemoteStat{}
+		}
+	}
+	return stats, nil
+}
+
+// statMissing returns the paths of stat's "No such file or directory" lines,
+// e.g. "stat: '/sdcard/a.jpg': No such file or directory"
+func statMissing(out string) map[string]bool {
+	missing := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		rest, ok := strings.CutSuffix(strings.TrimRight(line, "\r"), "': No such file or directory")
+		if !ok {
+			continue
+		}
+		if _, path, ok := strings.Cut(rest, "'"); ok {
+			missing[path] = true
+		}
+	}
+	return missing
+}
+
+// parseStat parses "size mtime name" lines from stat -c '%s %Y %n'
+func parseStat(out string) map[string]RemoteStat {
+	stats := make(map[string]RemoteStat)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimRight(line, "\r"), " ", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		size, err1 := strconv.ParseInt(parts[0], 10, 64)
+		mtime, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		stats[parts[2]] = RemoteStat{Exists: true, Size: size, ModTime: time.Unix(mtime, 0)}
+	}
+	return stats
+}
+
+// Hash returns the hex SHA-256 of a device file
+func (c *Client) Hash(path string) (string, error) {
+	out, err := c.Shell("sha256sum", path)
+	if err != nil {
+		return "", err
+	}
+	hash, _, _ := strings.Cut(out, " ")
+	if len(hash) != 64 {
+		return "", fmt.Errorf("unexpected sha256sum output for %s: %q", path, out)
+	}
+	return hash, nil
+}
+
+// Cat streams a device file to w. exec-out keeps binary data intact but
+// reports no exit status, so callers check what arrived, e.g. by its hash.
+func (c *Client) Cat(w io.Writer, path string) error {
+	return c.RunCommandTo(w, "exec-out", "cat "+QuoteArgs(path)+" 2>/dev/null")
+}
+
+// Remove deletes a device file. A missing file is not an error.
+func (c *Client) Remove(path string) error {
+	_, err := c.Shell("rm", "-f", path)
+	return err
+}
@@ -0,0 +1,221 @@
+package adb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pair pairs with a device in wireless debugging mode, using the address and
+// six digit code its "Pair device with pairing code" screen shows
+func (c *Client) Pair(addr, code string) error {
+	out, err := c.RunCommand("pair", addr, code)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(out, "Successfully paired") {
+		return fmt.Errorf("pairing with %s failed: %s", addr, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// Connect connects to a paired device over Wi-Fi. adb connect exits with 0
+// even when it fails, so its output is checked.
+func (c *Client) Connect(addr string) error {
+	out, err := c.RunCommand("connect", addr)
+	if err != nil {
+		return err
+	}
+	if !connected(out) {
+		return fmt.Errorf("cannot connect to %s: %s", addr, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func connected(out string) bool {
+	out = strings.ToLower(out)
+	return strings.Contains(out, "connected to") && !strings.Contains(out, "cannot") && !strings.Contains(out, "failed")
+}
+
+// Disconnect drops a wireless connection; an empty addr drops all of them
+func (c *Client) Disconnect(addr string) error {
+	args := []string{"disconnect"}
+	if addr != "" {
+		args = append(args, addr)
+	}
+	_, err := c.RunCommand(args...)
+	return err
+}
+
+// IsWireless reports whether a device serial is a Wi-Fi connection:
+// host:port or an mDNS name like adb-R5CR1234-AbCdEf._adb-tls-connect._tcp
+func IsWireless(serial string) bool {
+	return strings.Contains(serial, ":") || strings.Contains(serial, "."+ConnectService)
+}
+
+// WirelessDevice is a device that was connected over Wi-Fi before
+type WirelessDevice struct {
+	Name     string    `json:"name"`            // mDNS instance name, adb-<serial>-<id>, if known
+	Address  string    `json:"address"`         // host:port of the last connection
+	Model    string    `json:"model,omitempty"` // Shown in the list
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func (d WirelessDevice) String() string {
+	if d.Model == "" {
+		return d.Address
+	}
+	return d.Model + " (" + d.Address + ")"
+}
+
+// KnownDevices is the saved list of wireless devices, most recent first
+type KnownDevices struct {
+	Devices []WirelessDevice `json:"devices"`
+	path    string
+}
+
+// KnownDevicesPath is the list in the user's configuration folder
+func KnownDevicesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "AndroidSafeLocal", "wireless.json"), nil
+}
+
+// LoadKnownDevices reads the list at path, empty if there is none yet
+func LoadKnownDevices(path string) (*KnownDevices, error) {
+	k := &KnownDevices{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// Save writes the list back to where it was loaded from
+func (k *KnownDevices) Save() error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(k.path, data, 0644)
+}
+
+// Remember adds a device or updates the one with the same name or address,
+// moving it to the top
+func (k *KnownDevices) Remember(d WirelessDevice) {
+	if d.LastSeen.IsZero() {
+		d.LastSeen = time.Now()
+	}
+	if old, ok := k.Find(d.Address, d.Name); ok {
+		if d.Name == "" {
+			d.Name = old.Name
+		}
+		if d.Model == "" {
+			d.Model = old.Model
+		}
+		k.Forget(old.Address)
+	}
+	k.Devices = append([]WirelessDevice{d}, k.Devices...)
+}
+
+// Forget removes the device with this address
+func (k *KnownDevices) Forget(addr string) {
+	kept := k.Devices[:0]
+	for _, d := range k.Devices {
+		if d.Address != addr {
+			kept = append(kept, d)
+		}
+	}
+	k.Devices = kept
+}
+
+// Find returns the device with this address or, if name is set, mDNS name
+func (k *KnownDevices) Find(addr, name string) (WirelessDevice, bool) {
+	for _, d := range k.Devices {
+		if d.Address == addr || (name != "" && d.Name == name) {
+			return d, true
+		}
+	}
+	return WirelessDevice{}, false
+}
+
+// ForSerial returns the known device behind a wireless serial from adb
+// devices, or a new entry for it
+func (k *KnownDevices) ForSerial(serial string) WirelessDevice {
+	name, isName := strings.CutSuffix(serial, "."+ConnectService)
+	if !isName {
+		name = ""
+	}
+	if d, ok := k.Find(serial, name); ok {
+		return d
+	}
+	if isName {
+		return WirelessDevice{Name: name, Address: serial}
+	}
+	return WirelessDevice{Address: serial}
+}
+
+// reconnectPause keeps parallel transfers that fail together from
+// reconnecting one after the other
+const reconnectPause = 5 * time.Second
+
+// ConnectDevice connects to a known wireless device. When the saved address
+// fails, as it does after wireless debugging was turned off and on, the
+// device is looked up by its mDNS name and d.Address set to the new port.
+func (c *Client) ConnectDevice(d *WirelessDevice) error {
+	err := c.Connect(d.Address)
+	if err == nil || d.Name == "" {
+		return err
+	}
+	services, derr := c.DiscoverWireless(3 * time.Second)
+	if derr != nil {
+		return err
+	}
+	for _, s := range services {
+		if strings.EqualFold(s.Instance, d.Name) {
+			if err = c.Connect(s.Addr); err == nil {
+				d.Address = s.Addr
+			}
+			return err
+		}
+	}
+	return err
+}
+
+// Reconnector returns a function that connects to the wireless device d
+// again, for retries after it dropped off. Concurrent calls reconnect once
+// and share the outcome of that attempt.
+func (c *Client) Reconnector(d WirelessDevice) func() error {
+	var (
+		mu      sync.Mutex
+		last    time.Time
+		lastErr error
+	)
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(last) < reconnectPause {
+			return lastErr
+		}
+		lastErr = c.ConnectDevice(&d)
+		last = time.Now()
+		return lastErr
+	}
+}
@@ -0,0 +1,239 @@
+package apps
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/storage"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Folder holds the app backups inside the backup root, one folder per
+// package and version: Apps/<package>/<version code>/base.apk
+const Folder = "Apps"
+
+// indexName lists the backed up app versions
+const indexName = Folder + "/apps.json"
+
+// App is one backed up version of an app
+type App struct {
+	Package     string   `json:"package"`
+	VersionName string   `json:"version_name,omitempty"`
+	VersionCode int64    `json:"version_code"`
+	APKs        []string `json:"apks"` // Storage names, base.apk first
+	Size        int64    `json:"size"`
+	BackedUp    string   `json:"backed_up"` // "2006-01-02 15:04"
+}
+
+// String names the app and version for logs and selection lists
+func (a App) String() string {
+	v := a.VersionName
+	if v == "" {
+		v = strconv.FormatInt(a.VersionCode, 10)
+	}
+	return fmt.Sprintf("%s %s", a.Package, v)
+}
+
+// Index is the list of app versions in a backup
+type Index struct {
+	Apps []App `json:"apps"`
+}
+
+// Load reads the app index of a backup, empty if it has none yet
+func Load(st storage.Storage) (*Index, error) {
+	rc, err := st.Get(indexName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Index{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var ix Index
+	if err := json.NewDecoder(rc).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("%s: %w", indexName, err)
+	}
+	return &ix, nil
+}
+
+// Save writes the app index to the backup
+func (ix *Index) Save(st storage.Storage) error {
+	data, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.Put(indexName, bytes.NewReader(data), int64(len(data)))
+}
+
+// Has reports whether the backup holds this version of the app
+func (ix *Index) Has(pkg string, versionCode int64) bool {
+	for _, a := range ix.Apps {
+		if a.Package == pkg && a.VersionCode == versionCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the newest backed up version of each app, sorted by package
+func (ix *Index) Latest() []App {
+	newest := make(map[string]App)
+	for _, a := range ix.Apps {
+		if cur, ok := newest[a.Package]; !ok || a.VersionCode >= cur.VersionCode {
+			newest[a.Package] = a
+		}
+	}
+	latest := make([]App, 0, len(newest))
+	for _, a := range newest {
+		latest = append(latest, a)
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].Package < latest[j].Package })
+	return latest
+}
+
+// Device is the part of the ADB client that backs up and installs apps
+type Device interface {
+	PackageInfo(name string) (adb.Package, error)
+	Pull(remotePath, localPath string) error
+	InstallMultiple(apks []string) error
+}
+
+// Result is the outcome for one app
+type Result struct {
+	App     App
+	Skipped bool // Backup: this version is in the backup already
+	Err     error
+}
+
+// Backup pulls the APKs of the named packages with their version into st.
+// Versions already in the backup are skipped, older versions are kept.
+// onResult, if not nil, is called after each app.
+func Backup(dev Device, st storage.Storage, names []string, onResult func(Result)) ([]Result, error) {
+	ix, err := Load(st)
+	if err != nil {
+		return nil, err
+	}
+	stage, err := os.MkdirTemp("", "android-safe-local-apk-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	var results []Result
+	for _, name := range names {
+		res := backupApp(dev, st, ix, name, stage)
+		if res.Err == nil && !res.Skipped {
+			ix.Apps = append(ix.Apps, res.App)
+			// Saved after each app, so an interrupted run keeps what it pulled
+			if err := ix.Save(st); err != nil {
+				return results, err
+			}
+		}
+		if onResult != nil {
+			onResult(res)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func backupApp(dev Device, st storage.Storage, ix *Index, name, stage string) Result {
+	pkg, err := dev.PackageInfo(name)
+	app := App{Package: name, VersionName: pkg.VersionName, VersionCode: pkg.VersionCode}
+	if err != nil {
+		return Result{App: app, Err: err}
+	}
+	if ix.Has(name, pkg.VersionCode) {
+		return Result{App: app, Skipped: true}
+	}
+	dir := path.Join(Folder, name, strconv.FormatInt(pkg.VersionCode, 10))
+	for _, apk := range pkg.APKs {
+		local := filepath.Join(stage, path.Base(apk))
+		err := dev.Pull(apk, local)
+		if err == nil {
+			var size int64
+			size, err = putFile(st, path.Join(dir, path.Base(apk)), local)
+			app.Size += size
+		}
+		os.Remove(local)
+		if err != nil {
+			return Result{App: app, Err: fmt.Errorf("%s: %w", path.Base(apk), err)}
+		}
+		app.APKs = append(app.APKs, path.Join(dir, path.Base(apk)))
+	}
+	app.BackedUp = time.Now().Format("2006-01-02 15:04")
+	return Result{App: app}
+}
+
+func putFile(st storage.Storage, name, local string) (int64, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), st.Put(name, f, info.Size())
+}
+
+// Restore reinstalls the given app versions from st with install-multiple,
+// replacing installed versions. onResult, if not nil, is called after each app.
+func Restore(dev Device, st storage.Storage, apps []App, onResult func(Result)) []Result {
+	var results []Result
+	for _, app := range apps {
+		res := Result{App: app, Err: restoreApp(dev, st, app)}
+		if onResult != nil {
+			onResult(res)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func restoreApp(dev Device, st storage.Storage, app App) error {
+	if len(app.APKs) == 0 {
+		return errors.New("no APKs in the backup")
+	}
+	dir, err := os.MkdirTemp("", "android-safe-local-apk-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	var locals []string
+	for _, name := range app.APKs {
+		local := filepath.Join(dir, path.Base(name))
+		if err := getFile(st, name, local); err != nil {
+			return err
+		}
+		locals = append(locals, local)
+	}
+	return dev.InstallMultiple(locals)
+}
+
+func getFile(st storage.Storage, name, local string) error {
+	rc, err := st.Get(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,92 @@
+package apps
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/storage"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeDevice serves APKs whose content is their device path
+type fakeDevice struct {
+	pkgs      map[string]adb.Package
+	installed [][]string // Base names of each install-multiple call
+}
+
+func (d *fakeDevice) PackageInfo(name string) (adb.Package, error) {
+	p, ok := d.pkgs[name]
+	if !ok {
+		return adb.Package{}, errors.New(name + " is not installed")
+	}
+	return p, nil
+}
+
+func (d *fakeDevice) Pull(remotePath, localPath string) error {
+	return os.WriteFile(localPath, []byte(remotePath), 0644)
+}
+
+func (d *fakeDevice) InstallMultiple(apks []string) error {
+	var names []string
+	for _, apk := range apks {
+		data, err := os.ReadFile(apk)
+		if err != nil || string(data) == "" {
+			return errors.New("APK missing")
+		}
+		names = append(names, filepath.Base(apk))
+	}
+	d.installed = append(d.installed, names)
+	return nil
+}
+
+func TestBackupRestore(t *testing.T) {
+	dev := &fakeDevice{pkgs: map[string]adb.Package{
+		"org.example.chat": {Name: "org.example.chat", VersionName: "2.1", VersionCode: 21,
+			APKs: []string{"/data/app/chat/base.apk", "/data/app/chat/split_config.arm64_v8a.apk"}},
+		"org.example.notes": {Name: "org.example.notes", VersionName: "1.0", VersionCode: 10,
+			APKs: []string{"/data/app/notes/base.apk"}},
+	}}
+	st := storage.NewLocal(t.TempDir())
+
+	results, err := Backup(dev, st, []string{"org.example.chat", "org.example.notes", "org.example.gone"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].Err != nil || results[2].Err == nil {
+		t.Fatalf("Backup results = %+v", results)
+	}
+	if info, err := st.Stat("Apps/org.example.chat/21/split_config.arm64_v8a.apk"); err != nil || info.Size == 0 {
+		t.Errorf("Split APK not stored: %v", err)
+	}
+
+	// A second run skips the same version, a new version is added next to the old one
+	p := dev.pkgs["org.example.notes"]
+	p.VersionName, p.VersionCode = "1.1", 11
+	dev.pkgs["org.example.notes"] = p
+	results, _ = Backup(dev, st, []string{"org.example.chat", "org.example.notes"}, nil)
+	if !results[0].Skipped || results[1].Skipped {
+		t.Errorf("Second backup = %+v", results)
+	}
+
+	ix, err := Load(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Apps) != 3 {
+		t.Fatalf("Index has %d versions, want 3", len(ix.Apps))
+	}
+	latest := ix.Latest()
+	if len(latest) != 2 || latest[1].String() != "org.example.notes 1.1" {
+		t.Fatalf("Latest = %v", latest)
+	}
+
+	for _, res := range Restore(dev, st, latest, nil) {
+		if res.Err != nil {
+			t.Errorf("Restore %s: %v", res.App, res.Err)
+		}
+	}
+	if len(dev.installed) != 2 || len(dev.installed[0]) != 2 || dev.installed[0][0] != "base.apk" {
+		t.Errorf("Installed = %v", dev.installed)
+	}
+}
@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"AndroidSafeLocal/internal/manifest"
+)
+
+// Format is an archive container and compression
+type Format string
+
+const (
+	Tar     Format = "tar"
+	TarGzip Format = "tar.gz"
+	TarZstd Format = "tar.zst"
+	Zip     Format = "zip"
+)
+
+// Formats lists the supported formats, for flag help
+var Formats = []Format{Tar, TarGzip, TarZstd, Zip}
+
+// manifestName is the first member of every export, so import knows the
+// entries before the files arrive
+const manifestName = "manifest.json"
+
+// ParseFormat accepts a format name, also the common aliases tgz and tzst
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "tar":
+		return Tar, nil
+	case "tar.gz", "tgz", "gz", "gzip":
+		return TarGzip, nil
+	case "tar.zst", "tzst", "zst", "zstd":
+		return TarZstd, nil
+	case "zip":
+		return Zip, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q, use one of %v", s, Formats)
+}
+
+// FormatOf guesses the format from an archive's file name
+func FormatOf(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	for _, f := range []Format{TarGzip, TarZstd, Tar, Zip} {
+		if strings.HasSuffix(lower, "."+string(f)) {
+			return f, nil
+		}
+	}
+	for alias, f := range map[string]Format{".tgz": TarGzip, ".tzst": TarZstd} {
+		if strings.HasSuffix(lower, alias) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("cannot tell the archive format of %s, name it .tar, .tar.gz, .tar.zst or .zip", filepath.Base(name))
+}
+
+// Opener returns the content of a backup file
+type Opener func(e manifest.Entry) (io.ReadCloser, error)
+
+// FileOpener reads entries from the tree of a backup folder
+func FileOpener(root string) Opener {
+	return func(e manifest.Entry) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(root, e.LocalPath))
+	}
+}
+
+// Result counts what an export or import did
+type Result struct {
+	Files   int   // Files written
+	Bytes   int64 // Their total size
+	Skipped int   // Import: files already in the backup
+	Renamed int   // Import: files stored under a new name because theirs was taken
+}
+
+// Export streams entries into dst as an archive: the manifest of those
+// entries first, then each backup file once under its local path. Nothing is
+// staged on disk.
+func Export(dst io.Writer, format Format, entries []manifest.Entry, open Opener) (*Result, error) {
+	aw, err := newWriter(dst, format)
+	if err != nil {
+		return nil, err
+	}
+	m := manifest.New()
+	for _, e := range entries {
+		e.Hash = "" // Names content in the source repository only
+		e.LocalPath = filepath.ToSlash(e.LocalPath)
+		m.AddEntry(e)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := aw.add(manifestName, int64(len(data)), time.Now(), strings.NewReader(string(data))); err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	written := make(map[string]bool)
+	for _, e := range entries {
+		if written[e.LocalPath] {
+			continue // Device files deduplicated onto one backup copy
+		}
+		written[e.LocalPath] = true
+		if err := exportEntry(aw, e, open); err != nil {
+			return res, fmt.Errorf("%s: %w", e.LocalPath, err)
+		}
+		res.Files++
+		res.Bytes += e.Size
+	}
+	return res, aw.Close()
+}
+
+func exportEntry(aw *writer, e manifest.Entry, open Opener) error {
+	rc, err := open(e)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return aw.add(filepath.ToSlash(e.LocalPath), e.Size, modTime(e), rc)
+}
+
+// modTime is the capture time of an entry, used as the member's date
+func modTime(e manifest.Entry) time.Time {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", e.Timestamp, time.Local); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// writer adds members to a tar or zip stream
+type writer struct {
+	tw     *tar.Writer
+	zw     *zip.Writer
+	closer io.Closer // Compressor under the tar stream, if any
+}
+
+func newWriter(dst io.Writer, format Format) (*writer, error) {
+	switch format {
+	case Tar:
+		return &writer{tw: tar.NewWriter(dst)}, nil
+	case TarGzip:
+		gz := gzip.NewWriter(dst)
+		return &writer{tw: tar.NewWriter(gz), closer: gz}, nil
+	case TarZstd:
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return nil, err
+		}
+		return &writer{tw: tar.NewWriter(zw), closer: zw}, nil
+	case Zip:
+		return &writer{zw: zip.NewWriter(dst)}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// add writes one member of exactly size bytes
+func (w *writer) add(name string, size int64, modified time.Time, r io.Reader) error {
+	var dst io.Writer
+	if w.zw != nil {
+		h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified}
+		h.SetMode(0644)
+		var err error
+		if dst, err = w.zw.CreateHeader(h); err != nil {
+			return err
+		}
+	} else {
+		if err := w.tw.WriteHeader(&tar.Header{Name: name, Size: size, Mode: 0644, ModTime: modified, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		dst = w.tw
+	}
+	n, err := io.Copy(dst, io.LimitReader(r, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("size changed since the backup: %d bytes, manifest says %d", n, size)
+	}
+	return nil
+}
+
+func (w *writer) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+// memberPath validates an archive member name and returns it as a relative local path
+func memberPath(name string) (string, error) {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(name, `\`) || strings.Contains(name, ":") {
+		return "", fmt.Errorf("unsafe path %q in archive", name)
+	}
+	return filepath.FromSlash(clean), nil
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/repo"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		filepath.Join("2024", "01", "a.jpg"): "first photo",
+		filepath.Join("2024", "02", "b.mp4"): "a video",
+	}
+	var entries []manifest.Entry
+	for rel, content := range files {
+		p := filepath.Join(src, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, manifest.Entry{OriginalPath: "/sdcard/DCIM/" + filepath.Base(rel), LocalPath: rel, Size: int64(len(content)), Timestamp: "2024-01-05 10:00", Hash: "abc"})
+	}
+	// A second device file deduplicated onto the same copy
+	entries = append(entries, manifest.Entry{OriginalPath: "/sdcard/Download/a.jpg", LocalPath: entries[0].LocalPath, Size: entries[0].Size})
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "export."+string(format))
+			out, err := os.Create(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := Export(out, format, entries, FileOpener(src))
+			out.Close()
+			if err != nil || res.Files != 2 {
+				t.Fatalf("Export = %+v, %v", res, err)
+			}
+			if f, err := FormatOf(archivePath); err != nil || f != format {
+				t.Errorf("FormatOf = %s, %v", f, err)
+			}
+
+			// The destination already has another a.jpg in the same month
+			dest := t.TempDir()
+			taken := filepath.Join(dest, "2024", "01", "a.jpg")
+			os.MkdirAll(filepath.Dir(taken), 0755)
+			os.WriteFile(taken, []byte("other"), 0644)
+
+			m := manifest.New()
+			res, err = ImportFile(archivePath, format, dest, m)
+			if err != nil || res.Files != 2 || res.Renamed != 1 {
+				t.Fatalf("Import = %+v, %v", res, err)
+			}
+			if len(m.Entries) != 3 {
+				t.Fatalf("Expected 3 manifest entries, got %+v", m.Entries)
+			}
+			for _, e := range m.Entries {
+				if e.Hash != "" {
+					t.Errorf("%s kept the source repository hash", e.LocalPath)
+				}
+			}
+			renamed := filepath.Join("2024", "01", "a_1.jpg")
+			if data, err := os.ReadFile(filepath.Join(dest, renamed)); err != nil || string(data) != "first photo" {
+				t.Errorf("%s = %q, %v", renamed, data, err)
+			}
+			if data, _ := os.ReadFile(taken); string(data) != "other" {
+				t.Error("Existing file overwritten")
+			}
+
+			// Importing again finds everything in place
+			res, err = ImportFile(archivePath, format, dest, m)
+			if err != nil || res.Files != 0 || res.Skipped != 2 {
+				t.Errorf("Second import = %+v, %v", res, err)
+			}
+
+			// Into an encrypted repository every entry of a shared copy gets its object
+			encDest := t.TempDir()
+			r, err := repo.InitEncrypted(encDest, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			em := manifest.New()
+			if _, err := ImportFile(archivePath, format, encDest, em); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := r.Import(em); err != nil || n != 3 {
+				t.Fatalf("Repository import = %d, %v; want 3 entries", n, err)
+			}
+			for _, e := range em.Entries {
+				rc, err := r.OpenEntry(e)
+				if err != nil {
+					t.Errorf("%s (%s) unreadable: %v", e.OriginalPath, e.LocalPath, err)
+					continue
+				}
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				if want := files[e.LocalPath]; string(data) != want {
+					t.Errorf("%s = %q, want %q", e.OriginalPath, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemberPath(t *testing.T) {
+	for _, bad := range []string{"../evil", "/etc/passwd", "a/../../b", `..\evil`, "C:/Windows", ""} {
+		if _, err := memberPath(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+	if p, err := memberPath("2024/01/a.jpg"); err != nil || p != filepath.Join("2024", "01", "a.jpg") {
+		t.Errorf("memberPath = %q, %v", p, err)
+	}
+}
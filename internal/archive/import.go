@@ -0,0 +1,236 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"AndroidSafeLocal/internal/manifest"
+)
+
+// ErrNotExport is returned for archives that weren't written by Export
+var ErrNotExport = errors.New("not a backup export: " + manifestName + " must be its first member")
+
+// Import unpacks a tar export read from src into the backup folder root,
+// writing each member straight to its place. The archive's entries are added
+// to m, the manifest of root; save it afterwards. Files already in the backup
+// are skipped and names taken by other files get a _1, _2... suffix.
+// Zip archives need random access, use ImportFile.
+func Import(src io.Reader, format Format, root string, m *manifest.Manifest) (*Result, error) {
+	var r io.Reader
+	switch format {
+	case Tar:
+		r = src
+	case TarGzip:
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case TarZstd:
+		zr, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case Zip:
+		return nil, errors.New("zip archives can't be streamed, import them from a file")
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+
+	tr := tar.NewReader(r)
+	h, err := tr.Next()
+	if err != nil || h.Name != manifestName {
+		return nil, ErrNotExport
+	}
+	im, err := newImporter(root, m, tr)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return &im.res, nil
+		}
+		if err != nil {
+			return &im.res, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := im.file(h.Name, h.ModTime, tr); err != nil {
+			return &im.res, err
+		}
+	}
+}
+
+// ImportFile imports the archive at path, see Import
+func ImportFile(path string, format Format, root string, m *manifest.Manifest) (*Result, error) {
+	if format != Zip {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return Import(f, format, root, m)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	if len(zr.File) == 0 || zr.File[0].Name != manifestName {
+		return nil, ErrNotExport
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	im, err := newImporter(root, m, rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File[1:] {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return &im.res, err
+		}
+		err = im.file(f.Name, f.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return &im.res, err
+		}
+	}
+	return &im.res, nil
+}
+
+type importer struct {
+	root     string
+	m        *manifest.Manifest
+	incoming map[string][]manifest.Entry // Archive manifest by local path
+	existing map[string]manifest.Entry   // Backup manifest by local path
+	known    map[string]bool             // Device files the backup has, by original path and size
+	res      Result
+}
+
+func newImporter(root string, m *manifest.Manifest, manifestData io.Reader) (*importer, error) {
+	var archived manifest.Manifest
+	if err := json.NewDecoder(manifestData).Decode(&archived); err != nil {
+		return nil, fmt.Errorf("%s in archive: %w", manifestName, err)
+	}
+	im := &importer{
+		root:     root,
+		m:        m,
+		incoming: make(map[string][]manifest.Entry),
+		existing: make(map[string]manifest.Entry, len(m.Entries)),
+		known:    make(map[string]bool, len(m.Entries)),
+	}
+	for _, e := range archived.Entries {
+		e.LocalPath = filepath.FromSlash(e.LocalPath)
+		im.incoming[e.LocalPath] = append(im.incoming[e.LocalPath], e)
+	}
+	for _, e := range m.Entries {
+		im.existing[e.LocalPath] = e
+		im.known[knownKey(e)] = true
+	}
+	return im, nil
+}
+
+// file stores one archive member and records its entries
+func (im *importer) file(name string, modified time.Time, r io.Reader) error {
+	rel, err := memberPath(name)
+	if err != nil {
+		return err
+	}
+	entries := im.incoming[rel]
+	if len(entries) == 0 {
+		return nil // Not listed in the archive's manifest
+	}
+	first := entries[0]
+	if im.known[knownKey(first)] {
+		im.res.Skipped++ // Backed up already, possibly under another name
+		return nil
+	}
+	target := im.freePath(rel)
+	if target != rel {
+		im.res.Renamed++
+	}
+
+	dest := filepath.Join(im.root, target)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".partial"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != first.Size {
+		err = fmt.Errorf("%s: %d bytes in the archive, manifest says %d", rel, n, first.Size)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	os.Chtimes(dest, modified, modified)
+
+	for _, e := range entries {
+		e.LocalPath = target
+		im.m.AddEntry(e)
+	}
+	im.existing[target] = first
+	for _, e := range entries {
+		im.known[knownKey(e)] = true
+	}
+	im.res.Files++
+	im.res.Bytes += n
+	return nil
+}
+
+// freePath returns rel, or rel with _1, _2... before the extension while the
+// name is in the backup manifest or on disk
+func (im *importer) freePath(rel string) string {
+	taken := func(p string) bool {
+		if _, ok := im.existing[p]; ok {
+			return true
+		}
+		_, err := os.Stat(filepath.Join(im.root, p))
+		return err == nil
+	}
+	ext := filepath.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	candidate := rel
+	for i := 1; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	return candidate
+}
+
+func knownKey(e manifest.Entry) string {
+	return fmt.Sprintf("%s|%d", e.OriginalPath, e.Size)
+}
@@ -0,0 +1,38 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+// ErrLowBattery is returned by BatteryCheck.Check when a backup must not start
+var ErrLowBattery = errors.New("battery too low")
+
+// BatteryCheck keeps a long backup from draining the phone until it shuts off
+// half way. A charging device always passes.
+type BatteryCheck struct {
+	Warn   int // Warn below this level in percent
+	Refuse int // Refuse to start below this level, 0 never refuses
+}
+
+// DefaultBatteryCheck warns below 30% and refuses below 15%
+func DefaultBatteryCheck() BatteryCheck {
+	return BatteryCheck{Warn: 30, Refuse: 15}
+}
+
+// Check returns a warning to show, or ErrLowBattery if the backup should not
+// start. An unknown level passes without warning.
+func (b BatteryCheck) Check(info adb.DeviceInfo) (warning string, err error) {
+	if info.Charging || info.BatteryLevel < 0 {
+		return "", nil
+	}
+	if info.BatteryLevel < b.Refuse {
+		return "", fmt.Errorf("%w: %d%%, connect the charger (at least %d%% needed)", ErrLowBattery, info.BatteryLevel, b.Refuse)
+	}
+	if info.BatteryLevel < b.Warn {
+		return fmt.Sprintf("Battery at %d%% and not charging, connect the charger for a long backup", info.BatteryLevel), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+func TestBatteryCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     adb.DeviceInfo
+		wantWarn bool
+		wantErr  bool
+	}{
+		{"Full", adb.DeviceInfo{BatteryLevel: 90}, false, false},
+		{"Low", adb.DeviceInfo{BatteryLevel: 20}, true, false},
+		{"Critical", adb.DeviceInfo{BatteryLevel: 9}, false, true},
+		{"Critical But Charging", adb.DeviceInfo{BatteryLevel: 9, Charging: true}, false, false},
+		{"Unknown", adb.DeviceInfo{BatteryLevel: -1}, false, false},
+	}
+	for _, tt := range tests {
+		warning, err := DefaultBatteryCheck().Check(tt.info)
+		if (warning != "") != tt.wantWarn || (err != nil) != tt.wantErr {
+			t.Errorf("%s: warning %q, error %v", tt.name, warning, err)
+		}
+		if err != nil && !errors.Is(err, ErrLowBattery) {
+			t.Errorf("%s: expected ErrLowBattery, got %v", tt.name, err)
+		}
+	}
+	if _, err := (BatteryCheck{}).Check(adb.DeviceInfo{BatteryLevel: 1}); err != nil {
+		t.Errorf("Disabled check refused: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides what restore does when the target already exists on the device
+type ConflictPolicy int
+
+const (
+	ConflictOverwrite     ConflictPolicy = iota // Always push, the behaviour before conflict checks
+	ConflictSkipIdentical                       // Skip files already identical on the device, overwrite the rest
+	ConflictKeepNewer                           // Like SkipIdentical, but keep device files changed after the backup
+	ConflictRename                              // Push differing files next to the device copy under a new name
+)
+
+// ConflictPolicies lists the policies in the order UIs offer them
+var ConflictPolicies = []ConflictPolicy{ConflictSkipIdentical, ConflictKeepNewer, ConflictRename, ConflictOverwrite}
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictSkipIdentical:
+		return "skip-identical"
+	case ConflictKeepNewer:
+		return "keep-newer"
+	case ConflictRename:
+		return "rename"
+	}
+	return "overwrite"
+}
+
+// ParseConflictPolicy parses the String form of a policy
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, p := range append(ConflictPolicies, ConflictOverwrite) {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return ConflictOverwrite, fmt.Errorf("unknown conflict policy %q (skip-identical, keep-newer, rename, overwrite)", s)
+}
+
+// RestoreAction is what restore does with one file
+type RestoreAction int
+
+const (
+	RestorePush          RestoreAction = iota // Nothing on the device yet
+	RestoreOverwrite                          // Replaces a different device file
+	RestoreRename                             // Pushed under a new name beside the device file
+	RestoreSkipIdentical                      // Device already has the same file
+	RestoreKeepDevice                         // Device copy is newer and kept
+)
+
+func (a RestoreAction) String() string {
+	switch a {
+	case RestoreOverwrite:
+		return "overwrite"
+	case RestoreRename:
+		return "rename"
+	case RestoreSkipIdentical:
+		return "identical"
+	case RestoreKeepDevice:
+		return "keep-device"
+	}
+	return "push"
+}
+
+// Pushes reports whether the action writes to the device
+func (a RestoreAction) Pushes() bool {
+	return a == RestorePush || a == RestoreOverwrite || a == RestoreRename
+}
+
+// RestoreDecision is what restore will do, or did, with one job
+type RestoreDecision struct {
+	Job    RestoreJob
+	Action RestoreAction
+	Target string // Device path written, differs from Job.OriginalPath on rename
+	Reason string
+}
+
+// deviceFiles is the part of adb.Client used to inspect restore targets
+type deviceFiles interface {
+	StatMany(paths []string) (map[string]adb.RemoteStat, error)
+	Hash(path string) (string, error)
+}
+
+// mtimeTolerance absorbs the minute precision of manifest timestamps
+const mtimeTolerance = time.Minute
+
+// ConflictChecker inspects restore targets on the device and applies a policy
+type ConflictChecker struct {
+	device deviceFiles
+	policy ConflictPolicy
+	hash   bool
+}
+
+// NewConflictChecker creates a checker. With hash set, files of equal size are
+// compared by SHA-256 instead of by modification time, which is slower but exact.
+func NewConflictChecker(client *adb.Client, policy ConflictPolicy, hash bool) *ConflictChecker {
+	return &ConflictChecker{device: client, policy: policy, hash: hash}
+}
+
+// Decide stats the job's target and returns what to do with it
+func (cc *ConflictChecker) Decide(job RestoreJob) (RestoreDecision, error) {
+	stats, err := cc.device.StatMany([]string{job.OriginalPath})
+	if err != nil {
+		return RestoreDecision{}, err
+	}
+	d := cc.decide(job, stats[job.OriginalPath])
+	if d.Action == RestoreRename {
+		d.Target, err = cc.freeName(job.OriginalPath)
+	}
+	return d, err
+}
+
+// Plan decides every job without pushing anything, for a dry-run report.
+// Rename targets are the first candidate name and may still be adjusted at restore time.
+func (cc *ConflictChecker) Plan(jobs []RestoreJob) ([]RestoreDecision, error) {
+	paths := make([]string, len(jobs))
+	for i, job := range jobs {
+		paths[i] = job.OriginalPath
+	}
+	stats, err := cc.device.StatMany(paths)
+	if err != nil {
+		return nil, err
+	}
+	decisions := make([]RestoreDecision, len(jobs))
+	for i, job := range jobs {
+		decisions[i] = cc.decide(job, stats[job.OriginalPath])
+	}
+	return decisions, nil
+}
+
+// decide applies the policy to a job and the stat of its target
+func (cc *ConflictChecker) decide(job RestoreJob, remote adb.RemoteStat) RestoreDecision {
+	d := RestoreDecision{Job: job, Action: RestorePush, Target: job.OriginalPath}
+	if !remote.Exists {
+		return d
+	}
+	if cc.policy == ConflictOverwrite {
+		d.Action = RestoreOverwrite
+		return d
+	}
+
+	backupTime, timeKnown := parseTimestamp(job.Timestamp)
+	if remote.Size == job.Size {
+		identical := timeKnown && absDuration(remote.ModTime.Sub(backupTime)) <= mtimeTolerance
+		reason := "same size and time"
+		if cc.hash {
+			identical = cc.sameContent(job)
+			reason = "same content"
+		}
+		if identical {
+			d.Action = RestoreSkipIdentical
+			d.Reason = reason
+			return d
+		}
+	}
+
+	switch {
+	case cc.policy == ConflictKeepNewer && timeKnown && remote.ModTime.After(backupTime.Add(mtimeTolerance)):
+		d.Action = RestoreKeepDevice
+		d.Reason = "device copy modified " + remote.ModTime.Format("2006-01-02 15:04")
+	case cc.policy == ConflictRename:
+		d.Action = RestoreRename
+		d.Target = renamed(job.OriginalPath, 1)
+		d.Reason = "device copy differs"
+	default:
+		d.Action = RestoreOverwrite
+		d.Reason = "device copy differs"
+	}
+	return d
+}
+
+// sameContent compares the hashes of the backup file and the device file
+func (cc *ConflictChecker) sameContent(job RestoreJob) bool {
+	local, err := HashFile(job.LocalPath)
+	if err != nil {
+		return false
+	}
+	remote, err := cc.device.Hash(job.OriginalPath)
+	return err == nil && local == remote
+}
+
+// freeName finds the first "name (restored N).ext" not taken on the device
+func (cc *ConflictChecker) freeName(original string) (string, error) {
+	candidates := make([]string, 10)
+	for i := range candidates {
+		candidates[i] = renamed(original, i+1)
+	}
+	stats, err := cc.device.StatMany(candidates)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range candidates {
+		if !stats[c].Exists {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %s", original)
+}
+
+// renamed returns "dir/name (restored).ext", numbered from the second candidate on
+func renamed(original string, n int) string {
+	ext := path.Ext(original)
+	base := strings.TrimSuffix(original, ext)
+	if n == 1 {
+		return base + " (restored)" + ext
+	}
+	return fmt.Sprintf("%s (restored %d)%s", base, n, ext)
+}
+
+// parseTimestamp reads a manifest timestamp, which is in the device's local time
+func parseTimestamp(ts string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02 15:04", ts, time.Local)
+	return t, err == nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// SummarizeDecisions counts decisions per action, e.g. "push: 10, identical: 250"
+func SummarizeDecisions(decisions []RestoreDecision) string {
+	counts := make(map[RestoreAction]int)
+	for _, d := range decisions {
+		counts[d.Action]++
+	}
+	var parts []string
+	for _, a := range []RestoreAction{RestorePush, RestoreOverwrite, RestoreRename, RestoreSkipIdentical, RestoreKeepDevice} {
+		if counts[a] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", a, counts[a]))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing to restore"
+	}
+	return strings.Join(parts, ", ")
+}
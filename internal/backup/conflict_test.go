@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeDevice serves stats and hashes from maps
+type fakeDevice struct {
+	stats  map[string]adb.RemoteStat
+	hashes map[string]string
+}
+
+func (f *fakeDevice) StatMany(paths []string) (map[string]adb.RemoteStat, error) {
+	out := make(map[string]adb.RemoteStat)
+	for _, p := range paths {
+		out[p] = f.stats[p]
+	}
+	return out, nil
+}
+
+func (f *fakeDevice) Hash(path string) (string, error) {
+	return f.hashes[path], nil
+}
+
+func TestConflictDecisions(t *testing.T) {
+	backupTime := time.Date(2024, 3, 5, 10, 10, 0, 0, time.Local)
+	job := func(name string, size int64) RestoreJob {
+		return RestoreJob{OriginalPath: "/sdcard/DCIM/" + name, Size: size, Timestamp: backupTime.Format("2006-01-02 15:04")}
+	}
+	dev := &fakeDevice{stats: map[string]adb.RemoteStat{
+		"/sdcard/DCIM/same.jpg":             {Exists: true, Size: 100, ModTime: backupTime.Add(20 * time.Second)},
+		"/sdcard/DCIM/edited.jpg":           {Exists: true, Size: 150, ModTime: backupTime.Add(48 * time.Hour)},
+		"/sdcard/DCIM/old.jpg":              {Exists: true, Size: 90, ModTime: backupTime.Add(-48 * time.Hour)},
+		"/sdcard/DCIM/taken.jpg":            {Exists: true, Size: 1, ModTime: backupTime},
+		"/sdcard/DCIM/taken (restored).jpg": {Exists: true},
+	}}
+	jobs := []RestoreJob{job("new.jpg", 100), job("same.jpg", 100), job("edited.jpg", 100), job("old.jpg", 100)}
+
+	tests := []struct {
+		policy ConflictPolicy
+		want   []RestoreAction
+	}{
+		{ConflictOverwrite, []RestoreAction{RestorePush, RestoreOverwrite, RestoreOverwrite, RestoreOverwrite}},
+		{ConflictSkipIdentical, []RestoreAction{RestorePush, RestoreSkipIdentical, RestoreOverwrite, RestoreOverwrite}},
+		{ConflictKeepNewer, []RestoreAction{RestorePush, RestoreSkipIdentical, RestoreKeepDevice, RestoreOverwrite}},
+		{ConflictRename, []RestoreAction{RestorePush, RestoreSkipIdentical, RestoreRename, RestoreRename}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			cc := &ConflictChecker{device: dev, policy: tt.policy}
+			decisions, err := cc.Plan(jobs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, d := range decisions {
+				if d.Action != tt.want[i] {
+					t.Errorf("%s: action %s, want %s", jobs[i].OriginalPath, d.Action, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Rename skips candidate names already on the device
+	cc := &ConflictChecker{device: dev, policy: ConflictRename}
+	d, err := cc.Decide(job("taken.jpg", 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Target != "/sdcard/DCIM/taken (restored 2).jpg" {
+		t.Errorf("Rename target = %s", d.Target)
+	}
+}
+
+func TestConflictHashCompare(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(local, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := HashFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and content but a different time: only the hash proves them identical
+	dev := &fakeDevice{
+		stats:  map[string]adb.RemoteStat{"/sdcard/a.jpg": {Exists: true, Size: 5, ModTime: time.Now()}},
+		hashes: map[string]string{"/sdcard/a.jpg": sum},
+	}
+	j := RestoreJob{LocalPath: local, OriginalPath: "/sdcard/a.jpg", Size: 5, Timestamp: "2020-01-01 00:00"}
+
+	withoutHash := &ConflictChecker{device: dev, policy: ConflictSkipIdentical}
+	if d, _ := withoutHash.Decide(j); d.Action != RestoreOverwrite {
+		t.Errorf("Without hash: %s, want overwrite", d.Action)
+	}
+	withHash := &ConflictChecker{device: dev, policy: ConflictSkipIdentical, hash: true}
+	if d, _ := withHash.Decide(j); d.Action != RestoreSkipIdentical {
+		t.Errorf("With hash: %s, want identical", d.Action)
+	}
+}
@@ -0,0 +1,328 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FreeUpPolicy decides which backed up files may be deleted from the device
+type FreeUpPolicy struct {
+	MinAge    time.Duration // Only files last modified at least this long ago, 0 for any age
+	Protected []string      // Device folders nothing is deleted from, besides AlwaysProtected
+}
+
+// AlwaysProtected are the folders free up never deletes from, whatever the
+// policy: the app folders under Android/
+var AlwaysProtected = []string{"/sdcard/Android"}
+
+// DefaultFreeUpPolicy keeps the last 30 days on the phone
+func DefaultFreeUpPolicy() FreeUpPolicy {
+	return FreeUpPolicy{MinAge: 30 * 24 * time.Hour}
+}
+
+// ParseProtected splits protected folders separated by commas or new lines
+func ParseProtected(spec string) []string {
+	var paths []string
+	for _, p := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if p = cleanRoot(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// primaryStorage is how internal storage of user 0 is written out in full;
+// /sdcard and /storage/self/primary are aliases of it
+const primaryStorage = "/storage/emulated/0"
+
+// canonicalPath rewrites the aliases of internal storage so protected folders
+// match however the backup source was spelled
+func canonicalPath(p string) string {
+	for _, alias := range []string{"/sdcard", "/storage/self/primary", "/mnt/sdcard"} {
+		if p == alias || strings.HasPrefix(p, alias+"/") {
+			return primaryStorage + strings.TrimPrefix(p, alias)
+		}
+	}
+	return p
+}
+
+// protects reports whether p is in one of the protected folders
+func (fp FreeUpPolicy) protects(p string) bool {
+	p = canonicalPath(p)
+	for _, root := range append(slices.Clone(AlwaysProtected), fp.Protected...) {
+		root = canonicalPath(root)
+		if p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FreeUpCandidates returns the entries under the device folder prefix that
+// free up has not deleted yet; an empty prefix takes the whole manifest
+func FreeUpCandidates(m *manifest.Manifest, prefix string) []manifest.Entry {
+	deleted := make(map[string]bool, len(m.Deletions))
+	for _, d := range m.Deletions {
+		deleted[d.LocalPath] = true
+	}
+	var entries []manifest.Entry
+	for _, e := range m.Select(manifest.Query{PathPrefix: prefix}) {
+		if !deleted[e.LocalPath] {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Reasons a backed up file stays on the device
+const (
+	KeepProtected    = "protected folder"
+	KeepTooNew       = "too new"
+	KeepGone         = "no longer on the device"
+	KeepChanged      = "changed on the device since the backup"
+	KeepNoBackup     = "backup copy missing"
+	KeepDiffers      = "content differs from the backup"
+	KeepUnverifiable = "cannot hash"
+)
+
+// FreeUpItem is the decision for one backed up file
+type FreeUpItem struct {
+	Entry   manifest.Entry
+	Delete  bool
+	Hash    string    // Content hash both copies have, when Delete is set (see CopyChecker)
+	ModTime time.Time // Modification time of the device file the hash was taken of
+	Reason  string    // Why the file stays (one of the Keep constants), with detail
+}
+
+// CopyChecker reads the backup side of a free up. Both hashes are of the
+// same kind: SHA-256, or the keyed content ID of an encrypted repository.
+type CopyChecker interface {
+	// StoredHash reads the backup copy of e and returns the hash of its content
+	StoredHash(e manifest.Entry) (string, error)
+	// DeviceHash hashes a device file the way StoredHash does
+	DeviceHash(path string) (string, error)
+}
+
+// StorageCopies checks the copies of a plain backup folder, local or remote,
+// by their SHA-256
+type StorageCopies struct {
+	Storage storage.Storage
+	Device  deviceFiles
+}
+
+// StoredHash hashes the file at the entry's local path
+func (sc StorageCopies) StoredHash(e manifest.Entry) (string, error) {
+	return hashStored(sc.Storage, e.LocalPath)
+}
+
+// DeviceHash hashes the device file on the device
+func (sc StorageCopies) DeviceHash(path string) (string, error) {
+	return sc.Device.Hash(path)
+}
+
+// PlanFreeUp checks backed up files against the device and the backup: a file
+// may go when it is old enough, outside the protected folders, unchanged on
+// the device and its content hash matches the copy copies reads back.
+func PlanFreeUp(device deviceFiles, copies CopyChecker, entries []manifest.Entry, policy FreeUpPolicy, now time.Time) ([]FreeUpItem, error) {
+	// A file backed up again after it changed has several entries, the last one is current
+	latest := make(map[string]int, len(entries))
+	for i, e := range entries {
+		latest[e.OriginalPath] = i
+	}
+	var items []FreeUpItem
+	for i, e := range entries {
+		if latest[e.OriginalPath] == i {
+			items = append(items, FreeUpItem{Entry: e})
+		}
+	}
+	var paths []string
+	for i, it := range items {
+		e := it.Entry
+		if policy.protects(e.OriginalPath) {
+			items[i].Reason = KeepProtected
+			continue
+		}
+		paths = append(paths, e.OriginalPath)
+	}
+	stats, err := device.StatMany(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		item := &items[i]
+		if item.Reason != "" {
+			continue
+		}
+		e := item.Entry
+		remote := stats[e.OriginalPath]
+		switch {
+		case !remote.Exists:
+			item.Reason = KeepGone
+			continue
+		case remote.Size != e.Size:
+			item.Reason = fmt.Sprintf("%s (%s, backed up %s)", KeepChanged, FormatBytes(remote.Size), FormatBytes(e.Size))
+			continue
+		case policy.MinAge > 0 && now.Sub(remote.ModTime) < policy.MinAge:
+			item.Reason = fmt.Sprintf("%s (modified %s)", KeepTooNew, remote.ModTime.Format("2006-01-02"))
+			continue
+		}
+
+		local, err := copies.StoredHash(e)
+		if err != nil {
+			item.Reason = KeepNoBackup + ": " + err.Error()
+			continue
+		}
+		deviceHash, err := copies.DeviceHash(e.OriginalPath)
+		if err != nil {
+			item.Reason = KeepUnverifiable + ": " + err.Error()
+			continue
+		}
+		if deviceHash != local {
+			item.Reason = KeepDiffers
+			continue
+		}
+		item.Delete, item.Hash, item.ModTime = true, local, remote.ModTime
+	}
+	return items, nil
+}
+
+// hashStored returns the SHA-256 of a backup file in st
+func hashStored(st storage.Storage, localPath string) (string, error) {
+	r, err := st.Get(filepath.ToSlash(localPath))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FreeUpSummary counts a plan, e.g. "120 files to delete (3.2 GB), 40 kept: 30 too new, 10 protected folder"
+func FreeUpSummary(items []FreeUpItem) string {
+	var n int
+	var size int64
+	kept := make(map[string]int)
+	var reasons []string
+	for _, it := range items {
+		if it.Delete {
+			n++
+			size += it.Entry.Size
+			continue
+		}
+		reason, _, _ := strings.Cut(it.Reason, " (")
+		reason, _, _ = strings.Cut(reason, ": ")
+		if kept[reason] == 0 {
+			reasons = append(reasons, reason)
+		}
+		kept[reason]++
+	}
+	s := fmt.Sprintf("%d files to delete (%s)", n, FormatBytes(size))
+	if len(items) > n {
+		parts := make([]string, len(reasons))
+		for i, r := range reasons {
+			parts[i] = fmt.Sprintf("%d %s", kept[r], r)
+		}
+		s += fmt.Sprintf(", %d kept: %s", len(items)-n, strings.Join(parts, ", "))
+	}
+	return s
+}
+
+// freeUpDevice is the part of adb.Client that deletes files
+type freeUpDevice interface {
+	StatMany(paths []string) (map[string]adb.RemoteStat, error)
+	Remove(path string) error
+	ScanMedia(paths []string) error
+}
+
+// freeUpSaveEvery saves the deletion log while a long run goes on
+const freeUpSaveEvery = 100
+
+// FreeUp deletes the files a plan cleared from the device, logs each one in
+// the manifest and saves it to st, encrypted with sealer if it is not nil,
+// also every freeUpSaveEvery files so the log
+// survives an interrupted run. m should be freshly loaded from st: files whose
+// entry is no longer in it, e.g. pruned since the plan, stay on the device, and
+// so do files whose size or modification time changed since they were hashed.
+// onDeleted, if not nil, is called per file. Files that fail to delete are
+// skipped; the errors are returned together.
+func FreeUp(device freeUpDevice, m *manifest.Manifest, st storage.Storage, sealer manifest.Sealer, items []FreeUpItem, now time.Time, onDeleted func(item FreeUpItem, err error)) (deleted int, freed int64, err error) {
+	var errs []error
+	var removed []string
+	backedUp := make(map[manifest.Entry]bool, len(m.Entries))
+	for _, e := range m.Select(manifest.Query{}) {
+		backedUp[e] = true
+	}
+	// The list may have waited for confirmation for a long time: an edited
+	// file's new content is not in the backup
+	var paths []string
+	for _, it := range items {
+		if it.Delete {
+			paths = append(paths, it.Entry.OriginalPath)
+		}
+	}
+	stats, err := device.StatMany(paths)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot check the files again before deleting: %w", err)
+	}
+	for _, it := range items {
+		if !it.Delete {
+			continue
+		}
+		var rmErr error
+		remote := stats[it.Entry.OriginalPath]
+		switch {
+		case !backedUp[it.Entry]:
+			rmErr = errors.New("no longer in the backup manifest")
+		case !remote.Exists || remote.Size != it.Entry.Size || !remote.ModTime.Equal(it.ModTime):
+			rmErr = errors.New("changed on the device since it was checked")
+		default:
+			rmErr = device.Remove(it.Entry.OriginalPath)
+		}
+		if onDeleted != nil {
+			onDeleted(it, rmErr)
+		}
+		if rmErr != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", it.Entry.OriginalPath, rmErr))
+			continue
+		}
+		m.AddDeletion(manifest.Deletion{
+			OriginalPath: it.Entry.OriginalPath,
+			LocalPath:    it.Entry.LocalPath,
+			Size:         it.Entry.Size,
+			Hash:         it.Hash,
+			Deleted:      now.Format("2006-01-02 15:04"),
+		})
+		removed = append(removed, it.Entry.OriginalPath)
+		deleted++
+		freed += it.Entry.Size
+		if deleted%freeUpSaveEvery == 0 {
+			if err := m.SaveTo(st, sealer); err != nil {
+				return deleted, freed, fmt.Errorf("failed to save the deletion log, stopped: %w", err)
+			}
+		}
+	}
+	if err := m.SaveTo(st, sealer); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save the deletion log: %w", err))
+	}
+	// Drop the deleted files from the gallery's index
+	if len(removed) > 0 {
+		if err := device.ScanMedia(removed); err != nil {
+			errs = append(errs, fmt.Errorf("media rescan: %w", err))
+		}
+	}
+	return deleted, freed, errors.Join(errs...)
+}
@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/snapshot"
+	"AndroidSafeLocal/internal/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRemover records deletions, failing for paths in fail; the device
+// files are as in stats
+type fakeRemover struct {
+	fakeDevice
+	removed []string
+	scanned []string
+	fail    map[string]bool
+}
+
+func (f *fakeRemover) Remove(path string) error {
+	if f.fail[path] {
+		return errors.New("rm: Read-only file system")
+	}
+	f.removed = append(f.removed, path)
+	return nil
+}
+
+func (f *fakeRemover) ScanMedia(paths []string) error {
+	f.scanned = append(f.scanned, paths...)
+	return nil
+}
+
+func TestFreeUp(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	old := now.Add(-90 * 24 * time.Hour)
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	st := storage.NewLocal(t.TempDir())
+	m := manifest.New()
+	files := map[string]string{"a.jpg": "aaaa", "new.jpg": "nnnn", "edited.jpg": "eeee", "bad.jpg": "bbbb", "app.db": "dddd"}
+	for name, content := range files {
+		if err := st.Put("2024/03/"+name, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Add("/sdcard/DCIM/a.jpg", "2024/03/a.jpg", 4, "2024-03-01 10:00")
+	m.Add("/sdcard/DCIM/new.jpg", "2024/03/new.jpg", 4, "2024-05-30 10:00")
+	m.Add("/sdcard/DCIM/edited.jpg", "2024/03/edited.jpg", 4, "2024-03-01 10:00")
+	m.Add("/sdcard/DCIM/bad.jpg", "2024/03/bad.jpg", 4, "2024-03-01 10:00")
+	m.Add("/sdcard/DCIM/gone.jpg", "2024/03/gone.jpg", 4, "2024-03-01 10:00")
+	m.Add("/sdcard/DCIM/lost.jpg", "2024/03/lost.jpg", 4, "2024-03-01 10:00")
+	m.Add("/storage/emulated/0/Android/media/app.db", "2024/03/app.db", 4, "2024-03-01 10:00")
+	dev := &fakeDevice{
+		stats: map[string]adb.RemoteStat{
+			"/sdcard/DCIM/a.jpg":      {Exists: true, Size: 4, ModTime: old},
+			"/sdcard/DCIM/new.jpg":    {Exists: true, Size: 4, ModTime: now.Add(-48 * time.Hour)},
+			"/sdcard/DCIM/edited.jpg": {Exists: true, Size: 5, ModTime: old},
+			"/sdcard/DCIM/bad.jpg":    {Exists: true, Size: 4, ModTime: old},
+			"/sdcard/DCIM/lost.jpg":   {Exists: true, Size: 4, ModTime: old},
+		},
+		hashes: map[string]string{"/sdcard/DCIM/a.jpg": sum("aaaa"), "/sdcard/DCIM/bad.jpg": sum("xxxx")},
+	}
+
+	items, err := PlanFreeUp(dev, StorageCopies{Storage: st, Device: dev}, m.Entries, DefaultFreeUpPolicy(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/sdcard/DCIM/a.jpg":                       "",
+		"/sdcard/DCIM/new.jpg":                     KeepTooNew,
+		"/sdcard/DCIM/edited.jpg":                  KeepChanged,
+		"/sdcard/DCIM/bad.jpg":                     KeepDiffers,
+		"/sdcard/DCIM/gone.jpg":                    KeepGone,
+		"/sdcard/DCIM/lost.jpg":                    KeepNoBackup,
+		"/storage/emulated/0/Android/media/app.db": KeepProtected,
+	}
+	for _, it := range items {
+		reason := want[it.Entry.OriginalPath]
+		if it.Delete != (reason == "") || !strings.HasPrefix(it.Reason, reason) {
+			t.Errorf("%s: Delete %v, Reason %q, want %q", it.Entry.OriginalPath, it.Delete, it.Reason, reason)
+		}
+	}
+	if s := FreeUpSummary(items); !strings.HasPrefix(s, "1 files to delete (4 B), 6 kept: ") {
+		t.Errorf("FreeUpSummary = %q", s)
+	}
+
+	rm := &fakeRemover{fakeDevice: *dev}
+	deleted, freed, err := FreeUp(rm, m, st, nil, items, now, nil)
+	if err != nil || deleted != 1 || freed != 4 {
+		t.Fatalf("FreeUp = %d, %d, %v", deleted, freed, err)
+	}
+	if len(rm.removed) != 1 || rm.removed[0] != "/sdcard/DCIM/a.jpg" || len(rm.scanned) != 1 {
+		t.Errorf("removed %q, scanned %q", rm.removed, rm.scanned)
+	}
+	saved, err := manifest.LoadFrom(st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Deletions) != 1 || saved.Deletions[0].Hash != sum("aaaa") || saved.Deletions[0].LocalPath != "2024/03/a.jpg" {
+		t.Errorf("Deletions = %+v", saved.Deletions)
+	}
+	if got := saved.Select(manifest.Query{Deleted: true}); len(got) != 1 {
+		t.Errorf("Select(Deleted) = %+v", got)
+	}
+	for _, e := range FreeUpCandidates(saved, "/sdcard/DCIM") {
+		if e.OriginalPath == "/sdcard/DCIM/a.jpg" {
+			t.Errorf("FreeUpCandidates offers the deleted %s again", e.OriginalPath)
+		}
+	}
+
+	// A failed rm is reported and not logged
+	rm = &fakeRemover{fakeDevice: *dev, fail: map[string]bool{"/sdcard/DCIM/a.jpg": true}}
+	if deleted, _, err := FreeUp(rm, saved, st, nil, items, now, nil); err == nil || deleted != 0 || len(saved.Deletions) != 1 {
+		t.Errorf("FreeUp with a failing rm = %d, %v", deleted, err)
+	}
+	// Neither is a file whose entry left the manifest since the plan
+	rm = &fakeRemover{fakeDevice: *dev}
+	if deleted, _, err := FreeUp(rm, manifest.New(), st, nil, items, now, nil); err == nil || deleted != 0 || len(rm.removed) != 0 {
+		t.Errorf("FreeUp without the entry = %d, %v, removed %q", deleted, err, rm.removed)
+	}
+	// Nor a file edited while the list waited for confirmation
+	m = manifest.New()
+	m.Add("/sdcard/DCIM/a.jpg", "2024/03/a.jpg", 4, "2024-03-01 10:00")
+	rm = &fakeRemover{fakeDevice: fakeDevice{stats: map[string]adb.RemoteStat{"/sdcard/DCIM/a.jpg": {Exists: true, Size: 4, ModTime: now}}}}
+	if deleted, _, err := FreeUp(rm, m, st, nil, items, now, nil); err == nil || deleted != 0 || len(rm.removed) != 0 {
+		t.Errorf("FreeUp of an edited file = %d, %v, removed %q", deleted, err, rm.removed)
+	}
+}
+
+func TestFreeUpSurvivesPrune(t *testing.T) {
+	root := t.TempDir()
+	st := storage.NewLocal(root)
+	if err := st.Put("2024/03/a.jpg", strings.NewReader("aaaa"), 4); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New()
+	m.Add("/sdcard/DCIM/a.jpg", "2024/03/a.jpg", 4, "2024-03-01 10:00")
+	if err := m.Save(root); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	if _, err := snapshot.Create(root, snapshot.Info{Created: first, Source: "/sdcard/DCIM"}, m.Entries, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	now := first.AddDate(0, 3, 0)
+	items := []FreeUpItem{{Entry: m.Entries[0], Delete: true, Hash: "h", ModTime: first}}
+	rm := &fakeRemover{fakeDevice: fakeDevice{stats: map[string]adb.RemoteStat{"/sdcard/DCIM/a.jpg": {Exists: true, Size: 4, ModTime: first}}}}
+	if deleted, _, err := FreeUp(rm, m, st, nil, items, now, nil); err != nil || deleted != 1 {
+		t.Fatalf("FreeUp = %d, %v", deleted, err)
+	}
+	// Later backups no longer see the file on the device
+	for day := 1; day <= 3; day++ {
+		if _, err := snapshot.Create(root, snapshot.Info{Created: now.AddDate(0, 0, day), Source: "/sdcard/DCIM"}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pp, err := snapshot.PlanPrune(root, snapshot.Policy{Last: 1}, now.AddDate(0, 0, 4), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pp.Removed()) != 3 || len(pp.Files) != 0 {
+		t.Fatalf("prune removes %d snapshots and releases %v", len(pp.Removed()), pp.Files)
+	}
+	if err := pp.Execute(root); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := manifest.Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Select(manifest.Query{Deleted: true}); len(got) != 1 {
+		t.Errorf("Deleted files after prune = %+v", got)
+	}
+	if _, err := st.Stat("2024/03/a.jpg"); err != nil {
+		t.Errorf("backup copy of a freed up file pruned: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/dedup"
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/sorter"
+	"AndroidSafeLocal/internal/storage"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PlanAction describes what a backup run will do with a scanned file
+type PlanAction int
+
+const (
+	ActionNew      PlanAction = iota // Not backed up yet, will be pulled
+	ActionSkip                       // Already in the backup
+	ActionConflict                   // Destination name taken by a different file, pulled under a new name
+	ActionExclude                    // Rejected by the filter
+)
+
+func (a PlanAction) String() string {
+	switch a {
+	case ActionNew:
+		return "new"
+	case ActionSkip:
+		return "skip"
+	case ActionConflict:
+		return "conflict"
+	case ActionExclude:
+		return "exclude"
+	}
+	return "unknown"
+}
+
+// Filter excludes scanned files from a backup run
+type Filter struct {
+	ExcludeExts  []string // Lower-case extensions with leading dot (".tmp")
+	ExcludePaths []string // Device path prefixes ("/sdcard/Android")
+}
+
+// ParseFilter builds a Filter from a comma separated list.
+// Entries containing a slash are path prefixes, anything else is an extension.
+// Example: ".tmp, thumbdata, /sdcard/Android"
+func ParseFilter(spec string) *Filter {
+	f := &Filter{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.Contains(part, "/") {
+			f.ExcludePaths = append(f.ExcludePaths, strings.TrimSuffix(part, "/"))
+			continue
+		}
+		ext := strings.ToLower(part)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		f.ExcludeExts = append(f.ExcludeExts, ext)
+	}
+	return f
+}
+
+// Excludes reports whether the file is filtered out, and why
+func (f *Filter) Excludes(file device.File) (bool, string) {
+	if f == nil {
+		return false, ""
+	}
+	for _, prefix := range f.ExcludePaths {
+		if file.Path == prefix || strings.HasPrefix(file.Path, prefix+"/") {
+			return true, "path " + prefix
+		}
+	}
+	ext := strings.ToLower(path.Ext(file.Path))
+	for _, e := range f.ExcludeExts {
+		if ext == e {
+			return true, "extension " + e
+		}
+	}
+	return false, ""
+}
+
+// PlanItem is a scanned file and the decision taken for it
+type PlanItem struct {
+	File     device.File
+	Action   PlanAction
+	DestPath string // Absolute local destination, empty for excluded files and files already backed up elsewhere
+	Reason   string
+}
+
+// Plan is the dry-run result of a backup: what would move and whether it fits
+type Plan struct {
+	DestRoot  string
+	Items     []PlanItem
+	FreeBytes int64 // Free space on the destination volume, -1 if unknown
+	counts    map[PlanAction]int
+	bytes     map[PlanAction]int64
+}
+
+// BuildPlan decides, without transferring anything, what a backup of files into destRoot would do.
+// filter and registry may be nil.
+func BuildPlan(files []device.File, s *sorter.Sorter, filter *Filter, registry *dedup.Registry, destRoot string) *Plan {
+	return BuildPlanOn(storage.NewLocal(destRoot), files, s, filter, registry, destRoot)
+}
+
+// BuildPlanOn is BuildPlan for a backup kept in st. Destinations are under
+// stageRoot, the local folder files are pulled into before StorageAgent
+// stores them; for a local backup it is the backup folder itself.
+func BuildPlanOn(st storage.Storage, files []device.File, s *sorter.Sorter, filter *Filter, registry *dedup.Registry, stageRoot string) *Plan {
+	p := &Plan{
+		DestRoot:  stageRoot,
+		FreeBytes: -1,
+		counts:    make(map[PlanAction]int),
+		bytes:     make(map[PlanAction]int64),
+	}
+
+	// Destinations handed out in this plan, so two device files with the same
+	// name in the same month don't land on top of each other.
+	claimed := make(map[string]bool)
+
+	for _, f := range files {
+		if f.IsDir {
+			continue
+		}
+		item := PlanItem{File: f, Action: ActionNew}
+
+		if excluded, reason := filter.Excludes(f); excluded {
+			item.Action = ActionExclude
+			item.Reason = reason
+		} else if registry != nil && registry.Exists(f) {
+			item.Action = ActionSkip
+			item.Reason = "already backed up"
+		} else {
+			rel := s.GetDestination(f)
+			dest := filepath.Join(stageRoot, rel)
+			info, err := st.Stat(filepath.ToSlash(rel))
+			switch {
+			case claimed[dest] || (err == nil && info.Size != f.Size):
+				var found bool
+				dest, found = uniqueDest(st, stageRoot, dest, f.Size, claimed)
+				if found {
+					item.Action = ActionSkip
+					item.Reason = "already at destination under a numbered name"
+				} else {
+					item.Action = ActionConflict
+					item.Reason = "name taken by a different file"
+				}
+			case err == nil:
+				item.Action = ActionSkip
+				item.Reason = "already at destination"
+			}
+			if item.Action != ActionSkip {
+				claimed[dest] = true
+			}
+			item.DestPath = dest
+		}
+
+		p.Items = append(p.Items, item)
+		p.counts[item.Action]++
+		p.bytes[item.Action] += f.Size
+	}
+
+	// Remote backends don't report their free space
+	if local, ok := st.(*storage.Local); ok {
+		if free, err := freeSpace(existingParent(local.Root)); err == nil {
+			p.FreeBytes = free
+		}
+	}
+	return p
+}
+
+// Count returns the number of files with the given action
+func (p *Plan) Count(a PlanAction) int {
+	return p.counts[a]
+}
+
+// Bytes returns the total size of files with the given action
+func (p *Plan) Bytes(a PlanAction) int64 {
+	return p.bytes[a]
+}
+
+// TransferBytes is the amount of data the backup will pull
+func (p *Plan) TransferBytes() int64 {
+	return p.bytes[ActionNew] + p.bytes[ActionConflict]
+}
+
+// HasSpace reports whether the destination can hold the transfer.
+// Unknown free space is treated as enough.
+func (p *Plan) HasSpace() bool {
+	return p.FreeBytes < 0 || p.TransferBytes() <= p.FreeBytes
+}
+
+// Jobs returns the transfer jobs for new and conflicting files
+func (p *Plan) Jobs() []Job {
+	var jobs []Job
+	for _, item := range p.Items {
+		if item.Action != ActionNew && item.Action != ActionConflict {
+			continue
+		}
+		jobs = append(jobs, Job{
+			SourcePath: item.File.Path,
+			DestPath:   item.DestPath,
+			Size:       item.File.Size,
+			Timestamp:  item.File.Timestamp,
+		})
+	}
+	return jobs
+}
+
+// Summary renders the plan totals as a few human readable lines
+func (p *Plan) Summary() string {
+	var b strings.Builder
+	for _, a := range []PlanAction{ActionNew, ActionConflict, ActionSkip, ActionExclude} {
+		fmt.Fprintf(&b, "%-9s %6d files  %10s\n", a.String()+":", p.counts[a], FormatBytes(p.bytes[a]))
+	}
+	fmt.Fprintf(&b, "To transfer: %s", FormatBytes(p.TransferBytes()))
+	if p.FreeBytes >= 0 {
+		fmt.Fprintf(&b, " (free on destination: %s)", FormatBytes(p.FreeBytes))
+	}
+	if !p.HasSpace() {
+		b.WriteString("\nWARNING: not enough free space on the destination")
+	}
+	return b.String()
+}
+
+// FormatBytes renders a byte count with a binary unit (e.g. "1.5 GB")
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// uniqueDest appends _1, _2... before the extension until the name is free
+// in the plan and in st. A numbered file of the same size is this file from
+// an earlier run and is returned with found set, so it isn't pulled again.
+func uniqueDest(st storage.Storage, stageRoot, dest string, size int64, claimed map[string]bool) (candidate string, found bool) {
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	for i := 1; ; i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+		if claimed[candidate] {
+			continue
+		}
+		rel, _ := filepath.Rel(stageRoot, candidate)
+		info, err := st.Stat(filepath.ToSlash(rel))
+		if err != nil {
+			return candidate, false // Free, or the backend is unreachable and the upload fails too
+		}
+		if info.Size == size {
+			return candidate, true
+		}
+	}
+}
+
+// existingParent walks up from dir until it finds a directory that exists,
+// since the backup root is usually created by the backup itself
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,153 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/dedup"
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/sorter"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	root := t.TempDir()
+
+	// A previous backup already holds one file under the same name but another size
+	existing := filepath.Join(root, "2024", "01", "IMG_20240101_clash.jpg")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := dedup.NewRegistry()
+	registry.Add(device.File{Path: "/sdcard/DCIM/IMG_20240102_done.jpg", Size: 50})
+
+	files := []device.File{
+		{Path: "/sdcard/DCIM/Camera", IsDir: true},
+		{Path: "/sdcard/DCIM/IMG_20240101_new.jpg", Size: 100},
+		{Path: "/sdcard/DCIM/IMG_20240102_done.jpg", Size: 50},
+		{Path: "/sdcard/DCIM/IMG_20240101_clash.jpg", Size: 200},
+		{Path: "/sdcard/DCIM/cache.tmp", Size: 999},
+		{Path: "/sdcard/Android/data/app.bin", Size: 999},
+	}
+
+	plan := BuildPlan(files, sorter.NewSorter(), ParseFilter(".TMP, /sdcard/Android/"), registry, root)
+
+	if len(plan.Items) != 5 {
+		t.Fatalf("Expected 5 items (directories dropped), got %d", len(plan.Items))
+	}
+	checks := []struct {
+		action PlanAction
+		count  int
+		bytes  int64
+	}{
+		{ActionNew, 1, 100},
+		{ActionSkip, 1, 50},
+		{ActionConflict, 1, 200},
+		{ActionExclude, 2, 1998},
+	}
+	for _, c := range checks {
+		if plan.Count(c.action) != c.count || plan.Bytes(c.action) != c.bytes {
+			t.Errorf("%s: got %d files / %d bytes, want %d / %d", c.action, plan.Count(c.action), plan.Bytes(c.action), c.count, c.bytes)
+		}
+	}
+
+	if plan.TransferBytes() != 300 {
+		t.Errorf("TransferBytes() = %d, want 300", plan.TransferBytes())
+	}
+
+	jobs := plan.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+	renamed := filepath.Join(root, "2024", "01", "IMG_20240101_clash_1.jpg")
+	if jobs[1].DestPath != renamed {
+		t.Errorf("Conflict dest = %s, want %s", jobs[1].DestPath, renamed)
+	}
+
+	// Once renamed, the edited file is found under its numbered name on the next run
+	if err := os.WriteFile(renamed, make([]byte, 200), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again := BuildPlan(files, sorter.NewSorter(), ParseFilter(".TMP, /sdcard/Android/"), registry, root)
+	if again.Count(ActionConflict) != 0 || again.Count(ActionSkip) != 2 {
+		t.Errorf("second run: %d conflicts, %d skipped, want 0 and 2", again.Count(ActionConflict), again.Count(ActionSkip))
+	}
+
+	plan.FreeBytes = 299
+	if plan.HasSpace() {
+		t.Error("HasSpace() should be false when transfer exceeds free space")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1536:              "1.5 KB",
+		5 * 1024 * 1024:   "5.0 MB",
+		3 << 30:           "3.0 GB",
+		1<<40 + 512*1<<30: "1.5 TB",
+	}
+	for n, want := range tests {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestSnapshotEntries(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2024/01/IMG_20240101_a.jpg", "aaaa")     // Pulled this run
+	write("2024/02/IMG_20240201_b.jpg", "bb")       // At its destination from an earlier run
+	write("Unknown_Date/Misc/c.jpg", "ccc")         // Found by the registry, known to the manifest
+	write("2023/05/IMG_20230501_moved.jpg", "mmmm") // Found by the registry under another device folder
+
+	registry := dedup.NewRegistry()
+	registry.Add(device.File{Path: "/sdcard/DCIM/c.jpg", Size: 3})
+	registry.Add(device.File{Path: "/sdcard/Pictures/IMG_20230501_moved.jpg", Size: 4})
+	files := []device.File{
+		{Path: "/sdcard/DCIM/IMG_20240101_a.jpg", Size: 4},
+		{Path: "/sdcard/DCIM/IMG_20240201_b.jpg", Size: 2},
+		{Path: "/sdcard/DCIM/c.jpg", Size: 3},
+		{Path: "/sdcard/Pictures/IMG_20230501_moved.jpg", Size: 4},
+		{Path: "/sdcard/DCIM/IMG_20240301_failed.jpg", Size: 9},
+		{Path: "/sdcard/DCIM/skip.tmp", Size: 1},
+	}
+	plan := BuildPlan(files, sorter.NewSorter(), ParseFilter("tmp"), registry, root)
+
+	m := manifest.New()
+	m.Add("/sdcard/DCIM/c.jpg", filepath.Join("Unknown_Date", "Misc", "c.jpg"), 3, "")
+	m.Add("/sdcard/DCIM/IMG_20230501_moved.jpg", filepath.Join("2023", "05", "IMG_20230501_moved.jpg"), 4, "")
+
+	entries, missing := SnapshotEntries(plan, m)
+	if missing != 1 {
+		t.Errorf("Expected the failed file as missing, got %d", missing)
+	}
+	want := map[string]string{
+		"/sdcard/DCIM/IMG_20240101_a.jpg":         filepath.Join("2024", "01", "IMG_20240101_a.jpg"),
+		"/sdcard/DCIM/IMG_20240201_b.jpg":         filepath.Join("2024", "02", "IMG_20240201_b.jpg"),
+		"/sdcard/DCIM/c.jpg":                      filepath.Join("Unknown_Date", "Misc", "c.jpg"),
+		"/sdcard/Pictures/IMG_20230501_moved.jpg": filepath.Join("2023", "05", "IMG_20230501_moved.jpg"),
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), entries)
+	}
+	for _, e := range entries {
+		if want[e.OriginalPath] != e.LocalPath {
+			t.Errorf("%s -> %s, want %s", e.OriginalPath, e.LocalPath, want[e.OriginalPath])
+		}
+	}
+}
@@ -3,7 +3,6 @@ package backup
 import (
 	"AndroidSafeLocal/internal/dedup"
 	"AndroidSafeLocal/internal/device"
-	"sync"
 )
 
 // Job represents a file transfer task
@@ -16,9 +15,10 @@ type Job struct {
 
 // Result represents the outcome of a job
 type Result struct {
-	Job     Job
-	Error   error
-	Skipped bool
+	Job      Job
+	Error    error
+	Skipped  bool
+	Attempts int // Tries made, more than 1 when transient failures were retried
 }
 
 // Processor defines the interface for handling a job
@@ -28,41 +28,66 @@ type Processor interface {
 
 // Pool manages a pool of workers
 type Pool struct {
-	workerCount int
-	jobs        chan Job
-	results     chan Result
-	wg          sync.WaitGroup
-	processor   Processor
-	registry    *dedup.Registry
+	sched     *scheduler
+	results   chan Result
+	processor Processor
+	registry  *dedup.Registry
+	progress  *Progress
+	retry     RetryPolicy
+	limiter   *RateLimiter
 }
 
 // NewPool creates a new worker pool
 func NewPool(workerCount int, processor Processor, registry *dedup.Registry) *Pool {
 	return &Pool{
-		workerCount: workerCount,
-		jobs:        make(chan Job, 100), // Buffer slightly to avoid blocking main thread immediately
-		results:     make(chan Result, 100),
-		processor:   processor,
-		registry:    registry,
+		sched:     newScheduler(workerCount, 100), // Buffer slightly to avoid blocking main thread immediately
+		results:   make(chan Result, 100),
+		processor: processor,
+		registry:  registry,
 	}
 }
 
+// SetProgress attaches a byte progress tracker. Call before Start.
+func (p *Pool) SetProgress(progress *Progress) {
+	p.progress = progress
+}
+
+// SetRetryPolicy enables retries of transient failures. Call before Start.
+func (p *Pool) SetRetryPolicy(rp RetryPolicy) {
+	p.retry = rp
+}
+
+// SetLimiter shares a bandwidth limit with other pools. Call before Start.
+func (p *Pool) SetLimiter(limiter *RateLimiter) {
+	p.limiter = limiter
+}
+
+// SetAdaptive lets the pool resize itself from measured throughput, starting
+// from the worker count given to NewPool. Call before Start.
+func (p *Pool) SetAdaptive(cfg AdaptiveConfig) {
+	p.sched.setAdaptive(cfg)
+}
+
+// Workers returns the current worker limit per lane
+func (p *Pool) Workers() map[string]int {
+	return p.sched.workers()
+}
+
 // Start launches the workers
 func (p *Pool) Start() {
-	for i := 0; i < p.workerCount; i++ {
-		p.wg.Add(1)
-		go p.worker(i)
-	}
+	p.sched.start()
 }
 
-// worker processes jobs from the channel
-func (p *Pool) worker(id int) {
-	defer p.wg.Done()
-	for job := range p.jobs {
-		// log.Printf("Worker %d starting job: %s\n", id, job.SourcePath)
-		err := p.processor.Process(job)
-		p.results <- Result{Job: job, Error: err}
-	}
+// process runs a single job on a worker and publishes its result
+func (p *Pool) process(job Job) (int, error) {
+	p.limiter.Wait(job.Size)
+	p.progress.begin(job.DestPath, job.Size)
+	attempts, err := p.retry.run(func() error {
+		return p.processor.Process(job)
+	})
+	p.progress.end(job.DestPath, job.Size, err == nil)
+	p.results <- Result{Job: job, Error: err, Attempts: attempts}
+	return attempts, err
 }
 
 // AddJob adds a job to the queue
@@ -76,17 +101,17 @@ func (p *Pool) AddJob(job Job) {
 		}
 		if p.registry.Exists(f) {
 			// Skip
+			p.progress.end("", job.Size, false)
 			p.results <- Result{Job: job, Error: nil, Skipped: true}
 			return
 		}
 	}
-	p.jobs <- job
+	p.sched.submit(task{size: job.Size, run: func() (int, error) { return p.process(job) }})
 }
 
 // Close closes the job channel and waits for workers to finish
 func (p *Pool) Close() {
-	close(p.jobs)
-	p.wg.Wait()
+	p.sched.close()
 	close(p.results)
 }
 
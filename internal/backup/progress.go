@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rateWindow is how far back the instantaneous throughput looks
+const rateWindow = 5 * time.Second
+
+// Progress tracks the bytes moved by a pool and derives throughput and ETA.
+// All methods are safe for concurrent use and do nothing on a nil *Progress,
+// so pools can report unconditionally.
+type Progress struct {
+	mu         sync.Mutex
+	totalBytes int64
+	doneBytes  int64
+	totalFiles int
+	doneFiles  int
+	start      time.Time
+	inFlight   map[string]int64 // Local file being written -> expected size
+	samples    []progressSample
+}
+
+type progressSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// ProgressSnapshot is a point-in-time view of a Progress
+type ProgressSnapshot struct {
+	TotalBytes  int64
+	DoneBytes   int64
+	TotalFiles  int
+	DoneFiles   int
+	Elapsed     time.Duration
+	Rate        float64       // Bytes per second over the last few seconds
+	AverageRate float64       // Bytes per second since start
+	ETA         time.Duration // -1 while unknown
+}
+
+// NewProgress creates a tracker for a run of totalFiles files weighing totalBytes
+func NewProgress(totalFiles int, totalBytes int64) *Progress {
+	return &Progress{
+		totalBytes: totalBytes,
+		totalFiles: totalFiles,
+		start:      time.Now(),
+		inFlight:   make(map[string]int64),
+	}
+}
+
+// begin marks a file as being transferred. localPath is the file being written
+// on this PC, whose growing size is used for in-flight progress; empty if not observable.
+func (p *Progress) begin(localPath string, size int64) {
+	if p == nil || localPath == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight[localPath] = size
+}
+
+// end marks a file as finished. Failed or skipped files are removed from the
+// totals so the ETA only covers data that will actually move.
+func (p *Progress) end(localPath string, size int64, transferred bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inFlight, localPath)
+	if transferred {
+		p.doneBytes += size
+		p.doneFiles++
+	} else {
+		p.totalBytes -= size
+		p.totalFiles--
+	}
+}
+
+// Snapshot returns the current counters and rates
+func (p *Progress) Snapshot() ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{ETA: -1}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	done := p.doneBytes
+	for path, size := range p.inFlight {
+		if info, err := os.Stat(path); err == nil {
+			done += min(info.Size(), size)
+		}
+	}
+
+	now := time.Now()
+	p.samples = append(p.samples, progressSample{at: now, bytes: done})
+	for len(p.samples) > 2 && now.Sub(p.samples[1].at) >= rateWindow {
+		p.samples = p.samples[1:]
+	}
+
+	s := ProgressSnapshot{
+		TotalBytes: p.totalBytes,
+		DoneBytes:  done,
+		TotalFiles: p.totalFiles,
+		DoneFiles:  p.doneFiles,
+		Elapsed:    now.Sub(p.start),
+		ETA:        -1,
+	}
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.AverageRate = float64(done) / secs
+	}
+	if oldest := p.samples[0]; now.After(oldest.at) {
+		s.Rate = float64(done-oldest.bytes) / now.Sub(oldest.at).Seconds()
+	}
+
+	// Prefer the recent rate, it reacts to a slow phase of big files
+	rate := s.Rate
+	if rate <= 0 {
+		rate = s.AverageRate
+	}
+	if rate > 0 {
+		s.ETA = time.Duration(float64(max(s.TotalBytes-done, 0)) / rate * float64(time.Second))
+	}
+	return s
+}
+
+// Fraction returns completion between 0 and 1
+func (s ProgressSnapshot) Fraction() float64 {
+	if s.TotalBytes <= 0 {
+		return 0
+	}
+	return min(float64(s.DoneBytes)/float64(s.TotalBytes), 1)
+}
+
+// String renders the snapshot as a single status line
+func (s ProgressSnapshot) String() string {
+	eta := "ETA --"
+	if s.ETA >= 0 {
+		eta = "ETA " + s.ETA.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s / %s (%.0f%%) · %d/%d files · %s/s (avg %s/s) · %s",
+		FormatBytes(s.DoneBytes), FormatBytes(s.TotalBytes), s.Fraction()*100,
+		s.DoneFiles, s.TotalFiles,
+		FormatBytes(int64(s.Rate)), FormatBytes(int64(s.AverageRate)), eta)
+}
@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := NewProgress(3, 1000)
+
+	// One file half written on disk
+	partial := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(partial, make([]byte, 250), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p.begin(partial, 500)
+	p.end("", 300, true)  // Finished
+	p.end("", 200, false) // Failed, leaves the totals
+
+	s := p.Snapshot()
+	if s.TotalBytes != 800 || s.TotalFiles != 2 {
+		t.Errorf("Totals = %d bytes / %d files, want 800 / 2", s.TotalBytes, s.TotalFiles)
+	}
+	if s.DoneBytes != 550 || s.DoneFiles != 1 {
+		t.Errorf("Done = %d bytes / %d files, want 550 / 1", s.DoneBytes, s.DoneFiles)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	p.end(partial, 500, true)
+	s = p.Snapshot()
+	if s.DoneBytes != 800 || s.Fraction() != 1 {
+		t.Errorf("After finishing: done = %d, fraction = %v", s.DoneBytes, s.Fraction())
+	}
+	if s.Rate <= 0 || s.AverageRate <= 0 {
+		t.Errorf("Expected positive rates, got %v / %v", s.Rate, s.AverageRate)
+	}
+	if s.ETA != 0 {
+		t.Errorf("ETA = %v, want 0 when done", s.ETA)
+	}
+}
+
+func TestPoolReportsProgress(t *testing.T) {
+	mock := &MockProcessor{Failures: map[string]bool{"/data/fail": true}}
+	progress := NewProgress(3, 600)
+
+	pool := NewPool(2, mock, nil)
+	pool.SetProgress(progress)
+	pool.Start()
+	pool.AddJob(Job{SourcePath: "/data/a", Size: 100})
+	pool.AddJob(Job{SourcePath: "/data/b", Size: 200})
+	pool.AddJob(Job{SourcePath: "/data/fail", Size: 300})
+	go pool.Close()
+	for range pool.Results() {
+	}
+
+	s := progress.Snapshot()
+	if s.DoneBytes != 300 || s.TotalBytes != 300 || s.DoneFiles != 2 {
+		t.Errorf("Snapshot = %+v, want 300/300 bytes and 2 files", s)
+	}
+}
@@ -0,0 +1,210 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/device"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RemapRule moves every path under From to the same place under To
+type RemapRule struct {
+	From string
+	To   string
+	Auto bool // Detected from the device rather than given by the user
+}
+
+func (r RemapRule) String() string {
+	s := r.From + " -> " + r.To
+	if r.Auto {
+		s += " (auto)"
+	}
+	return s
+}
+
+// ParseRemapRules parses "from=to" rules separated by commas or new lines
+func ParseRemapRules(spec string) ([]RemapRule, error) {
+	var rules []RemapRule
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "=")
+		from, to = cleanRoot(from), cleanRoot(to)
+		if !ok || !strings.HasPrefix(from, "/") || !strings.HasPrefix(to, "/") {
+			return nil, fmt.Errorf("bad path mapping %q, use /old/prefix=/new/prefix", part)
+		}
+		rules = append(rules, RemapRule{From: from, To: to})
+	}
+	return rules, nil
+}
+
+func cleanRoot(p string) string {
+	p = strings.TrimSpace(p)
+	if len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+	}
+	return p
+}
+
+// Remapper rewrites original device paths for a restore to another device
+type Remapper struct {
+	Rules []RemapRule
+}
+
+// NewRemapper combines user rules with detected ones. A detected rule is
+// dropped when the user already maps the same prefix.
+func NewRemapper(user, auto []RemapRule) *Remapper {
+	rules := slices.Clone(user)
+	for _, a := range auto {
+		if !slices.ContainsFunc(user, func(u RemapRule) bool { return u.From == a.From }) {
+			rules = append(rules, a)
+		}
+	}
+	return &Remapper{Rules: rules}
+}
+
+// Map returns the remapped path using the longest matching rule.
+// Paths no rule matches come back unchanged.
+func (m *Remapper) Map(p string) string {
+	if m == nil {
+		return p
+	}
+	best := -1
+	for i, r := range m.Rules {
+		if (p == r.From || strings.HasPrefix(p, r.From+"/")) && (best < 0 || len(r.From) > len(m.Rules[best].From)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return p
+	}
+	return m.Rules[best].To + strings.TrimPrefix(p, m.Rules[best].From)
+}
+
+// PathChange is one rewritten restore target, for previews
+type PathChange struct {
+	From string
+	To   string
+}
+
+// Apply rewrites the targets of jobs in place and returns what changed
+func (m *Remapper) Apply(jobs []RestoreJob) []PathChange {
+	var changes []PathChange
+	for i := range jobs {
+		to := m.Map(jobs[i].OriginalPath)
+		if to != jobs[i].OriginalPath {
+			changes = append(changes, PathChange{From: jobs[i].OriginalPath, To: to})
+			jobs[i].OriginalPath = to
+		}
+	}
+	return changes
+}
+
+// DeviceLayout is where a device keeps shared storage
+type DeviceLayout struct {
+	SDCards []string        // Volume UUIDs mounted under /storage, e.g. "ABCD-1234"
+	User    int             // Current Android user, 0 unless a secondary user or work profile is active
+	Volumes []device.Volume // With their kinds, when the device could tell
+}
+
+// DetectLayout asks the device for its SD cards and current user
+func DetectLayout(client *adb.Client) (DeviceLayout, error) {
+	var layout DeviceLayout
+	out, err := client.Shell("ls", "-1", "/storage")
+	if err != nil {
+		return layout, err
+	}
+	for _, name := range strings.Split(out, "\n") {
+		if name = strings.TrimSpace(name); volumeUUID.MatchString(name) {
+			layout.SDCards = append(layout.SDCards, name)
+		}
+	}
+	// Older devices have no get-current-user and only ever run user 0
+	if out, err := client.Shell("am", "get-current-user"); err == nil {
+		layout.User, _ = strconv.Atoi(strings.TrimSpace(out))
+	}
+	layout.Volumes, _ = device.ListVolumes(client)
+	return layout, nil
+}
+
+// volumeKind returns the kind of the volume with this UUID, empty if unknown
+func volumeKind(volumes []device.Volume, uuid string) device.VolumeKind {
+	for _, v := range volumes {
+		if strings.EqualFold(v.UUID, uuid) {
+			return v.Kind
+		}
+	}
+	return ""
+}
+
+var (
+	volumeUUID = regexp.MustCompile(`^(?:` + adb.UUIDPattern + `)$`)
+	sdCardPath = regexp.MustCompile(`^/storage/(` + adb.UUIDPattern + `)(/|$)`)
+	userPath   = regexp.MustCompile(`^/storage/emulated/(\d+)(/|$)`)
+	userMedia  = regexp.MustCompile(`^/data/media/(\d+)(/|$)`)
+)
+
+// AutoRemapRules derives rules that move paths onto the target device:
+// SD card UUIDs the target doesn't have go to its only unused card, and other
+// users' storage goes to the target's current user. With the source volumes
+// recorded in the manifest, a card only goes to an unused volume of the same
+// kind, so an SD card isn't restored onto a USB drive.
+func AutoRemapRules(paths []string, source []device.Volume, target DeviceLayout) []RemapRule {
+	var cards, users []string
+	for _, p := range paths {
+		if m := sdCardPath.FindStringSubmatch(p); m != nil && !slices.Contains(cards, m[1]) {
+			cards = append(cards, m[1])
+		}
+		for _, re := range []*regexp.Regexp{userPath, userMedia} {
+			if m := re.FindStringSubmatch(p); m != nil {
+				if root := strings.TrimSuffix(m[0], "/"); !slices.Contains(users, root) {
+					users = append(users, root)
+				}
+			}
+		}
+	}
+
+	var rules []RemapRule
+	var missing, unused []string
+	for _, c := range cards {
+		if !slices.Contains(target.SDCards, c) {
+			missing = append(missing, c)
+		}
+	}
+	for _, c := range target.SDCards {
+		if !slices.Contains(cards, c) {
+			unused = append(unused, c)
+		}
+	}
+	// With several candidate cards, or several missing cards that could go to
+	// the same one, there is no safe guess: the user has to map them
+	candidates := make([][]string, len(missing))
+	claims := make(map[string]int)
+	for i, c := range missing {
+		candidates[i] = unused
+		if kind := volumeKind(source, c); kind != "" && len(target.Volumes) > 0 {
+			candidates[i] = slices.DeleteFunc(slices.Clone(unused), func(u string) bool { return volumeKind(target.Volumes, u) != kind })
+		}
+		for _, u := range candidates[i] {
+			claims[u]++
+		}
+	}
+	for i, c := range missing {
+		if len(candidates[i]) == 1 && claims[candidates[i][0]] == 1 {
+			rules = append(rules, RemapRule{From: "/storage/" + c, To: "/storage/" + candidates[i][0], Auto: true})
+		}
+	}
+
+	userRoot := fmt.Sprintf("/storage/emulated/%d", target.User)
+	for _, root := range users {
+		if root != userRoot {
+			rules = append(rules, RemapRule{From: root, To: userRoot, Auto: true})
+		}
+	}
+	return rules
+}
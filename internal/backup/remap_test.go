@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/device"
+	"slices"
+	"testing"
+)
+
+func TestParseRemapRules(t *testing.T) {
+	rules, err := ParseRemapRules("/storage/ABCD-1234/=/storage/9999-0000, /sdcard/Old=/sdcard/New\n")
+	if err != nil {
+		t.Fatalf("ParseRemapRules failed: %v", err)
+	}
+	want := []RemapRule{{From: "/storage/ABCD-1234", To: "/storage/9999-0000"}, {From: "/sdcard/Old", To: "/sdcard/New"}}
+	if !slices.Equal(rules, want) {
+		t.Errorf("Got %v, want %v", rules, want)
+	}
+	for _, bad := range []string{"/sdcard", "sdcard=/x", "/x=y"} {
+		if _, err := ParseRemapRules(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestRemapperMap(t *testing.T) {
+	m := NewRemapper(
+		[]RemapRule{{From: "/storage/emulated/0/DCIM", To: "/storage/emulated/0/Restored/DCIM"}},
+		[]RemapRule{{From: "/storage/emulated/0", To: "/storage/emulated/10", Auto: true}},
+	)
+	tests := []struct{ in, want string }{
+		{"/storage/emulated/0/DCIM/a.jpg", "/storage/emulated/0/Restored/DCIM/a.jpg"},
+		{"/storage/emulated/0/Music/b.mp3", "/storage/emulated/10/Music/b.mp3"},
+		{"/storage/emulated/01/c.txt", "/storage/emulated/01/c.txt"},
+		{"/sdcard/d.txt", "/sdcard/d.txt"},
+	}
+	for _, tt := range tests {
+		if got := m.Map(tt.in); got != tt.want {
+			t.Errorf("Map(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	// A user rule replaces the detected rule for the same prefix
+	m = NewRemapper(
+		[]RemapRule{{From: "/storage/ABCD-1234", To: "/sdcard/FromCard"}},
+		[]RemapRule{{From: "/storage/ABCD-1234", To: "/storage/9999-0000", Auto: true}},
+	)
+	if len(m.Rules) != 1 || m.Map("/storage/ABCD-1234/x.jpg") != "/sdcard/FromCard/x.jpg" {
+		t.Errorf("User rule should win, got rules %v", m.Rules)
+	}
+}
+
+func TestAutoRemapRules(t *testing.T) {
+	paths := []string{
+		"/storage/emulated/0/DCIM/a.jpg",
+		"/storage/ABCD-1234/DCIM/b.jpg",
+		"/storage/emulated/10/Documents/c.pdf",
+	}
+	rules := AutoRemapRules(paths, nil, DeviceLayout{SDCards: []string{"9999-0000"}, User: 0})
+	want := []RemapRule{
+		{From: "/storage/ABCD-1234", To: "/storage/9999-0000", Auto: true},
+		{From: "/storage/emulated/10", To: "/storage/emulated/0", Auto: true},
+	}
+	if !slices.Equal(rules, want) {
+		t.Errorf("Got %v, want %v", rules, want)
+	}
+
+	// Two unused cards on the target: no guess
+	rules = AutoRemapRules(paths[:2], nil, DeviceLayout{SDCards: []string{"9999-0000", "8888-0000"}})
+	if len(rules) != 0 {
+		t.Errorf("Expected no rules, got %v", rules)
+	}
+
+	// Recorded kinds pick the SD card over the USB drive
+	source := []device.Volume{{Kind: device.VolumeSD, UUID: "ABCD-1234", Path: "/storage/ABCD-1234"}}
+	layout := DeviceLayout{SDCards: []string{"9999-0000", "8888-0000"}, Volumes: []device.Volume{
+		{Kind: device.VolumeUSB, UUID: "9999-0000", Path: "/storage/9999-0000"},
+		{Kind: device.VolumeSD, UUID: "8888-0000", Path: "/storage/8888-0000"},
+	}}
+	rules = AutoRemapRules(paths[:2], source, layout)
+	if want := []RemapRule{{From: "/storage/ABCD-1234", To: "/storage/8888-0000", Auto: true}}; !slices.Equal(rules, want) {
+		t.Errorf("Got %v, want %v", rules, want)
+	}
+	// Only a USB drive left: an SD card is not guessed onto it
+	layout.SDCards, layout.Volumes = layout.SDCards[:1], layout.Volumes[:1]
+	if rules = AutoRemapRules(paths[:2], source, layout); len(rules) != 0 {
+		t.Errorf("Expected no rules, got %v", rules)
+	}
+
+	// Two old cards and one new one: neither is merged onto it
+	two := append(slices.Clone(paths[:2]), "/storage/5555-6666/DCIM/d.jpg")
+	if rules = AutoRemapRules(two, nil, DeviceLayout{SDCards: []string{"9999-0000"}}); len(rules) != 0 {
+		t.Errorf("Expected no rules, got %v", rules)
+	}
+	// Unless only one of them is of the new card's kind
+	source = append(source, device.Volume{Kind: device.VolumeUSB, UUID: "5555-6666", Path: "/storage/5555-6666"})
+	layout = DeviceLayout{SDCards: []string{"8888-0000"}, Volumes: []device.Volume{{Kind: device.VolumeSD, UUID: "8888-0000", Path: "/storage/8888-0000"}}}
+	rules = AutoRemapRules(two, source, layout)
+	if want := []RemapRule{{From: "/storage/ABCD-1234", To: "/storage/8888-0000", Auto: true}}; !slices.Equal(rules, want) {
+		t.Errorf("Got %v, want %v", rules, want)
+	}
+
+	// exFAT drives have 16 hex digit IDs
+	usb := []string{"/storage/0123456789ABCDEF/Movies/a.mp4"}
+	rules = AutoRemapRules(usb, nil, DeviceLayout{SDCards: []string{"FEDCBA9876543210"}})
+	if want := []RemapRule{{From: "/storage/0123456789ABCDEF", To: "/storage/FEDCBA9876543210", Auto: true}}; !slices.Equal(rules, want) {
+		t.Errorf("Got %v, want %v", rules, want)
+	}
+
+	// Same card present: nothing to do
+	rules = AutoRemapRules(paths[:2], nil, DeviceLayout{SDCards: []string{"ABCD-1234"}})
+	if len(rules) != 0 {
+		t.Errorf("Expected no rules, got %v", rules)
+	}
+}
+
+func TestRemapperApply(t *testing.T) {
+	jobs := []RestoreJob{{OriginalPath: "/storage/ABCD-1234/a.jpg"}, {OriginalPath: "/sdcard/b.jpg"}}
+	m := &Remapper{Rules: []RemapRule{{From: "/storage/ABCD-1234", To: "/storage/9999-0000"}}}
+	changes := m.Apply(jobs)
+	if len(changes) != 1 || changes[0].To != "/storage/9999-0000/a.jpg" || jobs[0].OriginalPath != changes[0].To {
+		t.Errorf("Unexpected changes %v, jobs %v", changes, jobs)
+	}
+}
@@ -0,0 +1,23 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"path/filepath"
+)
+
+// RestoreJobs turns manifest entries of the backup at root into restore jobs
+// targeting their original device paths
+func RestoreJobs(root string, entries []manifest.Entry) []RestoreJob {
+	jobs := make([]RestoreJob, 0, len(entries))
+	for i, entry := range entries {
+		jobs = append(jobs, RestoreJob{
+			LocalPath:    filepath.Join(root, entry.LocalPath),
+			OriginalPath: entry.OriginalPath,
+			Size:         entry.Size,
+			Timestamp:    entry.Timestamp,
+			Index:        i + 1,
+			Total:        len(entries),
+		})
+	}
+	return jobs
+}
@@ -2,68 +2,122 @@ package backup
 
 import (
 	"AndroidSafeLocal/internal/adb"
-	"sync"
 )
 
 // RestoreJob represents a file restore task
 type RestoreJob struct {
 	LocalPath    string // Local file path on PC
 	OriginalPath string // Original path on device
+	Size         int64  // File size, for byte progress
+	Timestamp    string // Manifest timestamp, for conflict checks and restoring the mtime
 	Index        int    // Job index for progress tracking
 	Total        int    // Total number of jobs
 }
 
 // RestoreResult represents the outcome of a restore job
 type RestoreResult struct {
-	Job   RestoreJob
-	Error error
+	Job      RestoreJob
+	Error    error
+	Attempts int             // Tries made, more than 1 when transient failures were retried
+	Decision RestoreDecision // What the conflict check chose, RestorePush without a checker
+	Skipped  bool            // Left alone because of the conflict policy
+	TimeErr  error           // The file was pushed but its original mtime could not be set
 }
 
 // RestorePool manages parallel restore workers
 type RestorePool struct {
-	workerCount int
-	jobs        chan RestoreJob
-	results     chan RestoreResult
-	wg          sync.WaitGroup
-	client      *adb.Client
+	sched    *scheduler
+	results  chan RestoreResult
+	client   *adb.Client
+	progress *Progress
+	retry    RetryPolicy
+	limiter  *RateLimiter
+	checker  *ConflictChecker
 }
 
 // NewRestorePool creates a new restore worker pool
 func NewRestorePool(workerCount int, client *adb.Client) *RestorePool {
 	return &RestorePool{
-		workerCount: workerCount,
-		jobs:        make(chan RestoreJob, 500),    // Larger buffer for many small files
-		results:     make(chan RestoreResult, 500), // Larger buffer to avoid blocking workers
-		client:      client,
+		sched:   newScheduler(workerCount, 500), // Larger buffer for many small files
+		results: make(chan RestoreResult, 500),  // Larger buffer to avoid blocking workers
+		client:  client,
 	}
 }
 
+// SetProgress attaches a byte progress tracker. Call before Start.
+func (p *RestorePool) SetProgress(progress *Progress) {
+	p.progress = progress
+}
+
+// SetRetryPolicy enables retries of transient failures. Call before Start.
+func (p *RestorePool) SetRetryPolicy(rp RetryPolicy) {
+	p.retry = rp
+}
+
+// SetLimiter shares a bandwidth limit with other pools. Call before Start.
+func (p *RestorePool) SetLimiter(limiter *RateLimiter) {
+	p.limiter = limiter
+}
+
+// SetConflictChecker makes each worker look at the target before pushing. Call before Start.
+func (p *RestorePool) SetConflictChecker(cc *ConflictChecker) {
+	p.checker = cc
+}
+
+// SetAdaptive lets the pool resize itself from measured throughput, starting
+// from the worker count given to NewRestorePool. Call before Start.
+func (p *RestorePool) SetAdaptive(cfg AdaptiveConfig) {
+	p.sched.setAdaptive(cfg)
+}
+
+// Workers returns the current worker limit per lane
+func (p *RestorePool) Workers() map[string]int {
+	return p.sched.workers()
+}
+
 // Start launches the restore workers
 func (p *RestorePool) Start() {
-	for i := 0; i < p.workerCount; i++ {
-		p.wg.Add(1)
-		go p.worker()
-	}
+	p.sched.start()
 }
 
-// worker processes restore jobs from the channel
-func (p *RestorePool) worker() {
-	defer p.wg.Done()
-	for job := range p.jobs {
-		err := p.client.Push(job.LocalPath, job.OriginalPath)
-		p.results <- RestoreResult{Job: job, Error: err}
+// process pushes a single file on a worker and publishes its result
+func (p *RestorePool) process(job RestoreJob) (int, error) {
+	decision := RestoreDecision{Job: job, Action: RestorePush, Target: job.OriginalPath}
+	if p.checker != nil {
+		attempts, err := p.retry.run(func() (err error) {
+			decision, err = p.checker.Decide(job)
+			return err
+		})
+		if err != nil || !decision.Action.Pushes() {
+			p.progress.end("", job.Size, false)
+			p.results <- RestoreResult{Job: job, Error: err, Attempts: attempts, Decision: decision, Skipped: err == nil}
+			return attempts, err
+		}
+	}
+
+	p.limiter.Wait(job.Size)
+	// Pushed bytes can't be observed mid-transfer, progress moves per file
+	attempts, err := p.retry.run(func() error {
+		return p.client.Push(job.LocalPath, decision.Target)
+	})
+	p.progress.end("", job.Size, err == nil)
+	res := RestoreResult{Job: job, Error: err, Attempts: attempts, Decision: decision}
+	// Without this the gallery sorts every restored file as taken today
+	if t, ok := parseTimestamp(job.Timestamp); ok && err == nil {
+		res.TimeErr = p.client.SetModTime(decision.Target, t)
 	}
+	p.results <- res
+	return attempts, err
 }
 
 // AddJob adds a restore job to the queue
 func (p *RestorePool) AddJob(job RestoreJob) {
-	p.jobs <- job
+	p.sched.submit(task{size: job.Size, run: func() (int, error) { return p.process(job) }})
 }
 
 // Close closes the job channel and waits for workers to finish
 func (p *RestorePool) Close() {
-	close(p.jobs)
-	p.wg.Wait()
+	p.sched.close()
 	close(p.results)
 }
 
@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"time"
+)
+
+// RetryPolicy controls how transient transfer failures are retried.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	MaxAttempts int           // Total tries per job, including the first
+	BaseDelay   time.Duration // Wait before the first retry, doubled on each retry
+	MaxDelay    time.Duration // Upper bound for the wait
+	// Reconnect, if set, is called before each retry, e.g. to bring back a
+	// wireless device. While it fails the transfer waits, calling it again
+	// every BaseDelay for up to ReconnectWindow without using up attempts;
+	// after that the retry goes ahead and reports what is wrong.
+	Reconnect       func() error
+	ReconnectWindow time.Duration
+}
+
+// DefaultRetryPolicy rides out a cable wiggle or an adbd restart (about 15 seconds in total),
+// and waits up to 10 minutes for a wireless device to come back once Reconnect is set
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     4,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		ReconnectWindow: 10 * time.Minute,
+	}
+}
+
+// delay returns the wait after the given failed attempt (1-based)
+func (rp RetryPolicy) delay(attempt int) time.Duration {
+	d := rp.BaseDelay << (attempt - 1)
+	if rp.MaxDelay > 0 && (d > rp.MaxDelay || d <= 0) {
+		d = rp.MaxDelay
+	}
+	return d
+}
+
+// run calls fn until it succeeds, fails with a non-transient error or runs out of attempts.
+// It returns the number of attempts made and the last error.
+func (rp RetryPolicy) run(fn func() error) (int, error) {
+	attempt := 1
+	for {
+		err := fn()
+		if err == nil || attempt >= rp.MaxAttempts || !adb.Classify(err).Transient() {
+			return attempt, err
+		}
+		time.Sleep(rp.delay(attempt))
+		if rp.Reconnect != nil {
+			rp.reconnect()
+		}
+		attempt++
+	}
+}
+
+// reconnect calls Reconnect until it succeeds or ReconnectWindow has passed
+func (rp RetryPolicy) reconnect() {
+	deadline := time.Now().Add(rp.ReconnectWindow)
+	for rp.Reconnect() != nil && time.Now().Before(deadline) {
+		time.Sleep(max(rp.BaseDelay, time.Millisecond))
+	}
+}
@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FlakyProcessor fails each job a set number of times before succeeding
+type FlakyProcessor struct {
+	FailTimes map[string]int
+	Err       error
+	calls     map[string]int
+	mu        sync.Mutex
+}
+
+func (f *FlakyProcessor) Process(job Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[job.SourcePath]++
+	if f.calls[job.SourcePath] <= f.FailTimes[job.SourcePath] {
+		return f.Err
+	}
+	return nil
+}
+
+func TestPoolRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failTimes    int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"Recovers", errors.New("adb: error: device offline"), 2, 3, false},
+		{"Gives Up", errors.New("adb: error: protocol fault"), 10, 3, true},
+		{"Permanent", errors.New("adb: error: Permission denied"), 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := &FlakyProcessor{FailTimes: map[string]int{"/sdcard/a.jpg": tt.failTimes}, Err: tt.err}
+			pool := NewPool(1, proc, nil)
+			pool.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond})
+			pool.Start()
+			pool.AddJob(Job{SourcePath: "/sdcard/a.jpg"})
+			go pool.Close()
+
+			res := <-pool.Results()
+			if res.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", res.Attempts, tt.wantAttempts)
+			}
+			if (res.Error != nil) != tt.wantErr {
+				t.Errorf("Error = %v, wantErr %v", res.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryReconnects(t *testing.T) {
+	reconnects := 0
+	rp := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Reconnect: func() error {
+		reconnects++
+		return errors.New("cannot connect to 192.168.1.23:37123")
+	}}
+	calls := 0
+	attempts, err := rp.run(func() error {
+		if calls++; calls < 3 {
+			return errors.New("adb: error: device '192.168.1.23:37123' not found")
+		}
+		return nil
+	})
+	if attempts != 3 || err != nil || reconnects != 2 {
+		t.Errorf("attempts = %d, err = %v, reconnects = %d", attempts, err, reconnects)
+	}
+}
+
+func TestRetryWaitsForReconnect(t *testing.T) {
+	// The device is away for a few polls, which must not use up the two attempts
+	down := 5
+	rp := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, ReconnectWindow: time.Minute, Reconnect: func() error {
+		if down--; down > 0 {
+			return errors.New("cannot connect to 192.168.1.23:37123")
+		}
+		return nil
+	}}
+	calls := 0
+	attempts, err := rp.run(func() error {
+		if calls++; down > 0 {
+			return errors.New("adb: error: device '192.168.1.23:37123' not found")
+		}
+		return nil
+	})
+	if attempts != 2 || err != nil || down != 0 {
+		t.Errorf("attempts = %d, err = %v, reconnects left = %d", attempts, err, down)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := rp.delay(i + 1); got != w {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
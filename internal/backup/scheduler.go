@@ -0,0 +1,256 @@
+package backup
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AdaptiveConfig lets a pool tune its worker count at runtime.
+// Jobs are split into a small-file and a large-file lane so a few big videos
+// can't hold every worker while thousands of photos wait.
+type AdaptiveConfig struct {
+	MinWorkers    int           // Lower bound per lane
+	MaxWorkers    int           // Upper bound for the small-file lane
+	LargeWorkers  int           // Upper bound for the large-file lane
+	LargeFileSize int64         // Jobs at or above this size use the large-file lane
+	Interval      time.Duration // How often throughput is measured
+	MaxErrorRate  float64       // Failed share of an interval that halves the lane (0-1)
+
+	// OnAdjust is called when a lane changes size, e.g. to log it. Optional.
+	OnAdjust func(lane string, from, to int, reason string)
+}
+
+// DefaultAdaptiveConfig suits USB 2 phones up to USB 3 with fast storage
+func DefaultAdaptiveConfig() AdaptiveConfig {
+	return AdaptiveConfig{
+		MinWorkers:    1,
+		MaxWorkers:    16,
+		LargeWorkers:  3,
+		LargeFileSize: 64 << 20,
+		Interval:      3 * time.Second,
+		MaxErrorRate:  0.2,
+	}
+}
+
+// task is a unit of work handed to a lane. run reports how many attempts it
+// made, so failures absorbed by retries still count against the lane.
+type task struct {
+	size int64
+	run  func() (attempts int, err error)
+}
+
+// concurrencyLimit is a semaphore whose size can change while in use
+type concurrencyLimit struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newConcurrencyLimit(n int) *concurrencyLimit {
+	l := &concurrencyLimit{limit: n}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *concurrencyLimit) acquire() {
+	l.mu.Lock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+func (l *concurrencyLimit) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+func (l *concurrencyLimit) set(n int) {
+	l.mu.Lock()
+	l.limit = n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+func (l *concurrencyLimit) get() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// lane is a queue with its own workers and concurrency limit
+type lane struct {
+	name       string
+	tasks      chan task
+	limit      *concurrencyLimit
+	minWorkers int
+	maxWorkers int
+
+	// Counters for the current measuring interval
+	bytes  atomic.Int64
+	done   atomic.Int64
+	failed atomic.Int64
+
+	lastRate float64
+	growing  bool // Last change was an increase, so a throughput drop means we overshot
+}
+
+// scheduler runs the jobs of a pool on one lane, or on small/large lanes when adaptive
+type scheduler struct {
+	lanes     []*lane
+	largeSize int64 // 0 routes everything to lanes[0]
+	cfg       AdaptiveConfig
+	adaptive  bool
+	wg        sync.WaitGroup
+	stop      chan struct{}
+}
+
+// newScheduler creates a fixed scheduler with a single lane of workerCount workers
+func newScheduler(workerCount, buffer int) *scheduler {
+	return &scheduler{
+		lanes: []*lane{{
+			name:       "all",
+			tasks:      make(chan task, buffer),
+			limit:      newConcurrencyLimit(workerCount),
+			minWorkers: workerCount,
+			maxWorkers: workerCount,
+		}},
+		stop: make(chan struct{}),
+	}
+}
+
+// setAdaptive switches to small/large lanes. The small lane starts at the pool's
+// worker count, the large lane at one worker; both grow or shrink from there.
+func (s *scheduler) setAdaptive(cfg AdaptiveConfig) {
+	initial := s.lanes[0].limit.get()
+	buffer := cap(s.lanes[0].tasks)
+	clamp := func(n, lo, hi int) int { return max(lo, min(n, hi)) }
+
+	s.cfg = cfg
+	s.adaptive = true
+	s.largeSize = cfg.LargeFileSize
+	s.lanes = []*lane{{
+		name:       "small",
+		tasks:      make(chan task, buffer),
+		limit:      newConcurrencyLimit(clamp(initial, cfg.MinWorkers, cfg.MaxWorkers)),
+		minWorkers: cfg.MinWorkers,
+		maxWorkers: cfg.MaxWorkers,
+	}}
+	if cfg.LargeFileSize > 0 {
+		s.lanes = append(s.lanes, &lane{
+			name:       "large",
+			tasks:      make(chan task, buffer),
+			limit:      newConcurrencyLimit(clamp(1, cfg.MinWorkers, cfg.LargeWorkers)),
+			minWorkers: cfg.MinWorkers,
+			maxWorkers: cfg.LargeWorkers,
+		})
+	}
+}
+
+// start launches the workers (as many as a lane may ever use, gated by its limit)
+func (s *scheduler) start() {
+	for _, l := range s.lanes {
+		for i := 0; i < l.maxWorkers; i++ {
+			s.wg.Add(1)
+			go s.worker(l)
+		}
+	}
+	if s.adaptive && s.cfg.Interval > 0 {
+		go s.tune()
+	}
+}
+
+func (s *scheduler) worker(l *lane) {
+	defer s.wg.Done()
+	for t := range l.tasks {
+		l.limit.acquire()
+		attempts, err := t.run()
+		l.limit.release()
+		l.failed.Add(int64(max(attempts-1, 0)))
+		if err != nil {
+			l.failed.Add(1)
+		} else {
+			l.done.Add(1)
+			l.bytes.Add(t.size)
+		}
+	}
+}
+
+// submit queues a task on the lane matching its size
+func (s *scheduler) submit(t task) {
+	l := s.lanes[0]
+	if s.largeSize > 0 && t.size >= s.largeSize && len(s.lanes) > 1 {
+		l = s.lanes[1]
+	}
+	l.tasks <- t
+}
+
+// close stops accepting tasks and waits for the queued ones to finish
+func (s *scheduler) close() {
+	for _, l := range s.lanes {
+		close(l.tasks)
+	}
+	s.wg.Wait()
+	close(s.stop)
+}
+
+// workers reports the current worker limit of each lane
+func (s *scheduler) workers() map[string]int {
+	out := make(map[string]int, len(s.lanes))
+	for _, l := range s.lanes {
+		out[l.name] = l.limit.get()
+	}
+	return out
+}
+
+// tune periodically resizes each lane from the throughput and error rate it measured
+func (s *scheduler) tune() {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, l := range s.lanes {
+			bytes, done, failed := l.bytes.Swap(0), l.done.Swap(0), l.failed.Swap(0)
+			if done+failed == 0 {
+				continue // Idle lane, nothing learned
+			}
+			rate := float64(bytes) / s.cfg.Interval.Seconds()
+			errRate := float64(failed) / float64(done+failed)
+
+			cur := l.limit.get()
+			next, reason := nextWorkerCount(cur, l.minWorkers, l.maxWorkers, rate, l.lastRate, l.growing, errRate, s.cfg.MaxErrorRate)
+			l.lastRate = rate
+			l.growing = next > cur
+			if next != cur {
+				l.limit.set(next)
+				if s.cfg.OnAdjust != nil {
+					s.cfg.OnAdjust(l.name, cur, next, reason)
+				}
+			}
+		}
+	}
+}
+
+// nextWorkerCount is the tuning rule: halve on errors, keep growing while
+// throughput keeps up, step back once growing stops paying off.
+func nextWorkerCount(cur, lo, hi int, rate, lastRate float64, growing bool, errRate, maxErrRate float64) (int, string) {
+	switch {
+	case maxErrRate > 0 && errRate > maxErrRate:
+		return max(lo, cur/2), fmt.Sprintf("%.0f%% errors", errRate*100)
+	case growing && rate < lastRate*0.95:
+		return max(lo, cur-1), "throughput dropped"
+	case rate >= lastRate*0.95:
+		return min(hi, cur+1), "throughput holding"
+	}
+	return cur, ""
+}
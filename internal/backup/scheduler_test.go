@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNextWorkerCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		cur      int
+		rate     float64
+		lastRate float64
+		growing  bool
+		errRate  float64
+		want     int
+	}{
+		{"Grows While Throughput Holds", 4, 100, 100, true, 0, 5},
+		{"Capped At Max", 8, 200, 100, true, 0, 8},
+		{"Steps Back After Overshoot", 6, 80, 100, true, 0, 5},
+		{"Holds After Natural Dip", 6, 80, 100, false, 0, 6},
+		{"Halves On Errors", 6, 100, 100, true, 0.5, 3},
+		{"Never Below Min", 1, 100, 100, true, 0.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := nextWorkerCount(tt.cur, 1, 8, tt.rate, tt.lastRate, tt.growing, tt.errRate, 0.2)
+			if got != tt.want {
+				t.Errorf("nextWorkerCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// ConcurrencyProcessor records the peak number of concurrent jobs per size class
+type ConcurrencyProcessor struct {
+	mu     sync.Mutex
+	active map[bool]int
+	peak   map[bool]int
+}
+
+func (c *ConcurrencyProcessor) Process(job Job) error {
+	large := job.Size >= 1000
+	c.mu.Lock()
+	c.active[large]++
+	c.peak[large] = max(c.peak[large], c.active[large])
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.active[large]--
+	c.mu.Unlock()
+	return nil
+}
+
+func TestAdaptivePoolLanes(t *testing.T) {
+	proc := &ConcurrencyProcessor{active: map[bool]int{}, peak: map[bool]int{}}
+	cfg := DefaultAdaptiveConfig()
+	cfg.LargeFileSize = 1000
+	cfg.Interval = 0 // No tuning, only the lanes
+
+	pool := NewPool(4, proc, nil)
+	pool.SetAdaptive(cfg)
+	pool.Start()
+
+	if w := pool.Workers(); w["small"] != 4 || w["large"] != 1 {
+		t.Fatalf("Workers() = %v, want small=4 large=1", w)
+	}
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			pool.AddJob(Job{SourcePath: "/sdcard/big.mp4", Size: 5000})
+			pool.AddJob(Job{SourcePath: "/sdcard/small.jpg", Size: 10})
+		}
+		pool.Close()
+	}()
+	count := 0
+	for range pool.Results() {
+		count++
+	}
+
+	if count != 40 {
+		t.Errorf("Expected 40 results, got %d", count)
+	}
+	if proc.peak[true] != 1 {
+		t.Errorf("Large lane ran %d jobs at once, want 1", proc.peak[true])
+	}
+	if proc.peak[false] < 2 || proc.peak[false] > 4 {
+		t.Errorf("Small lane peak concurrency %d, want 2-4", proc.peak[false])
+	}
+}
+
+func TestConcurrencyLimitResize(t *testing.T) {
+	l := newConcurrencyLimit(1)
+	l.acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Second acquire should block at limit 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.set(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Raising the limit should release the waiter")
+	}
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// SnapshotEntries maps every file the plan found on the device to its copy in
+// the backup, describing the device as it was for a snapshot. Files without a
+// copy of the right size, such as failed transfers, are counted as missing.
+// Call it after the run's results have been added to m.
+func SnapshotEntries(plan *Plan, m *manifest.Manifest) (entries []manifest.Entry, missing int) {
+	byPath := make(map[string]string)
+	byName := make(map[string]string)
+	stored := make(map[string]manifest.Entry)
+	// Later entries win, they are the most recent copy of an edited file
+	for _, e := range m.Entries {
+		byPath[snapshotKey(e.OriginalPath, e.Size)] = e.LocalPath
+		byName[snapshotKey(path.Base(e.OriginalPath), e.Size)] = e.LocalPath
+		if e.Hash != "" {
+			stored[e.LocalPath] = e
+		}
+	}
+
+	for _, item := range plan.Items {
+		if item.Action == ActionExclude {
+			continue
+		}
+		f := item.File
+		var candidates []string
+		if item.DestPath != "" {
+			if rel, err := filepath.Rel(plan.DestRoot, item.DestPath); err == nil {
+				candidates = append(candidates, rel)
+			}
+		}
+		candidates = append(candidates, byPath[snapshotKey(f.Path, f.Size)], byName[snapshotKey(path.Base(f.Path), f.Size)])
+
+		found := false
+		for _, rel := range candidates {
+			if rel == "" {
+				continue
+			}
+			size := int64(-1)
+			if info, err := os.Stat(filepath.Join(plan.DestRoot, rel)); err == nil {
+				size = info.Size()
+			} else if e, ok := stored[rel]; ok {
+				size = e.Size // Encrypted repositories keep no tree, the stored object is the copy
+			}
+			if size == f.Size {
+				entries = append(entries, manifest.Entry{OriginalPath: f.Path, LocalPath: rel, Size: f.Size, Timestamp: f.Timestamp, Hash: stored[rel].Hash})
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing++
+		}
+	}
+	return entries, missing
+}
+
+func snapshotKey(name string, size int64) string {
+	return name + "|" + strconv.FormatInt(size, 10)
+}
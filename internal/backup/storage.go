@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/storage"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StorageAgent pulls files into a local staging folder and uploads them to a
+// storage backend, deleting the staged copy once it is stored
+type StorageAgent struct {
+	Pull      Processor // Usually a TransferAgent
+	Storage   storage.Storage
+	StageRoot string // Plan.DestRoot of a plan built with BuildPlanOn
+}
+
+// Process implements the Processor interface
+func (sa *StorageAgent) Process(job Job) error {
+	if err := sa.Pull.Process(job); err != nil {
+		return err
+	}
+	defer os.Remove(job.DestPath)
+
+	rel, err := filepath.Rel(sa.StageRoot, job.DestPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(job.DestPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := sa.Storage.Put(filepath.ToSlash(rel), f, info.Size()); err != nil {
+		return fmt.Errorf("upload to %s failed for %s: %w", sa.Storage, job.SourcePath, err)
+	}
+	return nil
+}
+
+// Fetch downloads the backup files of entries from st into dir, laid out
+// like the backup, so they can be restored with RestoreJobs(dir, entries)
+func Fetch(st storage.Storage, entries []manifest.Entry, dir string) error {
+	done := make(map[string]bool)
+	for _, e := range entries {
+		if done[e.LocalPath] {
+			continue // Device files deduplicated onto one backup copy
+		}
+		done[e.LocalPath] = true
+		if err := fetchFile(st, e.LocalPath, filepath.Join(dir, e.LocalPath)); err != nil {
+			return fmt.Errorf("download of %s failed: %w", e.LocalPath, err)
+		}
+	}
+	return nil
+}
+
+func fetchFile(st storage.Storage, rel, dest string) error {
+	rc, err := st.Get(filepath.ToSlash(rel))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
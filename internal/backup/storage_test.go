@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/sorter"
+	"AndroidSafeLocal/internal/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePull writes size bytes of 'x' to the job's destination like adb pull would
+type fakePull struct{}
+
+func (fakePull) Process(job Job) error {
+	os.MkdirAll(filepath.Dir(job.DestPath), 0755)
+	return os.WriteFile(job.DestPath, []byte(strings.Repeat("x", int(job.Size))), 0644)
+}
+
+func TestStorageBackup(t *testing.T) {
+	// The backup lives in a storage the plan can only see through the interface
+	st := storage.NewLocal(t.TempDir())
+	if err := st.Put("2024/01/IMG_20240101_clash.jpg", strings.NewReader("old"), 3); err != nil {
+		t.Fatal(err)
+	}
+	stage := t.TempDir()
+	files := []device.File{
+		{Path: "/sdcard/DCIM/IMG_20240101_clash.jpg", Size: 20},
+		{Path: "/sdcard/DCIM/IMG_20240102_new.jpg", Size: 10},
+	}
+	plan := BuildPlanOn(st, files, sorter.NewSorter(), nil, nil, stage)
+	if plan.Count(ActionConflict) != 1 || plan.Count(ActionNew) != 1 {
+		t.Fatalf("Plan: %s", plan.Summary())
+	}
+
+	agent := &StorageAgent{Pull: fakePull{}, Storage: st, StageRoot: stage}
+	m := manifest.New()
+	for _, job := range plan.Jobs() {
+		if err := agent.Process(job); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(job.DestPath); !os.IsNotExist(err) {
+			t.Errorf("Staged copy %s left behind", job.DestPath)
+		}
+		rel, _ := filepath.Rel(stage, job.DestPath)
+		m.Add(job.SourcePath, rel, job.Size, job.Timestamp)
+	}
+	if info, err := st.Stat("2024/01/IMG_20240101_clash_1.jpg"); err != nil || info.Size != 20 {
+		t.Errorf("Renamed upload = %+v, %v", info, err)
+	}
+	if info, _ := st.Stat("2024/01/IMG_20240101_clash.jpg"); info.Size != 3 {
+		t.Error("Existing backup file overwritten")
+	}
+
+	dir := t.TempDir()
+	if err := Fetch(st, m.Entries, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range RestoreJobs(dir, m.Entries) {
+		if info, err := os.Stat(job.LocalPath); err != nil || info.Size() != job.Size {
+			t.Errorf("Fetched %s: %v", job.LocalPath, err)
+		}
+	}
+}
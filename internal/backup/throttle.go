@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeWindow is a daily time range, e.g. working hours. End before Start wraps past midnight.
+type TimeWindow struct {
+	Start time.Duration // Offset from midnight
+	End   time.Duration
+}
+
+// ParseTimeWindow parses "HH:MM-HH:MM"
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("time window %q must look like 09:00-18:00", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("bad window start: %w", err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("bad window end: %w", err)
+	}
+	return TimeWindow{
+		Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+	}, nil
+}
+
+// Contains reports whether t's local time of day falls in the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// RateLimiter caps the bytes per second moved by every pool sharing it.
+// adb moves whole files, so the cap holds on average: a worker waits before
+// starting a file until the bytes already granted have "drained" at the set rate.
+type RateLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec int64
+	window      *TimeWindow
+	next        time.Time // When the bytes granted so far have drained
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter creates a limiter for bytesPerSec. Zero or less means unlimited.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		bytesPerSec: bytesPerSec,
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}
+}
+
+// SetRate changes the limit while transfers are running. Zero or less means unlimited.
+func (r *RateLimiter) SetRate(bytesPerSec int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytesPerSec = bytesPerSec
+}
+
+// SetWindow restricts the limit to a time of day; outside it transfers run at full speed
+func (r *RateLimiter) SetWindow(w TimeWindow) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.window = &w
+}
+
+// ClearWindow applies the limit around the clock again
+func (r *RateLimiter) ClearWindow() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.window = nil
+}
+
+// Wait blocks until n more bytes may be transferred. Safe on a nil *RateLimiter.
+func (r *RateLimiter) Wait(n int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := r.now()
+	if r.bytesPerSec <= 0 || (r.window != nil && !r.window.Contains(now)) {
+		// Don't carry debt from unlimited hours into the window
+		r.next = now
+		r.mu.Unlock()
+		return
+	}
+	start := r.next
+	if start.Before(now) {
+		start = now
+	}
+	r.next = start.Add(time.Duration(float64(n) / float64(r.bytesPerSec) * float64(time.Second)))
+	r.mu.Unlock()
+
+	if d := start.Sub(now); d > 0 {
+		r.sleep(d)
+	}
+}
+
+// String describes the limit for logs
+func (r *RateLimiter) String() string {
+	if r == nil {
+		return "unlimited"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bytesPerSec <= 0 {
+		return "unlimited"
+	}
+	s := FormatBytes(r.bytesPerSec) + "/s"
+	if r.window != nil {
+		s += fmt.Sprintf(" between %02d:%02d and %02d:%02d",
+			int(r.window.Start.Hours()), int(r.window.Start.Minutes())%60,
+			int(r.window.End.Hours()), int(r.window.End.Minutes())%60)
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local)
+	var slept []time.Duration
+
+	r := NewRateLimiter(1000) // 1000 bytes/s
+	r.now = func() time.Time { return clock }
+	r.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	r.Wait(500)  // Starts right away, drains by 10:00:00.5
+	r.Wait(2000) // Waits 0.5s, drains by 10:00:02.5
+	r.Wait(100)  // Waits 2.5s
+
+	want := []time.Duration{500 * time.Millisecond, 2500 * time.Millisecond}
+	if len(slept) != len(want) {
+		t.Fatalf("Slept %v, want %v", slept, want)
+	}
+	for i := range want {
+		if slept[i] != want[i] {
+			t.Errorf("Sleep %d = %v, want %v", i, slept[i], want[i])
+		}
+	}
+
+	// Outside the window nothing waits and the debt is forgiven
+	w, err := ParseTimeWindow("09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetWindow(w)
+	slept = nil
+	clock = time.Date(2024, 3, 1, 19, 0, 0, 0, time.Local)
+	r.Wait(1 << 30)
+	r.Wait(1 << 30)
+	if len(slept) != 0 {
+		t.Errorf("Expected no waiting outside the window, slept %v", slept)
+	}
+
+	var unlimited *RateLimiter
+	unlimited.Wait(1 << 40) // Must not panic
+}
+
+func TestTimeWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.Local) }
+
+	day, err := ParseTimeWindow("09:00-18:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night, err := ParseTimeWindow("22:00 - 06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		w    TimeWindow
+		t    time.Time
+		want bool
+	}{
+		{day, at(9, 0), true},
+		{day, at(18, 29), true},
+		{day, at(18, 30), false},
+		{day, at(8, 59), false},
+		{night, at(23, 0), true},
+		{night, at(5, 59), true},
+		{night, at(12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.w.Contains(tt.t); got != tt.want {
+			t.Errorf("%v.Contains(%s) = %v, want %v", tt.w, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+
+	if _, err := ParseTimeWindow("9am to 5pm"); err == nil {
+		t.Error("Expected an error for a malformed window")
+	}
+}
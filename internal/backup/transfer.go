@@ -21,11 +21,20 @@ func (ta *TransferAgent) Process(job Job) error {
 	}
 
 	// Run ADB Pull
-	// adb pull <remote> <local>
-	_, err := ta.Client.RunCommand("pull", job.SourcePath, job.DestPath)
+	// adb pull <remote> <local>, or su/run-as cat when an access mode is set
+	err := ta.Client.AccessPull(job.SourcePath, job.DestPath)
 	if err != nil {
 		return fmt.Errorf("adb pull failed for %s: %w", job.SourcePath, err)
 	}
 
+	// A short or padded copy must not be recorded as backed up
+	info, err := os.Stat(job.DestPath)
+	if err != nil {
+		return fmt.Errorf("adb pull failed for %s: %w", job.SourcePath, err)
+	}
+	if info.Size() != job.Size {
+		os.Remove(job.DestPath)
+		return fmt.Errorf("adb pull of %s gave %d bytes, %d expected (file changed since the scan?)", job.SourcePath, info.Size(), job.Size)
+	}
 	return nil
 }
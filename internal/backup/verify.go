@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"fmt"
+	"strings"
+)
+
+// VerifyStatus is the outcome of checking one restored file on the device
+type VerifyStatus int
+
+const (
+	VerifyOK        VerifyStatus = iota
+	VerifyMissing                // Not on the device although the push succeeded
+	VerifyTruncated              // Smaller on the device than in the backup
+	VerifyMismatch               // Larger on the device, or different content
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyMissing:
+		return "missing"
+	case VerifyTruncated:
+		return "truncated"
+	case VerifyMismatch:
+		return "mismatch"
+	}
+	return "ok"
+}
+
+// VerifyResult is the check of one pushed file
+type VerifyResult struct {
+	Decision   RestoreDecision
+	Status     VerifyStatus
+	DeviceSize int64
+	Detail     string
+}
+
+// VerifyReport lists the restored files that don't match the backup
+type VerifyReport struct {
+	Checked  int
+	Problems []VerifyResult
+}
+
+// Summary counts problems per status, e.g. "1200 checked, 2 missing, 1 truncated"
+func (r *VerifyReport) Summary() string {
+	counts := make(map[VerifyStatus]int)
+	for _, p := range r.Problems {
+		counts[p.Status]++
+	}
+	parts := []string{fmt.Sprintf("%d checked", r.Checked)}
+	for _, s := range []VerifyStatus{VerifyMissing, VerifyTruncated, VerifyMismatch} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	if len(r.Problems) == 0 {
+		parts = append(parts, "all match")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Jobs returns restore jobs that push the problem files again to where they
+// were written. Run them without a conflict checker so they overwrite.
+func (r *VerifyReport) Jobs() []RestoreJob {
+	jobs := make([]RestoreJob, len(r.Problems))
+	for i, p := range r.Problems {
+		jobs[i] = p.Decision.Job
+		jobs[i].OriginalPath = p.Decision.Target
+		jobs[i].Index = i + 1
+		jobs[i].Total = len(r.Problems)
+	}
+	return jobs
+}
+
+// RestoreVerifier checks pushed files on the device against the backup
+type RestoreVerifier struct {
+	device deviceFiles
+	hash   bool
+}
+
+// NewRestoreVerifier creates a verifier. Sizes are always compared; with hash
+// set, files of the right size are also compared by SHA-256.
+func NewRestoreVerifier(client *adb.Client, hash bool) *RestoreVerifier {
+	return &RestoreVerifier{device: client, hash: hash}
+}
+
+// Verify checks the targets of pushed decisions, as found in RestoreResult.Decision
+func (v *RestoreVerifier) Verify(pushed []RestoreDecision) (*VerifyReport, error) {
+	paths := make([]string, len(pushed))
+	for i, d := range pushed {
+		paths[i] = d.Target
+	}
+	stats, err := v.device.StatMany(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Checked: len(pushed)}
+	for _, d := range pushed {
+		res := v.check(d, stats[d.Target])
+		if res.Status != VerifyOK {
+			report.Problems = append(report.Problems, res)
+		}
+	}
+	return report, nil
+}
+
+// check compares one target with its backup file
+func (v *RestoreVerifier) check(d RestoreDecision, remote adb.RemoteStat) VerifyResult {
+	res := VerifyResult{Decision: d, DeviceSize: remote.Size}
+	switch {
+	case !remote.Exists:
+		res.Status = VerifyMissing
+	case remote.Size < d.Job.Size:
+		res.Status = VerifyTruncated
+		res.Detail = fmt.Sprintf("%s of %s", FormatBytes(remote.Size), FormatBytes(d.Job.Size))
+	case remote.Size > d.Job.Size:
+		res.Status = VerifyMismatch
+		res.Detail = fmt.Sprintf("%s, expected %s", FormatBytes(remote.Size), FormatBytes(d.Job.Size))
+	case v.hash:
+		local, err := HashFile(d.Job.LocalPath)
+		if err != nil {
+			res.Status = VerifyMismatch
+			res.Detail = "cannot hash backup file: " + err.Error()
+			break
+		}
+		device, err := v.device.Hash(d.Target)
+		if err != nil {
+			res.Status = VerifyMismatch
+			res.Detail = "cannot hash device file: " + err.Error()
+		} else if device != local {
+			res.Status = VerifyMismatch
+			res.Detail = "content differs"
+		}
+	}
+	return res
+}
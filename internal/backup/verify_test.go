@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRestore(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(local, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localHash, err := HashFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := func(target string) RestoreDecision {
+		return RestoreDecision{Job: RestoreJob{LocalPath: local, OriginalPath: "/sdcard/a.jpg", Size: 5}, Action: RestorePush, Target: target}
+	}
+	dev := &fakeDevice{
+		stats: map[string]adb.RemoteStat{
+			"/sdcard/ok.jpg":           {Exists: true, Size: 5},
+			"/sdcard/short.jpg":        {Exists: true, Size: 2},
+			"/sdcard/long.jpg":         {Exists: true, Size: 9},
+			"/sdcard/corrupt.jpg":      {Exists: true, Size: 5},
+			"/sdcard/a (restored).jpg": {Exists: true, Size: 5},
+		},
+		hashes: map[string]string{
+			"/sdcard/ok.jpg":           localHash,
+			"/sdcard/corrupt.jpg":      "0000",
+			"/sdcard/a (restored).jpg": localHash,
+		},
+	}
+	decisions := []RestoreDecision{
+		pushed("/sdcard/ok.jpg"), pushed("/sdcard/gone.jpg"), pushed("/sdcard/short.jpg"),
+		pushed("/sdcard/long.jpg"), pushed("/sdcard/corrupt.jpg"), pushed("/sdcard/a (restored).jpg"),
+	}
+
+	// Sizes only: corrupt.jpg passes
+	report, err := (&RestoreVerifier{device: dev}).Verify(decisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]VerifyStatus{"/sdcard/gone.jpg": VerifyMissing, "/sdcard/short.jpg": VerifyTruncated, "/sdcard/long.jpg": VerifyMismatch}
+	if len(report.Problems) != len(want) {
+		t.Fatalf("Expected %d problems, got %+v", len(want), report.Problems)
+	}
+	for _, p := range report.Problems {
+		if want[p.Decision.Target] != p.Status {
+			t.Errorf("%s: got %s, want %s", p.Decision.Target, p.Status, want[p.Decision.Target])
+		}
+	}
+	if got := report.Summary(); got != "6 checked, 1 missing, 1 truncated, 1 mismatch" {
+		t.Errorf("Summary = %s", got)
+	}
+
+	// With hashes corrupt.jpg is caught too
+	report, err = (&RestoreVerifier{device: dev, hash: true}).Verify(decisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 4 || report.Problems[3].Decision.Target != "/sdcard/corrupt.jpg" {
+		t.Errorf("Expected corrupt.jpg as 4th problem, got %+v", report.Problems)
+	}
+
+	// Re-push jobs go to the written target, not the original path
+	jobs := report.Jobs()
+	if jobs[0].OriginalPath != "/sdcard/gone.jpg" || jobs[0].Total != 4 || jobs[3].Index != 4 {
+		t.Errorf("Unexpected re-push jobs %+v", jobs)
+	}
+}
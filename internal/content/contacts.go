@@ -0,0 +1,242 @@
+package content
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContactsURI is the data table of the contacts provider, one row per name,
+// number, address and so on
+const ContactsURI = "content://com.android.contacts/data"
+
+var contactColumns = []string{"contact_id", "mimetype",
+	"data1", "data2", "data3", "data4", "data5", "data6", "data7", "data8", "data9", "data10"}
+
+// Mime types of the data rows that are exported
+const (
+	mimeName     = "vnd.android.cursor.item/name"
+	mimePhone    = "vnd.android.cursor.item/phone_v2"
+	mimeEmail    = "vnd.android.cursor.item/email_v2"
+	mimeOrg      = "vnd.android.cursor.item/organization"
+	mimeAddress  = "vnd.android.cursor.item/postal-address_v2"
+	mimeNote     = "vnd.android.cursor.item/note"
+	mimeEvent    = "vnd.android.cursor.item/contact_event"
+	mimeWebsite  = "vnd.android.cursor.item/website"
+	birthdayType = "3"
+)
+
+// Typed is a value with its vCard TYPE, e.g. a mobile number
+type Typed struct {
+	Type  string // "cell", "home", "work", ... or empty
+	Value string
+}
+
+// Address is a postal address
+type Address struct {
+	Type      string
+	Formatted string
+	Street    string
+	City      string
+	Region    string
+	Postcode  string
+	Country   string
+}
+
+// Contact is one aggregated contact
+type Contact struct {
+	ID       string
+	Name     string // Display name
+	Family   string
+	Given    string
+	Middle   string
+	Prefix   string
+	Suffix   string
+	Phones   []Typed
+	Emails   []Typed
+	Org      string
+	Title    string
+	Address  []Address
+	URLs     []string
+	Note     string
+	Birthday string // YYYY-MM-DD or --MM-DD
+}
+
+// Contacts reads all contacts, sorted by name
+func Contacts(sh Shell) ([]Contact, error) {
+	rows, err := Query(sh, ContactsURI, contactColumns)
+	if err != nil {
+		return nil, err
+	}
+	return contactsFromRows(rows), nil
+}
+
+var phoneTypes = map[string]string{"1": "home", "2": "cell", "3": "work", "4": "fax,work", "5": "fax,home", "6": "pager"}
+var emailTypes = map[string]string{"1": "home", "2": "work"}
+var addressTypes = map[string]string{"1": "home", "2": "work"}
+
+func contactsFromRows(rows []Row) []Contact {
+	byID := make(map[string]*Contact)
+	var order []string
+	for _, r := range rows {
+		id := r["contact_id"]
+		if id == "" {
+			continue
+		}
+		c, ok := byID[id]
+		if !ok {
+			c = &Contact{ID: id}
+			byID[id] = c
+			order = append(order, id)
+		}
+		switch r["mimetype"] {
+		case mimeName:
+			c.Name, c.Given, c.Family = r["data1"], r["data2"], r["data3"]
+			c.Prefix, c.Middle, c.Suffix = r["data4"], r["data5"], r["data6"]
+		case mimePhone:
+			if r["data1"] != "" {
+				c.Phones = append(c.Phones, Typed{phoneTypes[r["data2"]], r["data1"]})
+			}
+		case mimeEmail:
+			if r["data1"] != "" {
+				c.Emails = append(c.Emails, Typed{emailTypes[r["data2"]], r["data1"]})
+			}
+		case mimeOrg:
+			c.Org, c.Title = r["data1"], r["data4"]
+		case mimeAddress:
+			c.Address = append(c.Address, Address{
+				Type: addressTypes[r["data2"]], Formatted: r["data1"], Street: r["data4"],
+				City: r["data7"], Region: r["data8"], Postcode: r["data9"], Country: r["data10"],
+			})
+		case mimeWebsite:
+			if r["data1"] != "" {
+				c.URLs = append(c.URLs, r["data1"])
+			}
+		case mimeNote:
+			c.Note = r["data1"]
+		case mimeEvent:
+			if r["data2"] == birthdayType {
+				c.Birthday = r["data1"]
+			}
+		}
+	}
+	contacts := make([]Contact, 0, len(order))
+	for _, id := range order {
+		contacts = append(contacts, *byID[id])
+	}
+	sort.SliceStable(contacts, func(i, j int) bool {
+		return strings.ToLower(contacts[i].Name) < strings.ToLower(contacts[j].Name)
+	})
+	return contacts
+}
+
+// WriteVCard writes the contacts as vCard 4.0 (RFC 6350)
+func WriteVCard(w io.Writer, contacts []Contact) error {
+	for _, c := range contacts {
+		name := c.Name
+		if name == "" && len(c.Phones) > 0 {
+			name = c.Phones[0].Value
+		}
+		lines := []string{
+			"BEGIN:VCARD",
+			"VERSION:4.0",
+			"FN:" + escape(name),
+			"N:" + components(c.Family, c.Given, c.Middle, c.Prefix, c.Suffix),
+		}
+		for _, p := range c.Phones {
+			// tel URIs allow visual separators but no spaces
+			lines = append(lines, "TEL;VALUE=uri"+typeParam(p.Type)+":tel:"+strings.ReplaceAll(p.Value, " ", ""))
+		}
+		for _, e := range c.Emails {
+			lines = append(lines, "EMAIL"+typeParam(e.Type)+":"+escape(e.Value))
+		}
+		if c.Org != "" {
+			lines = append(lines, "ORG:"+escape(c.Org))
+		}
+		if c.Title != "" {
+			lines = append(lines, "TITLE:"+escape(c.Title))
+		}
+		for _, a := range c.Address {
+			label := ""
+			if a.Formatted != "" {
+				// Parameter values use the RFC 6868 escapes
+				label = `;LABEL="` + strings.NewReplacer("^", "^^", "\n", "^n", `"`, "^'").Replace(a.Formatted) + `"`
+			}
+			street := a.Street
+			if street == "" && a.City == "" && a.Postcode == "" {
+				street = a.Formatted // Only the formatted address is known
+			}
+			lines = append(lines, "ADR"+typeParam(a.Type)+label+":"+components("", "", street, a.City, a.Region, a.Postcode, a.Country))
+		}
+		for _, u := range c.URLs {
+			lines = append(lines, "URL:"+u)
+		}
+		if c.Birthday != "" {
+			lines = append(lines, birthday(c.Birthday))
+		}
+		if c.Note != "" {
+			lines = append(lines, "NOTE:"+escape(c.Note))
+		}
+		lines = append(lines, "END:VCARD")
+		for _, line := range lines {
+			if _, err := io.WriteString(w, fold(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func typeParam(t string) string {
+	if t == "" {
+		return ""
+	}
+	if strings.Contains(t, ",") {
+		return `;TYPE="` + t + `"`
+	}
+	return ";TYPE=" + t
+}
+
+// escape escapes a text value
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+// components joins the parts of a structured value such as N or ADR
+func components(parts ...string) string {
+	for i, p := range parts {
+		parts[i] = escape(p)
+	}
+	return strings.Join(parts, ";")
+}
+
+// fold ends a content line with CRLF, folding it at 75 octets without
+// splitting UTF-8 characters
+func fold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		n := len(string(r))
+		if width+n > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// birthday writes YYYY-MM-DD and --MM-DD dates in the basic vCard form,
+// anything else the contacts app allowed as text
+func birthday(s string) string {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return "BDAY:" + strings.ReplaceAll(s, "-", "")
+	}
+	if _, err := time.Parse("--01-02", s); err == nil {
+		return "BDAY:--" + strings.ReplaceAll(s[2:], "-", "")
+	}
+	return "BDAY;VALUE=text:" + escape(s)
+}
@@ -0,0 +1,152 @@
+package content
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/storage"
+)
+
+func TestParseRows(t *testing.T) {
+	columns := []string{"_id", "address", "body", "type"}
+	tests := []struct {
+		name string
+		out  string
+		want []Row
+	}{
+		{"empty", "No result found.", nil},
+		{"simple", "Row: 0 _id=1, address=+4915123, body=Hi, type=1",
+			[]Row{{"_id": "1", "address": "+4915123", "body": "Hi", "type": "1"}}},
+		{"comma and line break in value",
+			"Row: 0 _id=1, address=Bank, body=Your code, valid 5 min:\r\nRow: 12, type=1\nRow: 1 _id=2, address=NULL, body=, type=2",
+			[]Row{
+				{"_id": "1", "address": "Bank", "body": "Your code, valid 5 min:\nRow: 12", "type": "1"},
+				{"_id": "2", "body": "", "type": "2"},
+			}},
+		{"column missing", "Row: 0 _id=3, body=x=y, type=1",
+			[]Row{{"_id": "3", "body": "x=y", "type": "1"}}},
+	}
+	for _, tt := range tests {
+		rows := ParseRows(tt.out, columns)
+		if len(rows) != len(tt.want) {
+			t.Errorf("%s: got %d rows, want %d", tt.name, len(rows), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if len(rows[i]) != len(want) {
+				t.Errorf("%s: row %d = %q, want %q", tt.name, i, rows[i], want)
+				continue
+			}
+			for col, v := range want {
+				if got, ok := rows[i][col]; !ok || got != v {
+					t.Errorf("%s: row %d %s = %q, want %q", tt.name, i, col, got, v)
+				}
+			}
+		}
+	}
+}
+
+// fakeShell answers content queries by URI
+type fakeShell map[string]string
+
+func (f fakeShell) Shell(args ...string) (string, error) {
+	for i, a := range args {
+		if a == "--uri" {
+			if out, ok := f[args[i+1]]; ok {
+				return out, nil
+			}
+		}
+	}
+	return "No result found.", nil
+}
+
+func TestExport(t *testing.T) {
+	sh := fakeShell{
+		ContactsURI: "Row: 0 contact_id=7, mimetype=vnd.android.cursor.item/name, data1=Zoë Müller, data2=Zoë, data3=Müller, data4=NULL, data5=NULL, data6=NULL, data7=NULL, data8=NULL, data9=NULL, data10=NULL\n" +
+			"Row: 1 contact_id=7, mimetype=vnd.android.cursor.item/phone_v2, data1=+49 151 2345, data2=2, data3=NULL, data4=NULL, data5=NULL, data6=NULL, data7=NULL, data8=NULL, data9=NULL, data10=NULL\n" +
+			"Row: 2 contact_id=7, mimetype=vnd.android.cursor.item/note, data1=Met at the café; likes tea, data2=NULL, data3=NULL, data4=NULL, data5=NULL, data6=NULL, data7=NULL, data8=NULL, data9=NULL, data10=NULL\n" +
+			"Row: 3 contact_id=7, mimetype=vnd.android.cursor.item/contact_event, data1=1990-05-17, data2=3, data3=NULL, data4=NULL, data5=NULL, data6=NULL, data7=NULL, data8=NULL, data9=NULL, data10=NULL\n" +
+			"Row: 4 contact_id=2, mimetype=vnd.android.cursor.item/name, data1=Anna, data2=Anna, data3=NULL, data4=NULL, data5=NULL, data6=NULL, data7=NULL, data8=NULL, data9=NULL, data10=NULL",
+		SMSURI:             "Row: 0 _id=1, thread_id=1, address=+491512345, date=1709632500000, type=1, read=1, subject=NULL, body=See you, at 5",
+		MMSURI:             "Row: 0 _id=4, thread_id=1, date=1709632400, msg_box=2, read=1, sub=NULL",
+		MMSPartURI:         "Row: 0 _id=9, mid=4, ct=application/smil, name=NULL, cl=smil.xml, text=<smil/>\nRow: 1 _id=10, mid=4, ct=image/jpeg, name=NULL, cl=IMG_1.jpg, text=NULL\nRow: 2 _id=11, mid=4, ct=text/plain, name=NULL, cl=text_0.txt, text=Look!",
+		MMSURI + "/4/addr": "Row: 0 address=insert-address-token, type=137\nRow: 1 address=+491512345, type=151",
+		CallsURI:           "Row: 0 _id=1, number=+491512345, name=Zoë Müller, date=1709632600000, duration=63, type=2",
+	}
+	st := storage.NewLocal(t.TempDir())
+	results, err := Export(sh, st, Kinds, JSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("%s: %v", res.Kind, res.Err)
+		}
+	}
+
+	vcf := readAll(t, st, "contacts.vcf")
+	for _, want := range []string{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Anna\r\n",
+		"FN:Zoë Müller\r\nN:Müller;Zoë;;;\r\n",
+		"TEL;VALUE=uri;TYPE=cell:tel:+491512345\r\n",
+		"NOTE:Met at the café\\; likes tea\r\n",
+		"BDAY:19900517\r\n",
+	} {
+		if !strings.Contains(vcf, want) {
+			t.Errorf("contacts.vcf lacks %q:\n%s", want, vcf)
+		}
+	}
+
+	var doc messagesDoc
+	if err := json.Unmarshal([]byte(readAll(t, st, "messages.json")), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Messages) != 2 {
+		t.Fatalf("Got %d messages, want 2", len(doc.Messages))
+	}
+	mms, sms := doc.Messages[0], doc.Messages[1]
+	if mms.Kind != "mms" || mms.Box != "sent" || mms.Address != "+491512345" || mms.Body != "Look!" ||
+		len(mms.Attachments) != 1 || mms.Attachments[0].Name != "IMG_1.jpg" {
+		t.Errorf("MMS = %+v", mms)
+	}
+	if sms.Body != "See you, at 5" || sms.Box != "inbox" || sms.Date.UnixMilli() != 1709632500000 {
+		t.Errorf("SMS = %+v", sms)
+	}
+
+	m, err := manifest.LoadFrom(st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 3 || m.Data[0].Records != 2 || m.Data[2].LocalPath != "calls.json" || len(m.Entries) != 0 {
+		t.Errorf("Manifest data = %+v", m.Data)
+	}
+
+	// A second export replaces the records instead of adding to them
+	if _, err := Export(sh, st, []string{KindCalls}, XML, nil); err != nil {
+		t.Fatal(err)
+	}
+	m, _ = manifest.LoadFrom(st, nil)
+	if len(m.Data) != 3 || m.Data[2].LocalPath != "calls.xml" {
+		t.Errorf("Manifest data after XML export = %+v", m.Data)
+	}
+	if xml := readAll(t, st, "calls.xml"); !strings.Contains(xml, `number="+491512345"`) || !strings.Contains(xml, `type="outgoing"`) {
+		t.Errorf("calls.xml:\n%s", xml)
+	}
+}
+
+func readAll(t *testing.T, st storage.Storage, name string) string {
+	t.Helper()
+	rc, err := st.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,144 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/storage"
+)
+
+// Kinds of phone data that can be exported
+const (
+	KindContacts = "contacts"
+	KindMessages = "messages"
+	KindCalls    = "calls"
+)
+
+// Kinds lists every kind, in export order
+var Kinds = []string{KindContacts, KindMessages, KindCalls}
+
+// Format of the messages and calls files; contacts are always vCard
+type Format string
+
+const (
+	JSON Format = "json"
+	XML  Format = "xml"
+)
+
+// ParseFormat accepts json or xml
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, XML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use json or xml", s)
+}
+
+// Result is the outcome of one kind
+type Result struct {
+	Kind string
+	Data manifest.DataFile
+	Err  error
+}
+
+type messagesDoc struct {
+	XMLName  xml.Name  `json:"-" xml:"messages"`
+	Messages []Message `json:"messages" xml:"message"`
+}
+
+type callsDoc struct {
+	XMLName xml.Name `json:"-" xml:"calls"`
+	Calls   []Call   `json:"calls" xml:"call"`
+}
+
+// Export queries the given kinds of data, writes them to the root of st
+// (contacts.vcf, messages.json, calls.json) and records them in its manifest.
+// A kind that can't be read doesn't stop the others. onResult, if not nil,
+// is called after each kind.
+func Export(sh Shell, st storage.Storage, kinds []string, format Format, onResult func(Result)) ([]Result, error) {
+	m, err := manifest.OpenFrom(st, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	var results []Result
+	for _, kind := range kinds {
+		res := exportKind(sh, st, kind, format)
+		if res.Err == nil {
+			m.SetData(res.Data)
+		}
+		if onResult != nil {
+			onResult(res)
+		}
+		results = append(results, res)
+	}
+	return results, m.SaveTo(st, nil)
+}
+
+func exportKind(sh Shell, st storage.Storage, kind string, format Format) Result {
+	res := Result{Kind: kind}
+	var (
+		data    []byte
+		records int
+		sources []string
+		name    = kind + "." + string(format)
+	)
+	switch kind {
+	case KindContacts:
+		contacts, err := Contacts(sh)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		var buf bytes.Buffer
+		if res.Err = WriteVCard(&buf, contacts); res.Err != nil {
+			return res
+		}
+		data, records, sources, name = buf.Bytes(), len(contacts), []string{ContactsURI}, "contacts.vcf"
+	case KindMessages:
+		messages, err := Messages(sh)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		data, res.Err = encode(format, messagesDoc{Messages: messages})
+		records, sources = len(messages), []string{SMSURI, MMSURI, MMSPartURI}
+	case KindCalls:
+		calls, err := Calls(sh)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		data, res.Err = encode(format, callsDoc{Calls: calls})
+		records, sources = len(calls), []string{CallsURI}
+	default:
+		res.Err = fmt.Errorf("unknown kind %q, use one of %v", kind, Kinds)
+	}
+	if res.Err != nil {
+		return res
+	}
+	if res.Err = st.Put(name, bytes.NewReader(data), int64(len(data))); res.Err != nil {
+		return res
+	}
+	res.Data = manifest.DataFile{
+		Kind:      kind,
+		Sources:   sources,
+		LocalPath: name,
+		Records:   records,
+		Size:      int64(len(data)),
+		Timestamp: time.Now().Format("2006-01-02 15:04"),
+	}
+	return res
+}
+
+func encode(format Format, doc any) ([]byte, error) {
+	if format == XML {
+		data, err := xml.MarshalIndent(doc, "", "  ")
+		return append([]byte(xml.Header), data...), err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
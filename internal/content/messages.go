@@ -0,0 +1,190 @@
+package content
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Provider URIs of the messages and calls
+const (
+	SMSURI     = "content://sms"
+	MMSURI     = "content://mms"
+	MMSPartURI = "content://mms/part"
+	CallsURI   = "content://call_log/calls"
+)
+
+var (
+	smsColumns     = []string{"_id", "thread_id", "address", "date", "type", "read", "subject", "body"}
+	mmsColumns     = []string{"_id", "thread_id", "date", "msg_box", "read", "sub"}
+	mmsPartColumns = []string{"_id", "mid", "ct", "name", "cl", "text"}
+	mmsAddrColumns = []string{"address", "type"}
+	callColumns    = []string{"_id", "number", "name", "date", "duration", "type"}
+)
+
+// smsBoxes names the type column of sms and the msg_box column of mms
+var smsBoxes = map[string]string{"1": "inbox", "2": "sent", "3": "draft", "4": "outbox", "5": "failed", "6": "queued"}
+
+var callTypes = map[string]string{"1": "incoming", "2": "outgoing", "3": "missed", "4": "voicemail", "5": "rejected", "6": "blocked", "7": "answered elsewhere"}
+
+// MMS address types (PduHeaders)
+const (
+	mmsFrom = "137"
+	mmsTo   = "151"
+	mmsCc   = "130"
+)
+
+// Attachment is a non-text part of an MMS. Only its type and name are
+// exported, not the content.
+type Attachment struct {
+	ContentType string `json:"content_type" xml:"type,attr"`
+	Name        string `json:"name,omitempty" xml:"name,attr,omitempty"`
+}
+
+// Message is an SMS or MMS
+type Message struct {
+	ID          string       `json:"id" xml:"id,attr"`
+	Kind        string       `json:"kind" xml:"kind,attr"` // sms or mms
+	Thread      string       `json:"thread" xml:"thread,attr"`
+	Box         string       `json:"box" xml:"box,attr"` // inbox, sent, draft, ...
+	Address     string       `json:"address" xml:"address,attr"`
+	Recipients  []string     `json:"recipients,omitempty" xml:"recipient,omitempty"` // MMS to and cc
+	Date        time.Time    `json:"date" xml:"date,attr"`
+	Read        bool         `json:"read" xml:"read,attr"`
+	Subject     string       `json:"subject,omitempty" xml:"subject,omitempty"`
+	Body        string       `json:"body" xml:"body"`
+	Attachments []Attachment `json:"attachments,omitempty" xml:"attachment,omitempty"`
+}
+
+// Call is a call log entry
+type Call struct {
+	ID       string    `json:"id" xml:"id,attr"`
+	Number   string    `json:"number" xml:"number,attr"`
+	Name     string    `json:"name,omitempty" xml:"name,attr,omitempty"` // Cached contact name
+	Date     time.Time `json:"date" xml:"date,attr"`
+	Duration int64     `json:"duration" xml:"duration,attr"` // Seconds
+	Type     string    `json:"type" xml:"type,attr"`
+}
+
+// Messages reads all SMS and MMS, oldest first. MMS addresses are queried per
+// message, which takes a while with many MMS.
+func Messages(sh Shell) ([]Message, error) {
+	rows, err := Query(sh, SMSURI, smsColumns)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(rows))
+	for _, r := range rows {
+		messages = append(messages, Message{
+			ID:      r["_id"],
+			Kind:    "sms",
+			Thread:  r["thread_id"],
+			Box:     smsBoxes[r["type"]],
+			Address: r["address"],
+			Date:    time.UnixMilli(r.Int("date")),
+			Read:    r["read"] == "1",
+			Subject: r["subject"],
+			Body:    r["body"],
+		})
+	}
+
+	rows, err = Query(sh, MMSURI, mmsColumns)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := Query(sh, MMSPartURI, mmsPartColumns)
+	if err != nil {
+		return nil, err
+	}
+	partsOf := make(map[string][]Row)
+	for _, p := range parts {
+		partsOf[p["mid"]] = append(partsOf[p["mid"]], p)
+	}
+	for _, r := range rows {
+		m := Message{
+			ID:      r["_id"],
+			Kind:    "mms",
+			Thread:  r["thread_id"],
+			Box:     smsBoxes[r["msg_box"]],
+			Date:    time.Unix(r.Int("date"), 0), // Seconds, unlike sms
+			Read:    r["read"] == "1",
+			Subject: r["sub"],
+		}
+		addMMSParts(&m, partsOf[m.ID])
+		addrs, err := Query(sh, MMSURI+"/"+m.ID+"/addr", mmsAddrColumns)
+		if err != nil {
+			return nil, err
+		}
+		addMMSAddresses(&m, addrs)
+		messages = append(messages, m)
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Date.Before(messages[j].Date) })
+	return messages, nil
+}
+
+func addMMSParts(m *Message, parts []Row) {
+	for _, p := range parts {
+		switch ct := p["ct"]; ct {
+		case "application/smil":
+			// Layout only
+		case "text/plain":
+			if m.Body != "" {
+				m.Body += "\n"
+			}
+			m.Body += p["text"]
+		default:
+			name := p["name"]
+			if name == "" {
+				name = p["cl"]
+			}
+			m.Attachments = append(m.Attachments, Attachment{ContentType: ct, Name: name})
+		}
+	}
+}
+
+func addMMSAddresses(m *Message, addrs []Row) {
+	for _, a := range addrs {
+		address := a["address"]
+		if address == "" || address == "insert-address-token" {
+			continue // Placeholder for this phone's own number
+		}
+		switch a["type"] {
+		case mmsFrom:
+			m.Address = address
+		case mmsTo, mmsCc:
+			m.Recipients = append(m.Recipients, address)
+		}
+	}
+	// Sent MMS have no useful sender, name the first recipient like sms does
+	if m.Address == "" && len(m.Recipients) > 0 {
+		m.Address = m.Recipients[0]
+	}
+}
+
+// Calls reads the call log, oldest first
+func Calls(sh Shell) ([]Call, error) {
+	rows, err := Query(sh, CallsURI, callColumns)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]Call, 0, len(rows))
+	for _, r := range rows {
+		calls = append(calls, Call{
+			ID:       r["_id"],
+			Number:   r["number"],
+			Name:     r["name"],
+			Date:     time.UnixMilli(r.Int("date")),
+			Duration: r.Int("duration"),
+			Type:     callTypeName(r["type"]),
+		})
+	}
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].Date.Before(calls[j].Date) })
+	return calls, nil
+}
+
+func callTypeName(t string) string {
+	if name, ok := callTypes[t]; ok {
+		return name
+	}
+	return "type " + strconv.Quote(t)
+}
@@ -0,0 +1,77 @@
+package content
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Shell runs a command on the device, as adb.Client does
+type Shell interface {
+	Shell(args ...string) (string, error)
+}
+
+// Row is one result row by column name. NULL values are left out.
+type Row map[string]string
+
+// Int returns a numeric column, 0 if it is missing or not a number
+func (r Row) Int(column string) int64 {
+	n, _ := strconv.ParseInt(r[column], 10, 64)
+	return n
+}
+
+// Query runs content query on a provider URI and parses the rows of the
+// given columns
+func Query(sh Shell, uri string, columns []string) ([]Row, error) {
+	out, err := sh.Shell("content", "query", "--uri", uri, "--projection", strings.Join(columns, ":"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseRows(out, columns), nil
+}
+
+// ParseRows parses content query output:
+//
+//	Row: 0 _id=1, address=+4915123, body=Hi, see you
+//	at 5, type=1
+//
+// Values are not quoted and may contain ", " and line breaks. A row only starts
+// at "Row: <next index> " and a value only ends where ", <next column>=" follows,
+// so message text rarely confuses the parser.
+func ParseRows(out string, columns []string) []Row {
+	var texts []string
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Row: "+strconv.Itoa(len(texts))+" "); ok {
+			texts = append(texts, rest)
+		} else if len(texts) > 0 {
+			texts[len(texts)-1] += "\n" + line
+		}
+	}
+	rows := make([]Row, 0, len(texts))
+	for _, text := range texts {
+		rows = append(rows, parseRow(text, columns))
+	}
+	return rows
+}
+
+func parseRow(text string, columns []string) Row {
+	row := make(Row)
+	for i, col := range columns {
+		rest, ok := strings.CutPrefix(text, col+"=")
+		if !ok {
+			// Columns the provider doesn't know are missing from the output
+			continue
+		}
+		end := len(rest)
+		for _, next := range columns[i+1:] {
+			if j := strings.Index(rest, ", "+next+"="); j >= 0 {
+				end = j
+				break
+			}
+		}
+		if value := rest[:end]; value != "NULL" {
+			row[col] = value
+		}
+		text = strings.TrimPrefix(rest[end:], ", ")
+	}
+	return row
+}
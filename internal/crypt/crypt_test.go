@@ -0,0 +1,114 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	_, kr, err := NewKeyFile("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, 3*ChunkSize + 17} {
+		plain := bytes.Repeat([]byte("photo"), size/5+1)[:size]
+		var sealed bytes.Buffer
+		if err := kr.Encrypt(&sealed, bytes.NewReader(plain)); err != nil {
+			t.Fatal(err)
+		}
+		if size >= 32 && bytes.Contains(sealed.Bytes(), plain[:32]) {
+			t.Errorf("size %d: plaintext visible in the encrypted data", size)
+		}
+		var out bytes.Buffer
+		if err := kr.Decrypt(&out, bytes.NewReader(sealed.Bytes())); err != nil || !bytes.Equal(out.Bytes(), plain) {
+			t.Errorf("size %d: round trip failed (%v)", size, err)
+		}
+
+		data := sealed.Bytes()
+		flipped := bytes.Clone(data)
+		flipped[len(flipped)-1] ^= 1
+		truncated := data[:headerSize]
+		if size >= ChunkSize {
+			truncated = data[:len(data)-ChunkSize/2]
+		}
+		for name, bad := range map[string][]byte{"flipped": flipped, "truncated": truncated} {
+			if err := kr.Decrypt(&bytes.Buffer{}, bytes.NewReader(bad)); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("size %d, %s: expected ErrCorrupt, got %v", size, name, err)
+			}
+		}
+	}
+
+	// Dropping the whole last chunk of a multi-chunk file
+	var sealed bytes.Buffer
+	kr.Encrypt(&sealed, bytes.NewReader(make([]byte, 2*ChunkSize+5)))
+	cut := sealed.Bytes()[:headerSize+2*(ChunkSize+tagSize)]
+	if err := kr.Decrypt(&bytes.Buffer{}, bytes.NewReader(cut)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Dropped last chunk: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestKeyFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	kf, kr, err := NewKeyFile("old secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kf.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := kr.Seal([]byte("manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kf, err = LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kf.Unlock("guess"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := kf.ChangePassphrase("old secret", "new secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kf.Unlock("old secret"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Error("Old passphrase still opens the key file")
+	}
+
+	rotated, err := kf.Rotate("new secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Current() != 2 || len(kf.Keys) != 2 {
+		t.Fatalf("After rotation: current key %d, %d keys", rotated.Current(), len(kf.Keys))
+	}
+	// Data from before the rotation still opens, new data uses the new key
+	if plain, err := rotated.Unseal(before); err != nil || string(plain) != "manifest" {
+		t.Errorf("Unseal with rotated keyring = %q, %v", plain, err)
+	}
+	after, _ := rotated.Seal([]byte("manifest"))
+	if id, _ := KeyID(bytes.NewReader(after)); id != 2 {
+		t.Errorf("New data encrypted with key %d, want 2", id)
+	}
+
+	// Identical content keeps its ID across rotations
+	a, b := kr.NewID(), rotated.NewID()
+	a.Write([]byte("same"))
+	b.Write([]byte("same"))
+	if !bytes.Equal(a.Sum(nil), b.Sum(nil)) {
+		t.Error("Content ID changed with the data key")
+	}
+
+	if n := kf.Retire(); n != 1 {
+		t.Errorf("Retire dropped %d keys, want 1", n)
+	}
+	retired, err := kf.Unlock("new secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Unseal(before); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for data of a retired key, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeySize is the length of every key: AES-256 data keys, the content ID key
+// and the key-encryption key derived from the passphrase
+const KeySize = 32
+
+// ErrWrongPassphrase is returned when the passphrase does not open the key file
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// KDF holds the Argon2id parameters the key-encryption key was derived with.
+// They are stored so they can be raised for new key files without breaking old ones.
+type KDF struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultKDF costs about a second and 64 MiB on a laptop
+func DefaultKDF() KDF {
+	return KDF{Name: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+func (k KDF) derive(passphrase string) ([]byte, error) {
+	if k.Name != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation %q", k.Name)
+	}
+	return argon2.IDKey([]byte(passphrase), k.Salt, k.Time, k.Memory, k.Threads, KeySize), nil
+}
+
+// WrappedKey is a key encrypted with the key-encryption key
+type WrappedKey struct {
+	ID      uint32    `json:"id"`
+	Created time.Time `json:"created"`
+	Nonce   []byte    `json:"nonce"`
+	Sealed  []byte    `json:"sealed"`
+}
+
+// KeyFile stores the keys of an encrypted repository, each wrapped with a key
+// derived from the passphrase. Data keys are rotated by adding a new current
+// key; older ones stay until nothing is encrypted with them any more.
+type KeyFile struct {
+	Version int          `json:"version"`
+	KDF     KDF          `json:"kdf"`
+	IDKey   WrappedKey   `json:"id_key"` // Names objects, never rotated so identical content keeps one ID
+	Keys    []WrappedKey `json:"keys"`
+	Current uint32       `json:"current"`
+}
+
+// NewKeyFile creates random keys protected by passphrase
+func NewKeyFile(passphrase string) (*KeyFile, *Keyring, error) {
+	if passphrase == "" {
+		return nil, nil, errors.New("the passphrase must not be empty")
+	}
+	kr := &Keyring{keys: make(map[uint32][]byte), current: 1}
+	var err error
+	if kr.idKey, err = randomBytes(KeySize); err != nil {
+		return nil, nil, err
+	}
+	if kr.keys[1], err = randomBytes(KeySize); err != nil {
+		return nil, nil, err
+	}
+	kf := &KeyFile{Version: 1, Current: 1}
+	if err := kf.wrap(kr, passphrase, DefaultKDF()); err != nil {
+		return nil, nil, err
+	}
+	return kf, kr, nil
+}
+
+// LoadKeyFile reads a key file written by Save
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("key file: %w", err)
+	}
+	if kf.Version != 1 {
+		return nil, fmt.Errorf("unsupported key file version %d", kf.Version)
+	}
+	return &kf, nil
+}
+
+// Save writes the key file, replacing the previous one only once it is complete
+func (kf *KeyFile) Save(path string) error {
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Unlock derives the key-encryption key from passphrase and unwraps every key
+func (kf *KeyFile) Unlock(passphrase string) (*Keyring, error) {
+	kek, err := kf.KDF.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	kr := &Keyring{keys: make(map[uint32][]byte), current: kf.Current}
+	if kr.idKey, err = unwrap(kek, kf.IDKey, "id"); err != nil {
+		return nil, err
+	}
+	for _, w := range kf.Keys {
+		if kr.keys[w.ID], err = unwrap(kek, w, keyLabel(w.ID)); err != nil {
+			return nil, err
+		}
+	}
+	if kr.keys[kf.Current] == nil {
+		return nil, fmt.Errorf("key file has no key %d", kf.Current)
+	}
+	return kr, nil
+}
+
+// ChangePassphrase wraps the same keys with a new passphrase and a fresh salt.
+// Nothing in the repository needs re-encrypting.
+func (kf *KeyFile) ChangePassphrase(old, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("the passphrase must not be empty")
+	}
+	kr, err := kf.Unlock(old)
+	if err != nil {
+		return err
+	}
+	return kf.wrap(kr, passphrase, kf.KDF)
+}
+
+// Rotate adds a new data key and makes it current. Data encrypted with the
+// older keys can still be read; re-encrypt it, then call Retire.
+func (kf *KeyFile) Rotate(passphrase string) (*Keyring, error) {
+	kr, err := kf.Unlock(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	next := kr.current
+	for id := range kr.keys {
+		next = max(next, id)
+	}
+	next++
+	if kr.keys[next], err = randomBytes(KeySize); err != nil {
+		return nil, err
+	}
+	kr.current = next
+	if err := kf.wrap(kr, passphrase, kf.KDF); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// Retire drops every data key except the current one
+func (kf *KeyFile) Retire() int {
+	var kept []WrappedKey
+	for _, w := range kf.Keys {
+		if w.ID == kf.Current {
+			kept = append(kept, w)
+		}
+	}
+	retired := len(kf.Keys) - len(kept)
+	kf.Keys = kept
+	return retired
+}
+
+// wrap (re)encrypts the keys of kr with a key derived from passphrase and a new salt
+func (kf *KeyFile) wrap(kr *Keyring, passphrase string, kdf KDF) error {
+	var err error
+	if kdf.Salt, err = randomBytes(16); err != nil {
+		return err
+	}
+	kek, err := kdf.derive(passphrase)
+	if err != nil {
+		return err
+	}
+	created := make(map[uint32]time.Time)
+	for _, w := range kf.Keys {
+		created[w.ID] = w.Created
+	}
+
+	idKey, err := wrapKey(kek, 0, kr.idKey, "id")
+	if err != nil {
+		return err
+	}
+	idKey.Created = kf.IDKey.Created
+	if idKey.Created.IsZero() {
+		idKey.Created = time.Now()
+	}
+	var keys []WrappedKey
+	for id := uint32(1); len(keys) < len(kr.keys); id++ {
+		key, ok := kr.keys[id]
+		if !ok {
+			continue
+		}
+		w, err := wrapKey(kek, id, key, keyLabel(id))
+		if err != nil {
+			return err
+		}
+		w.Created = created[id]
+		if w.Created.IsZero() {
+			w.Created = time.Now()
+		}
+		keys = append(keys, w)
+	}
+	kf.KDF, kf.IDKey, kf.Keys, kf.Current = kdf, idKey, keys, kr.current
+	return nil
+}
+
+// keyLabel binds a wrapped key to its ID, so keys can't be swapped in the file
+func keyLabel(id uint32) string {
+	return "key " + strconv.FormatUint(uint64(id), 10)
+}
+
+func wrapKey(kek []byte, id uint32, key []byte, label string) (WrappedKey, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{ID: id, Nonce: nonce, Sealed: aead.Seal(nil, nonce, key, []byte(label))}, nil
+}
+
+func unwrap(kek []byte, w WrappedKey, label string) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("key file: bad nonce for %s", label)
+	}
+	key, err := aead.Open(nil, w.Nonce, w.Sealed, []byte(label))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
@@ -0,0 +1,190 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Encrypted data is a header followed by AES-256-GCM sealed chunks:
+//
+//	magic (8) | key ID (4) | nonce prefix (7)
+//	chunk: up to ChunkSize bytes of plaintext + 16 byte tag
+//
+// Each chunk's nonce is the prefix, its index and a flag marking the last
+// chunk, and the header is authenticated with every chunk, so chunks can't be
+// reordered, dropped, truncated or moved between files.
+const (
+	ChunkSize  = 64 * 1024
+	magic      = "ASLENC01"
+	prefixSize = 7
+	headerSize = len(magic) + 4 + prefixSize
+	tagSize    = 16
+)
+
+var (
+	// ErrCorrupt means encrypted data was modified, truncated or is not ours
+	ErrCorrupt = errors.New("encrypted data is corrupt or was tampered with")
+	// ErrUnknownKey means data was encrypted with a key the key file no longer has
+	ErrUnknownKey = errors.New("encrypted with a key that is not in the key file")
+)
+
+// Keyring holds the unwrapped keys of a key file
+type Keyring struct {
+	keys    map[uint32][]byte
+	current uint32
+	idKey   []byte
+}
+
+// Current returns the ID of the key new data is encrypted with
+func (kr *Keyring) Current() uint32 {
+	return kr.current
+}
+
+// NewID returns a keyed hash for naming content. Unlike a plain SHA-256 it
+// doesn't let someone holding the encrypted files test whether a known file is among them.
+func (kr *Keyring) NewID() hash.Hash {
+	return hmac.New(sha256.New, kr.idKey)
+}
+
+// Encrypt reads src to the end and writes it encrypted with the current key
+func (kr *Keyring) Encrypt(dst io.Writer, src io.Reader) error {
+	aead, err := newGCM(kr.keys[kr.current])
+	if err != nil {
+		return err
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], kr.current)
+	prefix, err := randomBytes(prefixSize)
+	if err != nil {
+		return err
+	}
+	copy(header[len(magic)+4:], prefix)
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	in := bufio.NewReaderSize(src, ChunkSize)
+	plain := make([]byte, ChunkSize)
+	sealed := make([]byte, 0, ChunkSize+tagSize)
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(in, plain)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			// A full chunk is the last one when nothing follows it
+			if _, err := in.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, index, last), plain[:n], header)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Decrypt reads data written by Encrypt and writes the plaintext. Nothing of a
+// chunk is written before it has been authenticated; on ErrCorrupt, discard
+// what was written.
+func (kr *Keyring) Decrypt(dst io.Writer, src io.Reader) error {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return ErrCorrupt
+	}
+	id, err := headerKey(header)
+	if err != nil {
+		return err
+	}
+	key, ok := kr.keys[id]
+	if !ok {
+		return fmt.Errorf("key %d: %w", id, ErrUnknownKey)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	prefix := header[len(magic)+4:]
+
+	in := bufio.NewReaderSize(src, ChunkSize+tagSize)
+	sealed := make([]byte, ChunkSize+tagSize)
+	plain := make([]byte, 0, ChunkSize)
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(in, sealed)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			if _, err := in.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		plain, err = aead.Open(plain[:0], chunkNonce(prefix, index, last), sealed[:n], header)
+		if err != nil {
+			return ErrCorrupt
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// KeyID returns the ID of the key encrypted data was written with, reading only its header
+func KeyID(src io.Reader) (uint32, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return 0, ErrCorrupt
+	}
+	return headerKey(header)
+}
+
+// Seal encrypts a small value such as a manifest in memory
+func (kr *Keyring) Seal(plain []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := kr.Encrypt(&buf, bytes.NewReader(plain))
+	return buf.Bytes(), err
+}
+
+// Unseal decrypts a value written by Seal
+func (kr *Keyring) Unseal(sealed []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := kr.Decrypt(&buf, bytes.NewReader(sealed))
+	return buf.Bytes(), err
+}
+
+func headerKey(header []byte) (uint32, error) {
+	if string(header[:len(magic)]) != magic {
+		return 0, ErrCorrupt
+	}
+	return binary.BigEndian.Uint32(header[len(magic):]), nil
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
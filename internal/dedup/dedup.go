@@ -2,8 +2,10 @@ package dedup
 
 import (
 	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/storage"
 	"fmt"
-	"os"
+	"path"
 	"path/filepath"
 	"sync"
 )
@@ -34,24 +36,38 @@ func NewRegistry() *Registry {
 
 // Load scans the local backup directory and populates the registry
 func (r *Registry) Load(rootPath string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return r.LoadFrom(storage.NewLocal(rootPath))
+}
 
-	return filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip unreadable
-		}
-		if info.IsDir() {
-			return nil
-		}
+// LoadFrom lists the files of a backup storage and populates the registry.
+// Snapshots (.snapshots) and the object store (.objects) aren't listed, they
+// only hold links to files already indexed here.
+func (r *Registry) LoadFrom(st storage.Storage) error {
+	infos, err := st.List("")
+	if err != nil {
+		return err
+	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, info := range infos {
 		// Key: Filename + Size.
 		// Timestamp is tricky because Android fs time vs Windows fs time might drift or be set differently.
 		// Filename + Size is a strong enough heuristic for personal photos.
-		key := makeKey(info.Name(), info.Size())
-		r.files[key] = true
-		return nil
-	})
+		r.files[makeKey(path.Base(info.Name), info.Size)] = true
+	}
+	return nil
+}
+
+// AddEntries registers the files of a manifest, for backups without a tree
+// to scan such as encrypted repositories
+func (r *Registry) AddEntries(entries []manifest.Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range entries {
+		r.files[makeKey(path.Base(e.OriginalPath), e.Size)] = true
+	}
 }
 
 // Exists checks if a file is already in the registry
@@ -0,0 +1,184 @@
+package device
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+// VolumeKind is the kind of storage a volume lives on
+type VolumeKind string
+
+const (
+	VolumeInternal VolumeKind = "internal"
+	VolumeSD       VolumeKind = "sd"
+	VolumeUSB      VolumeKind = "usb"
+)
+
+// Volume is a storage volume the device shows under /storage
+type Volume struct {
+	Kind  VolumeKind `json:"kind"`
+	UUID  string     `json:"uuid,omitempty"` // Filesystem ID of removable volumes, e.g. ABCD-1234
+	Path  string     `json:"path"`           // Root to back up, e.g. /storage/ABCD-1234
+	Total int64      `json:"total,omitempty"`
+	Free  int64      `json:"free,omitempty"`
+}
+
+// Name is "Internal storage", "SD card ABCD-1234" or "USB drive ABCD-1234"
+func (v Volume) Name() string {
+	switch v.Kind {
+	case VolumeInternal:
+		return "Internal storage"
+	case VolumeUSB:
+		return "USB drive " + v.UUID
+	}
+	return "SD card " + v.UUID
+}
+
+// Contains reports whether a device path is on this volume. Internal storage
+// is also reached through /sdcard and /storage/self/primary.
+func (v Volume) Contains(p string) bool {
+	roots := []string{v.Path}
+	if v.Kind == VolumeInternal {
+		roots = append(roots, "/sdcard", "/storage/self/primary", "/mnt/sdcard")
+	}
+	for _, root := range roots {
+		if p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// VolumeFor returns the volume a device path is on
+func VolumeFor(volumes []Volume, p string) (Volume, bool) {
+	p = path.Clean(p)
+	for _, v := range volumes {
+		if v.Contains(p) {
+			return v, true
+		}
+	}
+	return Volume{}, false
+}
+
+var volumeUUID = regexp.MustCompile(`^(?:` + adb.UUIDPattern + `)$`)
+
+// Block device majors of removable volumes: 8 is SCSI, which USB mass storage shows up as
+const usbMajor = 8
+
+// ListVolumes finds the internal storage of the current user and the mounted
+// SD cards and USB drives, from sm list-volumes, /proc/mounts and /storage.
+// Only listing /storage has to work; sm needs Android 6 and tells SD from USB.
+func ListVolumes(client *adb.Client) ([]Volume, error) {
+	out, err := client.Shell("ls", "-1", "/storage")
+	if err != nil {
+		return nil, err
+	}
+	user := 0
+	if out, err := client.Shell("am", "get-current-user"); err == nil {
+		user, _ = strconv.Atoi(strings.TrimSpace(out))
+	}
+	kinds := make(map[string]VolumeKind)
+	if mounts, err := client.Shell("cat", "/proc/mounts"); err == nil {
+		kinds = parseMounts(mounts)
+	}
+	if sm, err := client.Shell("sm", "list-volumes", "all"); err == nil {
+		for uuid, kind := range parseSmVolumes(sm) {
+			kinds[uuid] = kind
+		}
+	}
+	volumes := listedVolumes(out, user, kinds)
+
+	args := []string{"df", "-k"}
+	for _, v := range volumes {
+		args = append(args, v.Path)
+	}
+	if out, err := client.Shell(args...); err == nil {
+		mounts := adb.ParseDf(out)
+		for i, v := range volumes {
+			d := longestMount(mounts, v.Path)
+			volumes[i].Total, volumes[i].Free = d.Total, d.Free
+		}
+	}
+	return volumes, nil
+}
+
+// listedVolumes builds the volumes from the names in /storage: internal
+// storage first, then removable volumes by UUID, kinds as far as known
+func listedVolumes(storage string, user int, kinds map[string]VolumeKind) []Volume {
+	volumes := []Volume{{Kind: VolumeInternal, Path: "/storage/emulated/" + strconv.Itoa(user)}}
+	var removable []Volume
+	for _, name := range strings.Split(storage, "\n") {
+		name = strings.TrimSpace(name)
+		if !volumeUUID.MatchString(name) {
+			continue
+		}
+		kind, ok := kinds[strings.ToUpper(name)]
+		if !ok {
+			kind = VolumeSD
+		}
+		removable = append(removable, Volume{Kind: kind, UUID: name, Path: "/storage/" + name})
+	}
+	sort.Slice(removable, func(i, j int) bool { return removable[i].UUID < removable[j].UUID })
+	return append(volumes, removable...)
+}
+
+// kindOfMajor tells SD cards from USB drives by the block device major
+func kindOfMajor(major string) VolumeKind {
+	if major == strconv.Itoa(usbMajor) {
+		return VolumeUSB
+	}
+	return VolumeSD
+}
+
+// parseSmVolumes reads "sm list-volumes all" lines such as
+//
+//	public:179,1 mounted ABCD-1234
+//	public:8,1 mounted 1234-5678
+func parseSmVolumes(out string) map[string]VolumeKind {
+	kinds := make(map[string]VolumeKind)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "public:") || fields[2] == "null" {
+			continue
+		}
+		major, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "public:"), ",")
+		kinds[strings.ToUpper(fields[2])] = kindOfMajor(major)
+	}
+	return kinds
+}
+
+// parseMounts reads the vold mounts of removable volumes from /proc/mounts:
+//
+//	/dev/block/vold/public:179,1 /mnt/media_rw/ABCD-1234 vfat rw,... 0 0
+func parseMounts(out string) map[string]VolumeKind {
+	kinds := make(map[string]VolumeKind)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/block/vold/public:") {
+			continue
+		}
+		uuid := path.Base(fields[1])
+		if !volumeUUID.MatchString(uuid) {
+			continue
+		}
+		major, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/dev/block/vold/public:"), ",")
+		kinds[strings.ToUpper(uuid)] = kindOfMajor(major)
+	}
+	return kinds
+}
+
+// longestMount returns the mount of df that p is under
+func longestMount(mounts []adb.Disk, p string) adb.Disk {
+	var best adb.Disk
+	for _, d := range mounts {
+		if (p == d.Mount || strings.HasPrefix(p, strings.TrimSuffix(d.Mount, "/")+"/")) && len(d.Mount) > len(best.Mount) {
+			best = d
+		}
+	}
+	return best
+}
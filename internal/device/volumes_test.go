@@ -0,0 +1,58 @@
+package device
+
+import (
+	"testing"
+
+	"AndroidSafeLocal/internal/adb"
+)
+
+func TestListedVolumes(t *testing.T) {
+	sm := "emulated;0 mounted null\nprivate mounted null\npublic:179,1 mounted ABCD-1234\npublic:8,1 unmounted null\n"
+	mounts := "/dev/block/dm-5 /data f2fs rw 0 0\n" +
+		"/dev/block/vold/public:8,1 /mnt/media_rw/1234-5678 vfat rw,dirsync 0 0\n" +
+		"/mnt/media_rw/1234-5678 /storage/1234-5678 sdcardfs rw 0 0\n"
+	kinds := parseMounts(mounts)
+	for uuid, kind := range parseSmVolumes(sm) {
+		kinds[uuid] = kind
+	}
+	volumes := listedVolumes("emulated\nself\n1234-5678\nabcd-1234\n", 10, kinds)
+	want := []Volume{
+		{Kind: VolumeInternal, Path: "/storage/emulated/10"},
+		{Kind: VolumeUSB, UUID: "1234-5678", Path: "/storage/1234-5678"},
+		{Kind: VolumeSD, UUID: "abcd-1234", Path: "/storage/abcd-1234"},
+	}
+	if len(volumes) != len(want) {
+		t.Fatalf("volumes = %+v, want %+v", volumes, want)
+	}
+	for i := range want {
+		if volumes[i] != want[i] {
+			t.Errorf("volumes[%d] = %+v, want %+v", i, volumes[i], want[i])
+		}
+	}
+
+	disks := adb.ParseDf("Filesystem 1K-blocks Used Available Use% Mounted on\n" +
+		"/data/media 113037396 5049832 107856492 5% /storage/emulated\n" +
+		"/mnt/media_rw/1234-5678 30000000 10000000 20000000 34% /storage/1234-5678\n")
+	if d := longestMount(disks, "/storage/emulated/10"); d.Free != 107856492*1024 {
+		t.Errorf("free of internal storage = %d", d.Free)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/sdcard/DCIM/Camera/a.jpg", "Internal storage"},
+		{"/storage/emulated/10/DCIM", "Internal storage"},
+		{"/storage/abcd-1234/DCIM", "SD card abcd-1234"},
+		{"/storage/1234-5678", "USB drive 1234-5678"},
+	}
+	for _, tt := range tests {
+		v, ok := VolumeFor(volumes, tt.path)
+		if !ok || v.Name() != tt.want {
+			t.Errorf("VolumeFor(%q) = %q, %v, want %q", tt.path, v.Name(), ok, tt.want)
+		}
+	}
+	if _, ok := VolumeFor(volumes, "/data/data/org.example"); ok {
+		t.Error("VolumeFor found a volume for app data")
+	}
+}
@@ -19,7 +19,8 @@ type File struct {
 
 // Walker handles file system traversal
 type Walker struct {
-	client *adb.Client
+	client   *adb.Client
+	warnings []Warning
 }
 
 // NewWalker creates a new Walker
@@ -29,6 +30,7 @@ func NewWalker(client *adb.Client) *Walker {
 
 // Walk recursively lists files starting from rootPath using 'ls -R -l'
 // This is more robust than 'find' on some minimalist Android shells for metadata.
+// What it had to skip is in Warnings afterwards.
 func (w *Walker) Walk(rootPath string) ([]File, error) {
 	// Execute ls -R -l.
 	// -R: recursive
@@ -36,25 +38,80 @@ func (w *Walker) Walk(rootPath string) ([]File, error) {
 	// -n: numeric uid/gid (easier to parse, keeps column count consistent?) - standard Android ls often doesn't show user/group names anyway or shows 'root' 'sdcard_rw'.
 	// Let's stick to 'ls -R -l'
 
-	cmdOut, err := w.client.RunCommand("shell", "ls", "-R", "-l", rootPath)
+	// Listed with the client's access mode, so su or run-as can reach app folders
+	cmdOut, err := w.client.AccessShell("ls", "-R", "-l", rootPath)
+	w.warnings = nil
 	if err != nil {
 		if cmdOut == "" {
 			return nil, fmt.Errorf("failed to list files: %w", err)
 		}
-		// If we have output, it might be partial success (e.g. Permission Denied on some subdirs)
-		// We'll proceed but maybe we should log it?
-		// For now, we return valid files we found.
-		// fmt.Printf("Warning: ls encountered errors but produced output: %v\n", err)
+		// Partial success: ls lists what it can and names the rest on stderr
+		w.warnings = stderrWarnings(err.Error())
 	}
 
-	return parseLsR(cmdOut, rootPath)
+	files, warnings, links := parseListing(cmdOut, rootPath)
+	w.warnings = append(w.warnings, warnings...)
+	broken, err := w.brokenLinks(links)
+	if err != nil {
+		// The listing itself is fine, only the links go unchecked
+		w.warnings = append(w.warnings, Warning{Kind: WarnListError, Path: rootPath, Line: "symlink check failed: " + err.Error()})
+	}
+	for _, link := range broken {
+		w.warnings = append(w.warnings, Warning{Kind: WarnBrokenSymlink, Path: link})
+	}
+	return files, nil
+}
+
+// Warnings returns what the last Walk skipped
+func (w *Walker) Warnings() []Warning {
+	return w.warnings
+}
+
+// Inaccessible returns the paths the last Walk could not read with the
+// client's access mode, e.g. Android/data without root
+func (w *Walker) Inaccessible() []string {
+	var paths []string
+	for _, warning := range w.warnings {
+		if warning.Kind == WarnPermissionDenied {
+			paths = append(paths, warning.Path)
+		}
+	}
+	return paths
+}
+
+// linkBatch is how many links go into one existence check
+const linkBatch = 50
+
+// brokenLinks returns the links whose target doesn't exist
+func (w *Walker) brokenLinks(links []string) ([]string, error) {
+	var broken []string
+	for start := 0; start < len(links); start += linkBatch {
+		batch := links[start:min(start+linkBatch, len(links))]
+		// test -e follows the link; echo names the ones that lead nowhere
+		args := append([]string{"sh", "-c", `for f in "$@"; do [ -e "$f" ] || echo "$f"; done`, "sh"}, batch...)
+		out, err := w.client.AccessShell(args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				broken = append(broken, line)
+			}
+		}
+	}
+	return broken, nil
 }
 
-func parseLsR(output string, rootPath string) ([]File, error) {
+// parseListing parses 'ls -R -l' output. Lines it can't read come back as
+// warnings and symbolic links, which are not backed up, as paths for the
+// broken link check.
+func parseListing(output string, rootPath string) (files []File, warnings []Warning, links []string) {
 	scanner := bufio.NewScanner(strings.NewReader(output))
 
-	var files []File
 	var currentDir string = rootPath
+	unparsed := func(line string) {
+		warnings = append(warnings, Warning{Kind: WarnUnparsed, Path: currentDir, Line: line})
+	}
 
 	// The first block in ls -R is usually the root dir contents, but sometimes it starts with "path:"
 	// Android toybox ls -R output format:
@@ -96,10 +153,17 @@ func parseLsR(output string, rootPath string) ([]File, error) {
 		// Perms always start with - or d or l
 		if len(parts) < 6 {
 			// Malformed or unknown line
+			unparsed(line)
 			continue
 		}
 
-		if !strings.HasPrefix(parts[0], "-") && !strings.HasPrefix(parts[0], "d") && !strings.HasPrefix(parts[0], "l") {
+		switch parts[0][0] {
+		case '-', 'd', 'l':
+		case 'c', 'b', 'p', 's':
+			// Device nodes, pipes and sockets have no content to back up
+			continue
+		default:
+			unparsed(line)
 			continue
 		}
 
@@ -129,9 +193,9 @@ func parseLsR(output string, rootPath string) ([]File, error) {
 			}
 		}
 
-		if dateIdx == -1 {
-			// Fallback: maybe format is different (e.g. older Android).
-			// Let's just assume last parts are name.
+		if dateIdx <= 0 {
+			// Maybe format is different (e.g. older Android)
+			unparsed(line)
 			continue
 		}
 
@@ -141,6 +205,7 @@ func parseLsR(output string, rootPath string) ([]File, error) {
 		// name starts at dateIdx + 2
 
 		if dateIdx+2 >= len(parts) {
+			unparsed(line)
 			continue
 		}
 
@@ -156,6 +221,13 @@ func parseLsR(output string, rootPath string) ([]File, error) {
 			continue
 		}
 
+		if strings.HasPrefix(parts[0], "l") {
+			// "name -> target": the target is backed up where it lives
+			name, _, _ = strings.Cut(name, " -> ")
+			links = append(links, path.Join(currentDir, name))
+			continue
+		}
+
 		// Full path
 		fullPath := path.Join(currentDir, name)
 
@@ -167,5 +239,5 @@ func parseLsR(output string, rootPath string) ([]File, error) {
 		})
 	}
 
-	return files, nil
+	return files, warnings, links
 }
@@ -4,7 +4,7 @@ import (
 	"testing"
 )
 
-func TestParseLsR(t *testing.T) {
+func TestParseListing(t *testing.T) {
 	// Sample output from 'adb shell ls -R -l /sdcard/Photos'
 	// Note: Android toybox output
 	output := `/sdcard/Photos:
@@ -20,9 +20,9 @@ total 8
 -rw-rw---- 1 root sdcard_rw 9999 2024-06-01 09:05 sunset with spaces.jpg
 `
 
-	files, err := parseLsR(output, "/sdcard/Photos") // root path arg usually matches first block
-	if err != nil {
-		t.Fatalf("parseLsR failed: %v", err)
+	files, warnings, links := parseListing(output, "/sdcard/Photos") // root path arg usually matches first block
+	if len(warnings) != 0 || len(links) != 0 {
+		t.Errorf("Clean listing gave warnings %+v and links %q", warnings, links)
 	}
 
 	expected := []File{
@@ -54,3 +54,56 @@ total 8
 		}
 	}
 }
+
+func TestParseListingWarnings(t *testing.T) {
+	output := `/sdcard/Photos:
+total 12
+-rw-rw---- 1 root sdcard_rw 1234 2024-05-20 15:30 image1.jpg
+lrwxrwxrwx 1 root sdcard_rw   21 2024-05-20 15:31 latest -> /sdcard/Photos/image1.jpg
+srw-rw---- 1 root sdcard_rw    0 2024-05-20 15:32 socket
+-rw-rw---- 1 root sdcard_rw 99 May 20 15:33 old-format.jpg
+garbage
+`
+	files, warnings, links := parseListing(output, "/sdcard/Photos")
+	if len(files) != 1 || files[0].Path != "/sdcard/Photos/image1.jpg" {
+		t.Errorf("files = %+v", files)
+	}
+	if len(links) != 1 || links[0] != "/sdcard/Photos/latest" {
+		t.Errorf("links = %q", links)
+	}
+	want := []Warning{
+		{Kind: WarnUnparsed, Path: "/sdcard/Photos", Line: "-rw-rw---- 1 root sdcard_rw 99 May 20 15:33 old-format.jpg"},
+		{Kind: WarnUnparsed, Path: "/sdcard/Photos", Line: "garbage"},
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("warnings = %+v, want %+v", warnings, want)
+	}
+	for i := range want {
+		if warnings[i] != want[i] {
+			t.Errorf("warnings[%d] = %+v, want %+v", i, warnings[i], want[i])
+		}
+	}
+}
+
+func TestStderrWarnings(t *testing.T) {
+	stderr := "adb command failed: exit status 1. Stderr: ls: /sdcard/Android/data: Permission denied\n" +
+		"ls: /sdcard/Android/obb/com.example: Permission denied\n" +
+		"ls: /sdcard/DCIM/gone.jpg: No such file or directory\n"
+	got := stderrWarnings(stderr)
+	want := []Warning{
+		{Kind: WarnPermissionDenied, Path: "/sdcard/Android/data"},
+		{Kind: WarnPermissionDenied, Path: "/sdcard/Android/obb/com.example"},
+		{Kind: WarnListError, Path: "/sdcard/DCIM/gone.jpg", Line: "No such file or directory"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("stderrWarnings = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stderrWarnings[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if s := WarningSummary(got); s != "2 permission denied, 1 list error" {
+		t.Errorf("WarningSummary = %q", s)
+	}
+}
@@ -0,0 +1,98 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WarningKind is what went wrong with part of a scan
+type WarningKind int
+
+const (
+	WarnPermissionDenied WarningKind = iota // ls could not open a folder
+	WarnUnparsed                            // A listing line in an unknown format
+	WarnBrokenSymlink                       // A link whose target is gone
+	WarnListError                           // Any other ls error, e.g. a file deleted during the scan
+)
+
+// WarningKinds lists the kinds in the order summaries show them
+var WarningKinds = []WarningKind{WarnPermissionDenied, WarnBrokenSymlink, WarnUnparsed, WarnListError}
+
+func (k WarningKind) String() string {
+	switch k {
+	case WarnPermissionDenied:
+		return "permission denied"
+	case WarnUnparsed:
+		return "unparsed line"
+	case WarnBrokenSymlink:
+		return "broken symlink"
+	}
+	return "list error"
+}
+
+// MarshalText writes the kind by name in exported warnings
+func (k WarningKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Warning is a part of the tree a scan skipped
+type Warning struct {
+	Kind WarningKind `json:"kind"`
+	Path string      `json:"path"`           // The folder, link or, for unparsed lines, the folder being listed
+	Line string      `json:"line,omitempty"` // Raw ls output or error text
+}
+
+func (w Warning) String() string {
+	if w.Kind == WarnUnparsed || w.Kind == WarnListError {
+		return fmt.Sprintf("%s: %s: %s", w.Kind, w.Path, w.Line)
+	}
+	return fmt.Sprintf("%s: %s", w.Kind, w.Path)
+}
+
+// CountWarnings tallies warnings by kind
+func CountWarnings(warnings []Warning) map[WarningKind]int {
+	counts := make(map[WarningKind]int)
+	for _, w := range warnings {
+		counts[w.Kind]++
+	}
+	return counts
+}
+
+// WarningSummary is a one line count by kind, e.g. "3 permission denied, 1 broken symlink"
+func WarningSummary(warnings []Warning) string {
+	counts := CountWarnings(warnings)
+	var parts []string
+	for _, k := range WarningKinds {
+		if counts[k] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[k], k))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// stderrWarnings turns the "ls: <path>: <reason>" lines of a failed listing
+// into warnings. The adb error wraps them after "Stderr: ".
+func stderrWarnings(stderr string) []Warning {
+	var warnings []Warning
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, "Stderr: "); i >= 0 {
+			line = line[i+len("Stderr: "):]
+		}
+		rest, ok := strings.CutPrefix(line, "ls: ")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, ": ")
+		if i < 0 {
+			continue
+		}
+		p, reason := strings.Trim(rest[:i], "'"), rest[i+2:]
+		if strings.EqualFold(reason, "Permission denied") {
+			warnings = append(warnings, Warning{Kind: WarnPermissionDenied, Path: p})
+		} else {
+			warnings = append(warnings, Warning{Kind: WarnListError, Path: p, Line: reason})
+		}
+	}
+	return warnings
+}
@@ -1,12 +1,15 @@
 package gallery
 
 import (
+	"AndroidSafeLocal/internal/storage"
+	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"image"
-	"image/jpeg"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -30,28 +33,27 @@ func NewGenerator() *Generator {
 
 // Generate scans rootPath and creates an index.html with thumbnails
 func (g *Generator) Generate(rootPath string, progressCallback func(current, total int)) (int, error) {
+	return g.GenerateOn(storage.NewLocal(rootPath), progressCallback)
+}
+
+// GenerateOn creates an index.html with thumbnails in a backup storage.
+// Snapshots and the object store link to the same photos again and aren't listed.
+func (g *Generator) GenerateOn(st storage.Storage, progressCallback func(current, total int)) (int, error) {
 	// 1. Scan for media files
+	infos, err := st.List("")
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan directory: %w", err)
+	}
 	var media []string
-	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			// skip thumbnails folder itself if it exists
-			if info.Name() == "thumbnails" {
-				return filepath.SkipDir
-			}
-			return nil
+	for _, info := range infos {
+		// skip thumbnails folder itself if it exists
+		if slices.Contains(strings.Split(path.Dir(info.Name), "/"), "thumbnails") {
+			continue
 		}
-
-		ext := strings.ToLower(filepath.Ext(path))
+		ext := strings.ToLower(path.Ext(info.Name))
 		if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".mp4" {
-			media = append(media, path)
+			media = append(media, info.Name)
 		}
-		return nil
-	})
-	if err != nil {
-		return 0, fmt.Errorf("failed to scan directory: %w", err)
 	}
 
 	total := len(media)
@@ -59,13 +61,7 @@ func (g *Generator) Generate(rootPath string, progressCallback func(current, tot
 		return 0, nil
 	}
 
-	// 2. Create thumbnails directory
-	thumbDir := filepath.Join(rootPath, "thumbnails")
-	if err := os.MkdirAll(thumbDir, 0755); err != nil {
-		return 0, fmt.Errorf("failed to create thumbnails dir: %w", err)
-	}
-
-	// 3. Process Images (Concurrent)
+	// 2. Process Images (Concurrent)
 	items := make([]MediaItem, total)
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, 8) // Limit concurrency (cpu bound)
@@ -73,55 +69,35 @@ func (g *Generator) Generate(rootPath string, progressCallback func(current, tot
 	processed := 0
 	var mu sync.Mutex
 
-	for i, pathStr := range media {
+	for i, relPath := range media {
 		wg.Add(1)
-		go func(idx int, srcPath string) {
+		go func(idx int, relPath string) {
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			relPath, _ := filepath.Rel(rootPath, srcPath)
-			name := filepath.Base(srcPath)
-			isVideo := strings.ToLower(filepath.Ext(srcPath)) == ".mp4"
+			name := path.Base(relPath)
+			isVideo := strings.ToLower(path.Ext(relPath)) == ".mp4"
 
-			// Hash name for thumb to avoid path issues? Or keep structure?
-			// Simple flat thumbnails folder with hashed names or just unique logical names needed.
-			// Let's use relPath but replace separators to flatten it.
-			flatName := strings.ReplaceAll(relPath, string(os.PathSeparator), "_")
+			// Flat thumbnails folder, named after the relative path with
+			// separators replaced
+			flatName := strings.ReplaceAll(relPath, "/", "_")
 			flatName = strings.ReplaceAll(flatName, ":", "")
 			if isVideo {
 				flatName += ".jpg" // Thumb for video
 			}
-			thumbName := "thumb_" + flatName
-			thumbPath := filepath.Join(thumbDir, thumbName)
+			thumbName := "thumbnails/thumb_" + flatName
 
 			item := MediaItem{
 				OriginalRelPath: relPath,
-				ThumbRelPath:    "thumbnails/" + thumbName,
+				ThumbRelPath:    thumbName,
 				Name:            name,
 				IsVideo:         isVideo,
 			}
 
 			// Generate Thumbnail if doesn't exist
-			if _, err := os.Stat(thumbPath); os.IsNotExist(err) {
-				if isVideo {
-					// Video thumbnailing is hard without ffmpeg.
-					// Placeholder for video?
-					// Or just skip thumb generation and use a generic icon in HTML?
-					// Let's create a generic placeholder image for now.
-					createPlaceholder(thumbPath, "VIDEO")
-				} else {
-					// Image resize
-					img, err := imaging.Open(srcPath)
-					if err == nil {
-						// Resize to 300x300 fill
-						thumb := imaging.Fill(img, 300, 300, imaging.Center, imaging.Lanczos)
-						imaging.Save(thumb, thumbPath)
-					} else {
-						// Failed to open image
-						createPlaceholder(thumbPath, "ERR")
-					}
-				}
+			if _, err := st.Stat(thumbName); errors.Is(err, fs.ErrNotExist) {
+				putThumbnail(st, relPath, thumbName, isVideo)
 			}
 
 			mu.Lock()
@@ -132,28 +108,46 @@ func (g *Generator) Generate(rootPath string, progressCallback func(current, tot
 			}
 			mu.Unlock()
 
-		}(i, pathStr)
+		}(i, relPath)
 	}
 
 	wg.Wait()
 
-	// 4. Generate HTML
-	if err := generateHTML(rootPath, items); err != nil {
+	// 3. Generate HTML
+	if err := generateHTML(st, items); err != nil {
 		return processed, err
 	}
 
 	return processed, nil
 }
 
-func createPlaceholder(path string, label string) {
-	// Create a simple gray image
-	rect := image.Rect(0, 0, 300, 300)
-	img := image.NewRGBA(rect)
-	// (Writing text to image in pure go is verbose, let's just make it gray)
-	// Just save it.
-	f, _ := os.Create(path)
-	defer f.Close()
-	jpeg.Encode(f, img, nil)
+// putThumbnail stores a 300x300 thumbnail of the photo at relPath, or a
+// placeholder for videos (no decoder without ffmpeg) and unreadable images
+func putThumbnail(st storage.Storage, relPath, thumbName string, isVideo bool) {
+	var thumb image.Image = image.NewRGBA(image.Rect(0, 0, 300, 300))
+	if !isVideo {
+		if img, err := openImage(st, relPath); err == nil {
+			thumb = imaging.Fill(img, 300, 300, imaging.Center, imaging.Lanczos)
+		}
+	}
+	format, err := imaging.FormatFromFilename(thumbName)
+	if err != nil {
+		format = imaging.JPEG
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, thumb, format); err != nil {
+		return
+	}
+	st.Put(thumbName, &buf, int64(buf.Len()))
+}
+
+func openImage(st storage.Storage, relPath string) (image.Image, error) {
+	rc, err := st.Get(relPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return imaging.Decode(rc)
 }
 
 const htmlTemplate = `
@@ -189,7 +183,7 @@ const htmlTemplate = `
 </html>
 `
 
-func generateHTML(rootPath string, items []MediaItem) error {
+func generateHTML(st storage.Storage, items []MediaItem) error {
 	tmpl, err := template.New("gallery").Parse(htmlTemplate)
 	if err != nil {
 		return err
@@ -205,11 +199,9 @@ func generateHTML(rootPath string, items []MediaItem) error {
 		Date:  time.Now().Format("2006-01-02 15:04"),
 	}
 
-	f, err := os.Create(filepath.Join(rootPath, "index.html"))
-	if err != nil {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		return err
 	}
-	defer f.Close()
-
-	return tmpl.Execute(f, data)
+	return st.Put("index.html", &buf, int64(buf.Len()))
 }
@@ -1,7 +1,14 @@
 package manifest
 
 import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/device"
+	"AndroidSafeLocal/internal/storage"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
@@ -13,12 +20,50 @@ type Entry struct {
 	LocalPath    string `json:"local_path"`    // Relative path in backup folder
 	Size         int64  `json:"size"`
 	Timestamp    string `json:"timestamp"`
+	Hash         string `json:"hash,omitempty"` // SHA-256 of the content, set in repository mode
+}
+
+// DataFile records a phone data export in the backup root, such as the
+// contacts. It is not a device file, so restore leaves it alone.
+type DataFile struct {
+	Kind      string   `json:"kind"`       // contacts, messages or calls
+	Sources   []string `json:"sources"`    // Content provider URIs queried
+	LocalPath string   `json:"local_path"` // Relative path in backup folder
+	Records   int      `json:"records"`
+	Size      int64    `json:"size"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// Deletion records a device file that free up removed after checking it
+// against its backup copy. The entry stays, so the file can be restored.
+type Deletion struct {
+	OriginalPath string `json:"original_path"`
+	LocalPath    string `json:"local_path"`
+	Size         int64  `json:"size"`
+	Hash         string `json:"hash"`    // Content hash both copies had: SHA-256, or the content ID in an encrypted repository
+	Deleted      string `json:"deleted"` // "2006-01-02 15:04"
+}
+
+// Session records one backup run and the device it ran against
+type Session struct {
+	Started  string          `json:"started"` // "2006-01-02 15:04"
+	Source   string          `json:"source"`  // Device folder that was backed up
+	Files    int             `json:"files"`   // Files copied
+	Failures int             `json:"failures"`
+	Device   *adb.DeviceInfo `json:"device,omitempty"`
 }
 
 // Manifest holds all backup entries
 type Manifest struct {
-	Entries []Entry `json:"entries"`
-	mu      sync.Mutex
+	Entries  []Entry    `json:"entries"`
+	Data     []DataFile `json:"data,omitempty"`
+	Sessions []Session  `json:"sessions,omitempty"`
+	// Volumes the entries were backed up from, so restores can tell an SD
+	// card from a USB drive when the target device has other UUIDs
+	Volumes []device.Volume `json:"volumes,omitempty"`
+	// Deletions logs the files free up removed from the device
+	Deletions []Deletion `json:"deletions,omitempty"`
+	mu        sync.Mutex
 }
 
 // New creates a new empty manifest
@@ -30,9 +75,7 @@ func New() *Manifest {
 
 // Add appends an entry to the manifest (thread-safe)
 func (m *Manifest) Add(original, local string, size int64, timestamp string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.Entries = append(m.Entries, Entry{
+	m.AddEntry(Entry{
 		OriginalPath: original,
 		LocalPath:    local,
 		Size:         size,
@@ -40,23 +83,132 @@ func (m *Manifest) Add(original, local string, size int64, timestamp string) {
 	})
 }
 
-// Save writes the manifest to a JSON file
+// AddEntry appends a complete entry to the manifest (thread-safe)
+func (m *Manifest) AddEntry(e Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries = append(m.Entries, e)
+}
+
+// SetData records a data export, replacing the previous one of its kind (thread-safe)
+func (m *Manifest) SetData(d DataFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Data {
+		if m.Data[i].Kind == d.Kind {
+			m.Data[i] = d
+			return
+		}
+	}
+	m.Data = append(m.Data, d)
+}
+
+// AddSession records a backup run (thread-safe)
+func (m *Manifest) AddSession(s Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sessions = append(m.Sessions, s)
+}
+
+// UpdateSession replaces the recorded run with the same start and source, as
+// after its failed files were retried, or adds it (thread-safe)
+func (m *Manifest) UpdateSession(s Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.Sessions) - 1; i >= 0; i-- {
+		if m.Sessions[i].Started == s.Started && m.Sessions[i].Source == s.Source {
+			m.Sessions[i] = s
+			return
+		}
+	}
+	m.Sessions = append(m.Sessions, s)
+}
+
+// RecordVolume adds a source volume, replacing the record with the same path
+// and its now stale free space (thread-safe)
+func (m *Manifest) RecordVolume(v device.Volume) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Volumes {
+		if m.Volumes[i].Path == v.Path {
+			m.Volumes[i] = v
+			return
+		}
+	}
+	m.Volumes = append(m.Volumes, v)
+}
+
+// AddDeletion logs a file removed from the device (thread-safe)
+func (m *Manifest) AddDeletion(d Deletion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Deletions = append(m.Deletions, d)
+}
+
+// Remove drops the entries stored at the given local paths (thread-safe)
+// and returns how many were removed
+func (m *Manifest) Remove(localPaths map[string]bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.Entries[:0]
+	for _, e := range m.Entries {
+		if !localPaths[e.LocalPath] {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(m.Entries) - len(kept)
+	m.Entries = kept
+	return removed
+}
+
+// Save writes the manifest to a plain JSON file. A folder with an encrypted
+// manifest is not written to: use SaveSealed with its sealer.
 func (m *Manifest) Save(backupRoot string) error {
+	return m.SaveSealed(backupRoot, nil)
+}
+
+// SaveSealed writes the manifest encrypted with s, or plain if s is nil
+func (m *Manifest) SaveSealed(backupRoot string, s Sealer) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	path := filepath.Join(backupRoot, "manifest.json")
+	path := filepath.Join(backupRoot, fileName)
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	if s == nil {
+		if Sealed(backupRoot) {
+			return ErrLocked
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+	if data, err = s.Seal(data); err != nil {
+		return err
+	}
+	return os.WriteFile(path+sealedSuffix, data, 0644)
 }
 
-// Load reads a manifest from a backup folder
+// Load reads a plain manifest from a backup folder
 func Load(backupRoot string) (*Manifest, error) {
-	path := filepath.Join(backupRoot, "manifest.json")
-	data, err := os.ReadFile(path)
+	return LoadSealed(backupRoot, nil)
+}
+
+// LoadSealed reads a manifest from a backup folder, decrypting it with s if
+// it is encrypted. An encrypted manifest and a nil s give ErrLocked.
+func LoadSealed(backupRoot string, s Sealer) (*Manifest, error) {
+	path := filepath.Join(backupRoot, fileName)
+	data, err := os.ReadFile(path + sealedSuffix)
+	if err == nil {
+		if s == nil {
+			return nil, ErrLocked
+		}
+		if data, err = s.Unseal(data); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -66,3 +218,85 @@ func Load(backupRoot string) (*Manifest, error) {
 	}
 	return &m, nil
 }
+
+// Sealed reports whether the manifest in dir is encrypted
+func Sealed(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, fileName+sealedSuffix))
+	return err == nil
+}
+
+// SaveTo writes the manifest to a storage backend, encrypted with s if it is
+// not nil. Encryption is for local repositories only, remote backends get
+// plain JSON.
+func (m *Manifest) SaveTo(st storage.Storage, s Sealer) error {
+	if local, ok := st.(*storage.Local); ok {
+		return m.SaveSealed(local.Root, s)
+	}
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return st.Put(fileName, bytes.NewReader(data), int64(len(data)))
+}
+
+// LoadFrom reads the manifest of a storage backend, decrypting a local one with s
+func LoadFrom(st storage.Storage, s Sealer) (*Manifest, error) {
+	if local, ok := st.(*storage.Local); ok {
+		return LoadSealed(local.Root, s)
+	}
+	rc, err := st.Get(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// OpenFrom is Open for a storage backend
+func OpenFrom(st storage.Storage, s Sealer) (*Manifest, error) {
+	m, err := LoadFrom(st, s)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), nil
+	}
+	return m, err
+}
+
+// fileName is the manifest's name in the backup root
+const fileName = "manifest.json"
+
+// sealedSuffix is appended to the manifest file name when it is encrypted
+const sealedSuffix = ".enc"
+
+// ErrLocked is returned for an encrypted manifest without a sealer
+var ErrLocked = errors.New("backup is encrypted, unlock it with its passphrase first")
+
+// Sealer encrypts manifests at rest
+type Sealer interface {
+	Seal(plain []byte) ([]byte, error)
+	Unseal(sealed []byte) ([]byte, error)
+}
+
+// Open loads the manifest of a backup folder, or returns an empty one if the
+// folder has none yet, so repeated runs extend the same manifest
+func Open(backupRoot string) (*Manifest, error) {
+	return OpenSealed(backupRoot, nil)
+}
+
+// OpenSealed is Open for a folder whose manifest may be encrypted with s
+func OpenSealed(backupRoot string, s Sealer) (*Manifest, error) {
+	m, err := LoadSealed(backupRoot, s)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), nil
+	}
+	return m, err
+}
@@ -0,0 +1,191 @@
+package manifest
+
+import (
+	"AndroidSafeLocal/internal/sorter"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MediaType groups file extensions for filtering
+type MediaType string
+
+const (
+	MediaAny      MediaType = ""
+	MediaImage    MediaType = "image"
+	MediaVideo    MediaType = "video"
+	MediaAudio    MediaType = "audio"
+	MediaDocument MediaType = "document"
+)
+
+// MediaTypes lists the selectable types, for UIs and flag help
+var MediaTypes = []MediaType{MediaImage, MediaVideo, MediaAudio, MediaDocument}
+
+var mediaExtensions = map[MediaType][]string{
+	MediaImage:    {".jpg", ".jpeg", ".png", ".gif", ".heic", ".heif", ".webp", ".dng", ".bmp"},
+	MediaVideo:    {".mp4", ".mov", ".3gp", ".mkv", ".webm", ".avi"},
+	MediaAudio:    {".mp3", ".m4a", ".aac", ".ogg", ".opus", ".wav", ".flac", ".amr"},
+	MediaDocument: {".pdf", ".txt", ".csv", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt"},
+}
+
+// MediaTypeOf returns the media type of a file name, MediaAny if it has none
+func MediaTypeOf(name string) MediaType {
+	ext := strings.ToLower(path.Ext(name))
+	for t, exts := range mediaExtensions {
+		for _, e := range exts {
+			if e == ext {
+				return t
+			}
+		}
+	}
+	return MediaAny
+}
+
+// Query selects manifest entries for a partial restore. Zero fields match everything.
+type Query struct {
+	PathPrefix string    // Original device path prefix, e.g. /sdcard/DCIM/Camera
+	From       time.Time // First capture day included
+	To         time.Time // Last capture day included
+	Extensions []string  // Lower-case with leading dot
+	MediaType  MediaType
+	Glob       string // path.Match pattern: against the full original path if it has a slash, else the file name
+	Deleted    bool   // Only files free up deleted from the device, applied by Manifest.Select
+}
+
+// ParseDate parses a YYYY-MM-DD or YYYY-MM query bound. An empty string is the zero time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date %q must be YYYY-MM-DD or YYYY-MM", s)
+}
+
+// ParseDateRange parses the from/to bounds of a query, letting "2024-03" as
+// upper bound mean the end of March
+func ParseDateRange(from, to string) (time.Time, time.Time, error) {
+	f, err := ParseDate(from)
+	if err != nil {
+		return f, time.Time{}, err
+	}
+	t, err := ParseDate(to)
+	if err != nil {
+		return f, t, err
+	}
+	if len(strings.TrimSpace(to)) == len("2006-01") {
+		t = t.AddDate(0, 1, -1)
+	}
+	return f, t, nil
+}
+
+// Match reports whether an entry satisfies every set criterion
+func (q Query) Match(e Entry) bool {
+	if q.PathPrefix != "" {
+		prefix := strings.TrimSuffix(q.PathPrefix, "/")
+		if e.OriginalPath != prefix && !strings.HasPrefix(e.OriginalPath, prefix+"/") {
+			return false
+		}
+	}
+
+	name := path.Base(e.OriginalPath)
+	if len(q.Extensions) > 0 {
+		ext := strings.ToLower(path.Ext(name))
+		found := false
+		for _, want := range q.Extensions {
+			if ext == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.MediaType != MediaAny && MediaTypeOf(name) != q.MediaType {
+		return false
+	}
+	if q.Glob != "" {
+		target := name
+		if strings.Contains(q.Glob, "/") {
+			target = e.OriginalPath
+		}
+		if ok, _ := path.Match(q.Glob, target); !ok {
+			return false
+		}
+	}
+
+	if !q.From.IsZero() || !q.To.IsZero() {
+		taken, ok := sorter.CaptureTime(name, e.Timestamp)
+		if !ok {
+			return false
+		}
+		day := time.Date(taken.Year(), taken.Month(), taken.Day(), 0, 0, 0, 0, time.UTC)
+		if !q.From.IsZero() && day.Before(q.From) {
+			return false
+		}
+		if !q.To.IsZero() && day.After(q.To) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the entries matching the query
+func (m *Manifest) Select(q Query) []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted map[string]bool
+	if q.Deleted {
+		deleted = make(map[string]bool, len(m.Deletions))
+		for _, d := range m.Deletions {
+			deleted[d.LocalPath] = true
+		}
+	}
+	var out []Entry
+	for _, e := range m.Entries {
+		if q.Match(e) && (!q.Deleted || deleted[e.LocalPath]) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Folders returns the folder hierarchy of the original paths: each folder maps
+// to its sorted subfolders, with "" as the parent of the top-level folders
+func (m *Manifest) Folders() map[string][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	children := make(map[string]map[string]bool)
+	for _, e := range m.Entries {
+		for dir := path.Dir(e.OriginalPath); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			parent := path.Dir(dir)
+			if parent == "/" || parent == "." {
+				parent = ""
+			}
+			if children[parent] == nil {
+				children[parent] = make(map[string]bool)
+			}
+			if children[parent][dir] {
+				break // The rest of the chain is known already
+			}
+			children[parent][dir] = true
+		}
+	}
+
+	out := make(map[string][]string, len(children))
+	for parent, set := range children {
+		for dir := range set {
+			out[parent] = append(out[parent], dir)
+		}
+		sort.Strings(out[parent])
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package manifest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testManifest() *Manifest {
+	m := New()
+	m.Add("/storage/emulated/0/DCIM/Camera/IMG_20240305_101010.jpg", "2024/03/IMG_20240305_101010.jpg", 100, "2024-03-05 10:10")
+	m.Add("/storage/emulated/0/DCIM/Camera/VID_20240320_090000.mp4", "2024/03/VID_20240320_090000.mp4", 900, "2024-03-20 09:00")
+	m.Add("/storage/emulated/0/DCIM/Camera/IMG_20240401_080000.jpg", "2024/04/IMG_20240401_080000.jpg", 120, "2024-04-01 08:00")
+	m.Add("/storage/emulated/0/Download/report.pdf", "2024/03/report.pdf", 50, "2024-03-10 12:00")
+	m.Add("/storage/emulated/0/DCIM/CameraRoll/IMG_20240310_000000.jpg", "2024/03/IMG_20240310_000000.jpg", 80, "2024-03-10 00:00")
+	m.AddDeletion(Deletion{OriginalPath: "/storage/emulated/0/DCIM/Camera/VID_20240320_090000.mp4", LocalPath: "2024/03/VID_20240320_090000.mp4", Size: 900})
+	return m
+}
+
+func TestSelect(t *testing.T) {
+	m := testManifest()
+	from, to, err := ParseDateRange("2024-03", "2024-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"Everything", Query{}, 5},
+		{"Camera Prefix Excludes CameraRoll", Query{PathPrefix: "/storage/emulated/0/DCIM/Camera/"}, 3},
+		{"Camera March 2024", Query{PathPrefix: "/storage/emulated/0/DCIM/Camera", From: from, To: to}, 2},
+		{"Videos", Query{MediaType: MediaVideo}, 1},
+		{"Extensions", Query{Extensions: []string{".jpg", ".pdf"}}, 4},
+		{"Glob Name", Query{Glob: "IMG_202403*"}, 2},
+		{"Glob Path", Query{Glob: "/storage/emulated/0/Download/*"}, 1},
+		{"Deleted From Device", Query{Deleted: true}, 1},
+		{"Deleted Images", Query{Deleted: true, MediaType: MediaImage}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Select(tt.query); len(got) != tt.want {
+				t.Errorf("Select() matched %d entries, want %d: %+v", len(got), tt.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseDate("March 2024"); err == nil {
+		t.Error("Expected an error for a malformed date")
+	}
+}
+
+func TestFolders(t *testing.T) {
+	folders := testManifest().Folders()
+	want := map[string][]string{
+		"":                         {"/storage"},
+		"/storage":                 {"/storage/emulated"},
+		"/storage/emulated":        {"/storage/emulated/0"},
+		"/storage/emulated/0":      {"/storage/emulated/0/DCIM", "/storage/emulated/0/Download"},
+		"/storage/emulated/0/DCIM": {"/storage/emulated/0/DCIM/Camera", "/storage/emulated/0/DCIM/CameraRoll"},
+	}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("Folders() = %v, want %v", folders, want)
+	}
+}
@@ -0,0 +1,685 @@
+package repo
+
+import (
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/crypt"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/snapshot"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirName is the object store inside a repository backup. Scans of the backup
+// folder (registry, gallery) skip it like every dot folder.
+const DirName = ".objects"
+
+// configFile marks a backup folder as a repository
+const configFile = "repository.json"
+
+// KeyFile holds the wrapped keys of an encrypted repository. Without it and
+// the passphrase nothing in the repository can be read: keep a copy elsewhere.
+const KeyFile = "key.json"
+
+// ErrNotRepository is returned by Open for a plain backup folder
+var ErrNotRepository = errors.New("not a repository backup")
+
+// Repo is a backup folder in repository mode: every file content is stored
+// once under .objects, keyed by its SHA-256, and the Year/Month tree and the
+// snapshots are hardlinks into that store.
+//
+// An encrypted repository has no tree: objects are encrypted and named by a
+// keyed hash, the manifests are encrypted, and files are only readable in
+// the decrypted views built by Materialize.
+type Repo struct {
+	Root string
+
+	encrypted bool
+	keys      *crypt.Keyring    // nil while an encrypted repository is locked
+	paths     map[string]string // Local path → hash of the manifest entries, see freePath
+}
+
+type config struct {
+	Version    int       `json:"version"`
+	Hash       string    `json:"hash"`
+	Encryption string    `json:"encryption,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+const (
+	plainHash     = "sha256"
+	encryptedHash = "hmac-sha256"
+	encryption    = "aes-256-gcm"
+)
+
+// Init turns root into a repository, or opens it if it already is one.
+// The volume must support hardlinks.
+func Init(root string) (*Repo, error) {
+	if r, err := Open(root); err == nil {
+		return r, nil
+	}
+	objects := filepath.Join(root, DirName)
+	if err := os.MkdirAll(objects, 0755); err != nil {
+		return nil, err
+	}
+	if err := checkHardlinks(objects); err != nil {
+		return nil, fmt.Errorf("repository mode needs a drive with hardlinks (NTFS, ext4, APFS): %w", err)
+	}
+	if err := writeConfig(root, config{Version: 1, Hash: plainHash}); err != nil {
+		return nil, err
+	}
+	return &Repo{Root: root}, nil
+}
+
+// InitEncrypted turns an empty folder into an encrypted repository protected by
+// passphrase, or unlocks it if it already is one. Existing backups can't be
+// encrypted in place, their files would stay readable in the tree and snapshots.
+func InitEncrypted(root, passphrase string) (*Repo, error) {
+	if r, err := Open(root); err == nil {
+		if !r.encrypted {
+			return nil, errors.New("the backup folder is already a repository without encryption, use a new folder")
+		}
+		return r, r.Unlock(passphrase)
+	}
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		return nil, errors.New("encryption can only be turned on for a new, empty backup folder")
+	}
+	if err := os.MkdirAll(filepath.Join(root, DirName), 0755); err != nil {
+		return nil, err
+	}
+	kf, keys, err := crypt.NewKeyFile(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := kf.Save(filepath.Join(root, KeyFile)); err != nil {
+		return nil, err
+	}
+	if err := writeConfig(root, config{Version: 1, Hash: encryptedHash, Encryption: encryption}); err != nil {
+		return nil, err
+	}
+	r := &Repo{Root: root, encrypted: true, keys: keys}
+	// An encrypted manifest from the start, so nothing saves a plain one here
+	if err := manifest.New().SaveSealed(root, keys); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func writeConfig(root string, c config) error {
+	c.Created = time.Now()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, configFile), data, 0644)
+}
+
+func checkHardlinks(dir string) error {
+	probe := filepath.Join(dir, ".probe")
+	if err := os.WriteFile(probe, nil, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(probe)
+	defer os.Remove(probe + ".link")
+	return os.Link(probe, probe+".link")
+}
+
+// Open returns the repository at root, or ErrNotRepository for a plain backup
+func Open(root string) (*Repo, error) {
+	data, err := os.ReadFile(filepath.Join(root, configFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotRepository
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+	switch {
+	case c.Version == 1 && c.Hash == plainHash && c.Encryption == "":
+		return &Repo{Root: root}, nil
+	case c.Version == 1 && c.Hash == encryptedHash && c.Encryption == encryption:
+		return &Repo{Root: root, encrypted: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported repository version %d (%s %s)", c.Version, c.Hash, c.Encryption)
+}
+
+// Encrypted reports whether r is an encrypted repository. r may be nil.
+func (r *Repo) Encrypted() bool {
+	return r != nil && r.encrypted
+}
+
+// Locked reports whether r is encrypted and has not been unlocked yet
+func (r *Repo) Locked() bool {
+	return r.Encrypted() && r.keys == nil
+}
+
+// Unlock reads the keys of an encrypted repository with passphrase, so Sealer
+// can encrypt and decrypt the manifests of the backup and its snapshots.
+func (r *Repo) Unlock(passphrase string) error {
+	if !r.encrypted {
+		return nil
+	}
+	kf, err := crypt.LoadKeyFile(filepath.Join(r.Root, KeyFile))
+	if err != nil {
+		return err
+	}
+	keys, err := kf.Unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	r.keys = keys
+	return nil
+}
+
+// Lock forgets the keys of an encrypted repository
+func (r *Repo) Lock() {
+	r.keys = nil
+}
+
+// Sealer returns what encrypts the manifests of an unlocked encrypted
+// repository, nil for a plain one. r may be nil.
+func (r *Repo) Sealer() manifest.Sealer {
+	if !r.Encrypted() || r.keys == nil {
+		return nil
+	}
+	return r.keys
+}
+
+// ChangePassphrase re-wraps the keys of an encrypted repository with a new passphrase
+func (r *Repo) ChangePassphrase(old, passphrase string) error {
+	if !r.encrypted {
+		return errors.New("the repository is not encrypted")
+	}
+	path := filepath.Join(r.Root, KeyFile)
+	kf, err := crypt.LoadKeyFile(path)
+	if err != nil {
+		return err
+	}
+	if err := kf.ChangePassphrase(old, passphrase); err != nil {
+		return err
+	}
+	return kf.Save(path)
+}
+
+// RotateKey re-encrypts the objects and manifests of an encrypted repository
+// under a new data key, then removes the old keys from the key file. An
+// interrupted rotation is finished by running it again.
+func (r *Repo) RotateKey(passphrase string) (reencrypted int, err error) {
+	if !r.encrypted {
+		return 0, errors.New("the repository is not encrypted")
+	}
+	path := filepath.Join(r.Root, KeyFile)
+	kf, err := crypt.LoadKeyFile(path)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := kf.Rotate(passphrase)
+	if err != nil {
+		return 0, err
+	}
+	if err := kf.Save(path); err != nil {
+		return 0, err
+	}
+	r.keys = keys
+
+	err = filepath.WalkDir(filepath.Join(r.Root, DirName), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		done, err := r.reencrypt(path)
+		if done {
+			reencrypted++
+		}
+		return err
+	})
+	if err != nil {
+		return reencrypted, err
+	}
+	dirs, err := r.manifestDirs()
+	if err != nil {
+		return reencrypted, err
+	}
+	for _, dir := range dirs {
+		m, err := manifest.LoadSealed(dir, keys)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return reencrypted, err
+		}
+		if err := m.SaveSealed(dir, keys); err != nil {
+			return reencrypted, err
+		}
+	}
+	kf.Retire()
+	return reencrypted, kf.Save(path)
+}
+
+// reencrypt rewrites an object with the current key unless it already uses it
+func (r *Repo) reencrypt(path string) (bool, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	id, err := crypt.KeyID(in)
+	if err != nil || id == r.keys.Current() {
+		return false, err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.keys.Decrypt(pw, in))
+	}()
+	tmp := path + ".tmp"
+	if err := r.encryptTo(tmp, pr); err != nil {
+		pr.CloseWithError(err)
+		return false, err
+	}
+	in.Close()
+	return true, os.Rename(tmp, path)
+}
+
+// encryptTo writes src encrypted with the current key to path
+func (r *Repo) encryptTo(path string, src io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.keys.Encrypt(out, src); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	return out.Close()
+}
+
+// objectPath returns where the content with the given hash is stored
+func (r *Repo) objectPath(hash string) string {
+	return filepath.Join(r.Root, DirName, hash[:2], hash)
+}
+
+// Store moves the content of a freshly pulled file into the object store and
+// returns its hash. Content already in the store is not kept twice: the file
+// is replaced by a link to the existing object. In an encrypted repository the
+// file is encrypted into the store and deleted, even when that fails.
+func (r *Repo) Store(path string) (string, error) {
+	if r.encrypted {
+		return r.seal(path)
+	}
+	hash, err := backup.HashFile(path)
+	if err != nil {
+		return "", err
+	}
+	obj := r.objectPath(hash)
+	if _, err := os.Stat(obj); err == nil {
+		tmp := path + ".link"
+		if err := os.Link(obj, tmp); err != nil {
+			return "", err
+		}
+		return hash, os.Rename(tmp, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return "", err
+	}
+	return hash, os.Link(path, obj)
+}
+
+func (r *Repo) seal(path string) (string, error) {
+	defer removeEmptyParents(r.Root, filepath.Dir(path))
+	defer os.Remove(path) // No plaintext stays in the backup folder
+	if r.keys == nil {
+		return "", manifest.ErrLocked
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Join(r.Root, DirName), ".incoming-*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	id := r.keys.NewID()
+	if err := r.encryptTo(tmp.Name(), io.TeeReader(in, id)); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(id.Sum(nil))
+	obj := r.objectPath(hash)
+	if _, err := os.Stat(obj); err == nil {
+		return hash, os.Remove(tmp.Name())
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return hash, os.Rename(tmp.Name(), obj)
+}
+
+// removeEmptyParents deletes dir and its parents up to root while they are empty
+func removeEmptyParents(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return // Not empty
+		}
+	}
+}
+
+// Record adds a job pulled into the backup at root to its manifest, storing
+// the content first. r may be nil for a plain backup folder. The entry is
+// recorded even when storing fails, just without a hash, except in an
+// encrypted repository where the pulled file is gone: the next run pulls it again.
+func (r *Repo) Record(m *manifest.Manifest, root string, job backup.Job) error {
+	relPath, _ := filepath.Rel(root, job.DestPath)
+	entry := manifest.Entry{OriginalPath: job.SourcePath, LocalPath: relPath, Size: job.Size, Timestamp: job.Timestamp}
+	var err error
+	if r != nil {
+		entry.Hash, err = r.Store(job.DestPath)
+	}
+	if r.Encrypted() {
+		if err != nil {
+			return err
+		}
+		entry.LocalPath = r.freePath(m, relPath, entry.Hash)
+	}
+	m.AddEntry(entry)
+	return err
+}
+
+// freePath returns rel, or rel with _1, _2... before the extension when the
+// manifest has other content there. Encrypted repositories have no tree, so
+// the backup plan can't see which names earlier runs took.
+func (r *Repo) freePath(m *manifest.Manifest, rel, hash string) string {
+	if r.paths == nil {
+		r.paths = make(map[string]string, len(m.Entries))
+		for _, e := range m.Entries {
+			r.paths[e.LocalPath] = e.Hash
+		}
+	}
+	ext := filepath.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	candidate := rel
+	for i := 1; r.paths[candidate] != "" && r.paths[candidate] != hash; i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	r.paths[candidate] = hash
+	return candidate
+}
+
+// Import stores the backup files of entries that have no hash yet, for
+// example from runs made before the folder became a repository. Entries get
+// their Hash set; save the manifest afterwards.
+func (r *Repo) Import(m *manifest.Manifest) (int, error) {
+	imported := 0
+	// Entries sharing a backup copy share its object: an encrypted
+	// repository removes the plaintext once the first of them is stored
+	stored := make(map[string]string)
+	for i, e := range m.Entries {
+		if e.Hash != "" {
+			continue
+		}
+		hash, ok := stored[e.LocalPath]
+		if !ok {
+			var err error
+			hash, err = r.Store(filepath.Join(r.Root, e.LocalPath))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // Listed in the manifest but gone from the tree
+			}
+			if err != nil {
+				return imported, err
+			}
+			stored[e.LocalPath] = hash
+		}
+		m.Entries[i].Hash = hash
+		imported++
+	}
+	return imported, nil
+}
+
+// Materialize builds the Year/Month tree of entries under dest from the
+// object store, e.g. to browse a snapshot or rebuild a deleted tree. An
+// encrypted repository decrypts into dest instead of linking, so dest should
+// be a temporary view outside the backup folder.
+// Existing files are left as they are; entries without a hash are counted as missing.
+func (r *Repo) Materialize(entries []manifest.Entry, dest string) (linked, missing int, err error) {
+	if r.Locked() {
+		return 0, 0, manifest.ErrLocked
+	}
+	for _, e := range entries {
+		obj := ""
+		if e.Hash != "" {
+			obj = r.objectPath(e.Hash)
+		}
+		if _, err := os.Stat(obj); obj == "" || err != nil {
+			missing++
+			continue
+		}
+		target := filepath.Join(dest, e.LocalPath)
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return linked, missing, err
+		}
+		if r.encrypted {
+			err = r.decryptTo(obj, target)
+		} else {
+			err = os.Link(obj, target)
+		}
+		if err != nil {
+			return linked, missing, err
+		}
+		linked++
+	}
+	return linked, missing, nil
+}
+
+// decryptTo writes the plaintext of an object to path, leaving nothing behind on error
+func (r *Repo) decryptTo(obj, path string) error {
+	in, err := os.Open(obj)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := r.keys.Decrypt(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// OpenEntry returns the content of an entry: the tree file, or the stored
+// object if it is gone, decrypted on the fly in an encrypted repository
+func (r *Repo) OpenEntry(e manifest.Entry) (io.ReadCloser, error) {
+	if !r.encrypted {
+		f, err := os.Open(filepath.Join(r.Root, e.LocalPath))
+		if errors.Is(err, fs.ErrNotExist) && e.Hash != "" {
+			return os.Open(r.objectPath(e.Hash))
+		}
+		return f, err
+	}
+	if r.keys == nil {
+		return nil, manifest.ErrLocked
+	}
+	if e.Hash == "" {
+		return nil, fmt.Errorf("%s: %w", e.LocalPath, fs.ErrNotExist)
+	}
+	in, err := os.Open(r.objectPath(e.Hash))
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.keys.Decrypt(pw, in))
+		in.Close()
+	}()
+	return pr, nil
+}
+
+// deviceReader is the part of adb.Client free up checks device files with
+type deviceReader interface {
+	Hash(path string) (string, error)
+	Cat(w io.Writer, path string) error
+}
+
+// Copies checks free up candidates against the object store
+type Copies struct {
+	r      *Repo
+	device deviceReader
+}
+
+// Copies returns the free up checker of the repository for files on device
+func (r *Repo) Copies(device deviceReader) *Copies {
+	return &Copies{r: r, device: device}
+}
+
+// StoredHash reads the stored object of e back and returns its content hash,
+// which has to be the one it is stored under. Plain repositories hash the
+// object, encrypted ones decrypt it into a content ID. A missing or damaged
+// object is an error.
+func (c *Copies) StoredHash(e manifest.Entry) (string, error) {
+	if c.r.Locked() {
+		return "", manifest.ErrLocked
+	}
+	if e.Hash == "" {
+		return "", fmt.Errorf("%s is not in the object store", e.LocalPath)
+	}
+	in, err := os.Open(c.r.objectPath(e.Hash))
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	var hash string
+	if c.r.encrypted {
+		id := c.r.keys.NewID()
+		if err := c.r.keys.Decrypt(id, in); err != nil {
+			return "", err
+		}
+		hash = hex.EncodeToString(id.Sum(nil))
+	} else {
+		h := sha256.New()
+		if _, err := io.Copy(h, in); err != nil {
+			return "", err
+		}
+		hash = hex.EncodeToString(h.Sum(nil))
+	}
+	if hash != e.Hash {
+		return "", fmt.Errorf("object of %s is damaged", e.LocalPath)
+	}
+	return hash, nil
+}
+
+// DeviceHash hashes a device file like the store names objects: SHA-256 on
+// the device, or for an encrypted repository the keyed content ID of the
+// file streamed to the PC
+func (c *Copies) DeviceHash(path string) (string, error) {
+	if !c.r.encrypted {
+		return c.device.Hash(path)
+	}
+	if c.r.keys == nil {
+		return "", manifest.ErrLocked
+	}
+	id := c.r.keys.NewID()
+	if err := c.device.Cat(id, path); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id.Sum(nil)), nil
+}
+
+// manifestDirs returns the folders holding the manifests of the backup and its snapshots
+func (r *Repo) manifestDirs() ([]string, error) {
+	dirs := []string{r.Root}
+	infos, err := snapshot.List(r.Root)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range infos {
+		dirs = append(dirs, snapshot.Path(r.Root, s.Name))
+	}
+	return dirs, nil
+}
+
+// GC deletes objects no manifest refers to any more, neither the backup's
+// nor a snapshot's. Run it after pruning snapshots.
+func (r *Repo) GC() (removed int, freed int64, err error) {
+	if r.Locked() {
+		return 0, 0, manifest.ErrLocked
+	}
+	referenced := make(map[string]bool)
+	manifests, err := r.manifestDirs()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, dir := range manifests {
+		m, err := manifest.OpenSealed(dir, r.Sealer())
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, e := range m.Entries {
+			referenced[e.Hash] = true
+		}
+		// Files freed up from the device have their last copy here
+		for _, d := range m.Deletions {
+			referenced[d.Hash] = true
+		}
+	}
+
+	err = filepath.WalkDir(filepath.Join(r.Root, DirName), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || referenced[d.Name()] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+// Stats counts the objects in the store and their total size
+func (r *Repo) Stats() (objects int, size int64, err error) {
+	err = filepath.WalkDir(filepath.Join(r.Root, DirName), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects++
+		size += info.Size()
+		return nil
+	})
+	return objects, size, err
+}
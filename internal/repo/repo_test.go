@@ -0,0 +1,273 @@
+package repo
+
+import (
+	"AndroidSafeLocal/internal/backup"
+	"AndroidSafeLocal/internal/crypt"
+	"AndroidSafeLocal/internal/manifest"
+	"AndroidSafeLocal/internal/snapshot"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreDeduplicates(t *testing.T) {
+	root := t.TempDir()
+	if _, err := Open(root); !errors.Is(err, ErrNotRepository) {
+		t.Fatalf("Expected ErrNotRepository, got %v", err)
+	}
+	r, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(root); err != nil {
+		t.Fatalf("Open after Init failed: %v", err)
+	}
+
+	// The same photo from two devices, under two names
+	a := filepath.Join(root, "2024", "01", "IMG_a.jpg")
+	b := filepath.Join(root, "2024", "01", "IMG_b.jpg")
+	writeFile(t, a, "same bytes")
+	writeFile(t, b, "same bytes")
+	hashA, err := r.Store(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, err := r.Store(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashA != hashB {
+		t.Fatalf("Same content, different hashes %s / %s", hashA, hashB)
+	}
+	objects, size, err := r.Stats()
+	if err != nil || objects != 1 || size != int64(len("same bytes")) {
+		t.Errorf("Stats = %d objects, %d bytes, %v; want 1 object", objects, size, err)
+	}
+	infoA, _ := os.Stat(a)
+	infoB, _ := os.Stat(b)
+	if !os.SameFile(infoA, infoB) {
+		t.Error("Tree files should share the stored object")
+	}
+}
+
+func TestImportMaterializeGC(t *testing.T) {
+	root := t.TempDir()
+	m := manifest.New()
+	for name, content := range map[string]string{"kept.jpg": "kept", "dropped.jpg": "dropped"} {
+		rel := filepath.Join("2024", "01", name)
+		writeFile(t, filepath.Join(root, rel), content)
+		m.Add("/sdcard/DCIM/"+name, rel, int64(len(content)), "")
+	}
+
+	// A plain backup becoming a repository
+	r, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Import(m)
+	if err != nil || n != 2 {
+		t.Fatalf("Import = %d, %v; want 2", n, err)
+	}
+	for _, e := range m.Entries {
+		if len(e.Hash) != 64 {
+			t.Errorf("%s has no hash after import", e.LocalPath)
+		}
+	}
+
+	// Browse the backup from the object store in another folder
+	view := t.TempDir()
+	linked, missing, err := r.Materialize(append(m.Entries, manifest.Entry{LocalPath: "legacy.jpg"}), view)
+	if err != nil || linked != 2 || missing != 1 {
+		t.Fatalf("Materialize = %d linked, %d missing, %v", linked, missing, err)
+	}
+	data, err := os.ReadFile(filepath.Join(view, "2024", "01", "kept.jpg"))
+	if err != nil || string(data) != "kept" {
+		t.Errorf("Materialized file = %q, %v", data, err)
+	}
+
+	// Only "kept.jpg" is still referenced, by a snapshot
+	var kept manifest.Entry
+	for _, e := range m.Entries {
+		if filepath.Base(e.LocalPath) == "kept.jpg" {
+			kept = e
+		}
+	}
+	if _, err := snapshot.Create(root, snapshot.Info{}, []manifest.Entry{kept}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.New().Save(root); err != nil {
+		t.Fatal(err)
+	}
+	removed, freed, err := r.GC()
+	if err != nil || removed != 1 || freed != int64(len("dropped")) {
+		t.Errorf("GC = %d removed, %d bytes, %v; want the dropped object", removed, freed, err)
+	}
+	if _, err := os.Stat(r.objectPath(kept.Hash)); err != nil {
+		t.Errorf("Object of the snapshot entry was collected: %v", err)
+	}
+}
+
+func TestEncryptedRepository(t *testing.T) {
+	root := t.TempDir()
+	r, err := InitEncrypted(root, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New()
+	record := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		writeFile(t, path, content)
+		job := backup.Job{SourcePath: "/sdcard/DCIM/" + filepath.Base(rel), DestPath: path, Size: int64(len(content))}
+		if err := r.Record(m, root, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := filepath.Join("2024", "01", "a.jpg")
+	record(a, "holiday photo")
+	record(filepath.Join("2024", "01", "b.jpg"), "holiday photo")
+	// Same name as a file of an earlier run, other content
+	record(a, "edited photo")
+
+	if _, err := os.Stat(filepath.Join(root, "2024")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Plaintext tree left in the repository: %v", err)
+	}
+	if objects, _, _ := r.Stats(); objects != 2 {
+		t.Errorf("Expected 2 objects, got %d", objects)
+	}
+	if got := m.Entries[2].LocalPath; got != filepath.Join("2024", "01", "a_1.jpg") {
+		t.Errorf("Second a.jpg recorded at %s", got)
+	}
+	filepath.WalkDir(filepath.Join(root, DirName), func(path string, d fs.DirEntry, err error) error {
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), "photo") {
+			t.Errorf("Object %s holds plaintext", path)
+		}
+		return nil
+	})
+
+	// Without the sealer nothing is written in plain
+	if err := m.Save(root); !errors.Is(err, manifest.ErrLocked) {
+		t.Errorf("Plain Save = %v, want ErrLocked", err)
+	}
+	if _, err := snapshot.Create(root, snapshot.Info{}, m.Entries, nil); !errors.Is(err, manifest.ErrLocked) {
+		t.Errorf("Snapshot without the sealer = %v, want ErrLocked", err)
+	}
+	if err := m.SaveSealed(root, r.Sealer()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snapshot.Create(root, snapshot.Info{}, m.Entries, r.Sealer()); err != nil {
+		t.Fatalf("Snapshot without a tree: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "manifest.json")); err == nil {
+		t.Error("Plaintext manifest written")
+	}
+
+	// Another session: locked until the passphrase is given
+	r.Lock()
+	r, err = Open(root)
+	if err != nil || !r.Locked() {
+		t.Fatalf("Open = %v, locked %v", err, r.Locked())
+	}
+	if _, err := manifest.Load(root); !errors.Is(err, manifest.ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	if err := r.Unlock("guess"); !errors.Is(err, crypt.ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := r.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := r.RotateKey("secret")
+	if err != nil || n != 2 {
+		t.Fatalf("RotateKey = %d, %v; want 2 objects re-encrypted", n, err)
+	}
+	_, snap, err := snapshot.Load(root, mustSnapshot(t, root), r.Sealer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := t.TempDir()
+	linked, missing, err := r.Materialize(snap.Entries, view)
+	if err != nil || linked != 3 || missing != 0 {
+		t.Fatalf("Materialize = %d, %d, %v", linked, missing, err)
+	}
+	for rel, want := range map[string]string{a: "holiday photo", filepath.Join("2024", "01", "a_1.jpg"): "edited photo"} {
+		if data, err := os.ReadFile(filepath.Join(view, rel)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v", rel, data, err)
+		}
+	}
+}
+
+// mustSnapshot returns the name of the only snapshot of root
+func mustSnapshot(t *testing.T, root string) string {
+	t.Helper()
+	infos, err := snapshot.List(root)
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("List = %+v, %v", infos, err)
+	}
+	return infos[0].Name
+}
+
+// fakeDevice serves device files from a map for the free up checks
+type fakeDevice map[string]string
+
+func (d fakeDevice) Hash(path string) (string, error) {
+	sum := sha256.Sum256([]byte(d[path]))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (d fakeDevice) Cat(w io.Writer, path string) error {
+	_, err := io.WriteString(w, d[path])
+	return err
+}
+
+func TestCopiesEncrypted(t *testing.T) {
+	root := t.TempDir()
+	r, err := InitEncrypted(root, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New()
+	path := filepath.Join(root, "a.jpg")
+	writeFile(t, path, "holiday photo")
+	if err := r.Record(m, root, backup.Job{SourcePath: "/sdcard/DCIM/a.jpg", DestPath: path, Size: 13}); err != nil {
+		t.Fatal(err)
+	}
+	e := m.Entries[0]
+	c := r.Copies(fakeDevice{"/sdcard/DCIM/a.jpg": "holiday photo", "/sdcard/DCIM/b.jpg": "other photo"})
+
+	stored, err := c.StoredHash(e)
+	if err != nil || stored != e.Hash {
+		t.Fatalf("StoredHash = %s, %v; want %s", stored, err, e.Hash)
+	}
+	if got, err := c.DeviceHash("/sdcard/DCIM/a.jpg"); err != nil || got != e.Hash {
+		t.Errorf("DeviceHash of the same content = %s, %v; want %s", got, err, e.Hash)
+	}
+	if got, _ := c.DeviceHash("/sdcard/DCIM/b.jpg"); got == e.Hash {
+		t.Error("Other content has the same content ID")
+	}
+
+	// A missing object is never taken as a match
+	if err := os.Remove(r.objectPath(e.Hash)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.StoredHash(e); err == nil {
+		t.Error("StoredHash of a missing object succeeded")
+	}
+}
@@ -0,0 +1,129 @@
+package snapshot
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PrunePlan is what applying a retention policy would delete
+type PrunePlan struct {
+	Decisions []Decision // Every snapshot, newest first
+	Files     []string   // Backup files referenced only by removed snapshots, relative to the backup root
+	Bytes     int64      // Space freed by deleting Files
+
+	sealer manifest.Sealer
+}
+
+// Removed returns the snapshots the policy drops
+func (pp *PrunePlan) Removed() []Info {
+	var removed []Info
+	for _, d := range pp.Decisions {
+		if !d.Keep {
+			removed = append(removed, d.Info)
+		}
+	}
+	return removed
+}
+
+// PlanPrune applies a policy to the snapshots of a backup without deleting anything.
+// A backup file is only released when a removed snapshot references it and no
+// kept snapshot does; files that never were in a snapshot are left alone, and
+// so are files free up deleted from the device, their copy is the only one.
+// sealer reads and writes the manifests of an encrypted backup.
+func PlanPrune(backupRoot string, policy Policy, now time.Time, sealer manifest.Sealer) (*PrunePlan, error) {
+	infos, err := List(backupRoot)
+	if err != nil {
+		return nil, err
+	}
+	pp := &PrunePlan{Decisions: policy.Apply(infos, now), sealer: sealer}
+
+	backup, err := manifest.OpenSealed(backupRoot, sealer)
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool)
+	for _, d := range backup.Deletions {
+		kept[d.LocalPath] = true
+	}
+	released := make(map[string]manifest.Entry)
+	for _, d := range pp.Decisions {
+		_, m, err := Load(backupRoot, d.Info.Name, sealer)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range m.Entries {
+			if d.Keep {
+				kept[e.LocalPath] = true
+			} else {
+				released[e.LocalPath] = e
+			}
+		}
+	}
+	for rel, e := range released {
+		if kept[rel] {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(backupRoot, rel))
+		switch {
+		case err == nil:
+			pp.Bytes += info.Size()
+		case e.Hash != "":
+			pp.Bytes += e.Size // Only in the object store, freed by the repository's GC
+		default:
+			continue // Already gone from the backup tree
+		}
+		pp.Files = append(pp.Files, rel)
+	}
+	sort.Strings(pp.Files)
+	return pp, nil
+}
+
+// Execute deletes the removed snapshots, then the released backup files and
+// their entries in the backup manifest
+func (pp *PrunePlan) Execute(backupRoot string) error {
+	for _, s := range pp.Removed() {
+		// Renamed first so an interrupted delete never looks like a valid snapshot
+		dir := Path(backupRoot, s.Name)
+		doomed := dir + partialSuffix
+		if err := os.Rename(dir, doomed); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(doomed); err != nil {
+			return err
+		}
+	}
+	if len(pp.Files) == 0 {
+		return nil
+	}
+
+	m, err := manifest.OpenSealed(backupRoot, pp.sealer)
+	if err != nil {
+		return err
+	}
+	released := make(map[string]bool, len(pp.Files))
+	for _, rel := range pp.Files {
+		released[rel] = true
+		p := filepath.Join(backupRoot, rel)
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removeEmptyParents(backupRoot, filepath.Dir(p))
+	}
+	m.Remove(released)
+	return m.SaveSealed(backupRoot, pp.sealer)
+}
+
+// removeEmptyParents deletes dir and its parents up to root while they are empty
+func removeEmptyParents(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return // Not empty
+		}
+	}
+}
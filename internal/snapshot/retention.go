@@ -0,0 +1,196 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says which snapshots to keep. A snapshot is kept when any rule
+// selects it; the zero Policy keeps everything.
+type Policy struct {
+	Last    int           // The N most recent snapshots
+	Daily   int           // The newest snapshot of each of the last N days that have one
+	Weekly  int           // Same per ISO week
+	Monthly int           // Same per month
+	Yearly  int           // Same per year
+	Within  time.Duration // Every snapshot younger than this
+}
+
+// ParsePolicy parses comma separated rules such as
+// "last=5,daily=7,weekly=4,monthly=12,yearly=3,within=30d".
+// Durations take Go syntax plus d (days), w (weeks) and y (years).
+func ParsePolicy(spec string) (Policy, error) {
+	var p Policy
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return p, fmt.Errorf("bad retention rule %q, use name=value", part)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "within" {
+			d, err := parseDuration(value)
+			if err != nil {
+				return p, err
+			}
+			p.Within = d
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("retention rule %s needs a count, got %q", key, value)
+		}
+		switch key {
+		case "last":
+			p.Last = n
+		case "daily":
+			p.Daily = n
+		case "weekly":
+			p.Weekly = n
+		case "monthly":
+			p.Monthly = n
+		case "yearly":
+			p.Yearly = n
+		default:
+			return p, fmt.Errorf("unknown retention rule %q (last, daily, weekly, monthly, yearly, within)", key)
+		}
+	}
+	return p, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1:]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad duration %q, e.g. 30d, 8w, 1y or 12h", s)
+	}
+	return d, nil
+}
+
+// IsZero reports whether the policy has no rules, which keeps every snapshot
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+func (p Policy) String() string {
+	var parts []string
+	for _, r := range []struct {
+		name string
+		n    int
+	}{{"last", p.Last}, {"daily", p.Daily}, {"weekly", p.Weekly}, {"monthly", p.Monthly}, {"yearly", p.Yearly}} {
+		if r.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", r.name, r.n))
+		}
+	}
+	if p.Within > 0 {
+		parts = append(parts, "within="+p.Within.String())
+	}
+	if len(parts) == 0 {
+		return "keep all"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Decision is the verdict of a policy on one snapshot
+type Decision struct {
+	Info    Info
+	Keep    bool
+	Reasons []string // Rules that keep it, empty when it is removed
+}
+
+// Apply decides every snapshot, newest first. The rules count the snapshots
+// of each source separately and the newest of each source is always kept.
+func (p Policy) Apply(snapshots []Info, now time.Time) []Decision {
+	decisions := make([]Decision, len(snapshots))
+	for i, s := range snapshots {
+		decisions[i] = Decision{Info: s}
+	}
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Info.Created.After(decisions[j].Info.Created) })
+
+	if p.IsZero() {
+		for i := range decisions {
+			decisions[i].Keep = true
+			decisions[i].Reasons = []string{"no retention rules"}
+		}
+		return decisions
+	}
+
+	// Each source folder is its own series: backing up DCIM and Download
+	// into one folder must not let the runs of one push out the other
+	series := make(map[string][]*Decision)
+	for i := range decisions {
+		source := decisions[i].Info.Source
+		series[source] = append(series[source], &decisions[i])
+	}
+	for _, decisions := range series {
+		p.applyBuckets(decisions)
+	}
+	if p.Within > 0 {
+		for i := range decisions {
+			if now.Sub(decisions[i].Info.Created) < p.Within {
+				decisions[i].Keep = true
+				decisions[i].Reasons = append(decisions[i].Reasons, "within "+p.Within.String())
+			}
+		}
+	}
+	return decisions
+}
+
+// applyBuckets applies the count rules to the snapshots of one source, newest first
+func (p Policy) applyBuckets(decisions []*Decision) {
+	buckets := []struct {
+		name  string
+		count int
+		key   func(t time.Time) string // Period a snapshot falls in, nil for one per snapshot
+	}{
+		{"last", p.Last, nil},
+		{"daily", p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.Weekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{"monthly", p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, b := range buckets {
+		last := ""
+		kept := 0
+		for _, d := range decisions {
+			if kept >= b.count {
+				break
+			}
+			// Newest first, so the first snapshot seen in a period is the one kept
+			key := d.Info.Name
+			if b.key != nil {
+				key = b.key(d.Info.Created.Local())
+			}
+			if key == last {
+				continue
+			}
+			last = key
+			kept++
+			d.Keep = true
+			d.Reasons = append(d.Reasons, b.name)
+		}
+	}
+	// The newest snapshot is what is on the device now: dropping it would release
+	// files that are still there
+	if len(decisions) > 0 && !decisions[0].Keep {
+		decisions[0].Keep = true
+		decisions[0].Reasons = append(decisions[0].Reasons, "latest")
+	}
+}
@@ -0,0 +1,162 @@
+package snapshot
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("last=3, daily=7,weekly=4,monthly=12,yearly=2,within=30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Policy{Last: 3, Daily: 7, Weekly: 4, Monthly: 12, Yearly: 2, Within: 30 * 24 * time.Hour}
+	if p != want {
+		t.Errorf("Got %+v, want %+v", p, want)
+	}
+	for _, bad := range []string{"last", "hourly=3", "daily=-1", "within=soon"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+	if p, _ := ParsePolicy(""); !p.IsZero() {
+		t.Error("Empty spec should give the zero policy")
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.Local)
+	var snaps []Info
+	// Two runs a day over the last 60 days, oldest first like List
+	for day := 59; day >= 0; day-- {
+		for _, hour := range []int{9, 20} {
+			created := time.Date(2024, 6, 30-day, hour, 0, 0, 0, time.Local)
+			snaps = append(snaps, Info{Name: NewName(created), Created: created})
+		}
+	}
+
+	kept := func(p Policy) []string {
+		var names []string
+		for _, d := range p.Apply(snaps, now) {
+			if d.Keep {
+				names = append(names, d.Info.Name)
+			}
+		}
+		return names
+	}
+
+	if got := kept(Policy{Last: 3}); !slices.Equal(got, []string{"2024-06-30_200000", "2024-06-30_090000", "2024-06-29_200000"}) {
+		t.Errorf("last=3 kept %v", got)
+	}
+	if got := kept(Policy{Daily: 2}); !slices.Equal(got, []string{"2024-06-30_200000", "2024-06-29_200000"}) {
+		t.Errorf("daily=2 kept %v", got)
+	}
+	// Only May and June have runs
+	if got := kept(Policy{Monthly: 3}); !slices.Equal(got, []string{"2024-06-30_200000", "2024-05-31_200000"}) {
+		t.Errorf("monthly=3 kept %v", got)
+	}
+	// 2024-06-30 is a Sunday: the newest run of the previous week is Sunday 23rd
+	if got := kept(Policy{Weekly: 2}); !slices.Equal(got, []string{"2024-06-30_200000", "2024-06-23_200000"}) {
+		t.Errorf("weekly=2 kept %v", got)
+	}
+	if got := kept(Policy{Within: 24 * time.Hour}); len(got) != 3 {
+		t.Errorf("within=24h kept %v", got)
+	}
+	if got := kept(Policy{Within: time.Hour}); !slices.Equal(got, []string{"2024-06-30_200000"}) {
+		t.Errorf("The newest snapshot must always be kept, got %v", got)
+	}
+	if got := kept(Policy{}); len(got) != len(snaps) {
+		t.Errorf("Zero policy kept %d of %d", len(got), len(snaps))
+	}
+
+	// Rules add up
+	decisions := Policy{Last: 1, Daily: 2}.Apply(snaps, now)
+	if !slices.Equal(decisions[0].Reasons, []string{"last", "daily"}) || !decisions[2].Keep || decisions[1].Keep {
+		t.Errorf("Unexpected combined decisions %+v", decisions[:3])
+	}
+
+	// DCIM and Download backed up alternately into one folder keep their own last=1
+	var mixed []Info
+	for i, source := range []string{"/sdcard/DCIM", "/sdcard/Download", "/sdcard/DCIM", "/sdcard/Download"} {
+		created := now.Add(time.Duration(i-4) * time.Hour)
+		mixed = append(mixed, Info{Name: NewName(created), Created: created, Source: source})
+	}
+	var names []string
+	for _, d := range (Policy{Last: 1}).Apply(mixed, now) {
+		if d.Keep {
+			names = append(names, d.Info.Source)
+		}
+	}
+	if !slices.Equal(names, []string{"/sdcard/Download", "/sdcard/DCIM"}) {
+		t.Errorf("last=1 over two sources kept %v", names)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join("2024", "01", "kept.jpg"), "kept")
+	write(filepath.Join("2024", "01", "deleted.jpg"), "deleted on device")
+	write(filepath.Join("2019", "01", "legacy.jpg"), "never snapshotted")
+
+	m := manifest.New()
+	entry := func(name string) manifest.Entry {
+		rel := filepath.Join("2024", "01", name)
+		m.Add("/sdcard/DCIM/"+name, rel, 1, "")
+		return manifest.Entry{OriginalPath: "/sdcard/DCIM/" + name, LocalPath: rel}
+	}
+	kept, deleted := entry("kept.jpg"), entry("deleted.jpg")
+	if err := m.Save(root); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	if _, err := Create(root, Info{Created: old}, []manifest.Entry{kept, deleted}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(root, Info{Created: old.AddDate(0, 0, 1)}, []manifest.Entry{kept}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pp, err := PlanPrune(root, Policy{Last: 1}, old.AddDate(0, 0, 2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed := pp.Removed(); len(removed) != 1 || removed[0].Name != NewName(old) {
+		t.Fatalf("Unexpected removed snapshots %+v", removed)
+	}
+	if !slices.Equal(pp.Files, []string{deleted.LocalPath}) || pp.Bytes != int64(len("deleted on device")) {
+		t.Fatalf("Unexpected released files %v (%d bytes)", pp.Files, pp.Bytes)
+	}
+
+	if err := pp.Execute(root); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := List(root); len(infos) != 1 {
+		t.Errorf("Expected 1 snapshot left, got %+v", infos)
+	}
+	for rel, want := range map[string]bool{deleted.LocalPath: false, kept.LocalPath: true, filepath.Join("2019", "01", "legacy.jpg"): true} {
+		if _, err := os.Stat(filepath.Join(root, rel)); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", rel, err == nil, want)
+		}
+	}
+	m, err = manifest.Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].LocalPath != kept.LocalPath {
+		t.Errorf("Manifest not pruned: %+v", m.Entries)
+	}
+}
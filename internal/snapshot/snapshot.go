@@ -0,0 +1,237 @@
+package snapshot
+
+import (
+	"AndroidSafeLocal/internal/adb"
+	"AndroidSafeLocal/internal/manifest"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirName is the folder inside a backup that holds its snapshots.
+// Scans of the backup folder (registry, gallery) skip it like every dot folder.
+const DirName = ".snapshots"
+
+// infoFile is written next to the snapshot manifest
+const infoFile = "snapshot.json"
+
+// partialSuffix marks a snapshot still being created, ignored by List
+const partialSuffix = ".partial"
+
+// Info describes a snapshot: the device as it was at the end of one backup run
+type Info struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Source  string    `json:"source"`  // Device folder that was scanned
+	Files   int       `json:"files"`   // Entries in the snapshot manifest
+	Bytes   int64     `json:"bytes"`   // Total size of those entries
+	Missing int       `json:"missing"` // Device files without a backup copy, e.g. failed transfers
+	Copied  int       `json:"copied"`  // Files copied because the volume has no hardlinks
+
+	Device *adb.DeviceInfo `json:"device,omitempty"` // Profile of the device at backup time
+}
+
+// NewName names a snapshot after the time it was taken, sorting chronologically
+func NewName(t time.Time) string {
+	return t.Format("2006-01-02_150405")
+}
+
+// Path returns the folder of a snapshot. It holds a manifest.json and the same
+// relative layout as the backup, so restore can use it as a backup root.
+func Path(backupRoot, name string) string {
+	return filepath.Join(backupRoot, DirName, name)
+}
+
+// Create snapshots entries of the backup at backupRoot. Files are hardlinked,
+// so unchanged files cost no space however many snapshots share them. Entries
+// with a hash but no file in the tree are recorded without a link.
+// An empty info.Name is derived from Created; Files, Bytes and Copied are filled in.
+// The snapshot manifest is encrypted with sealer, which an encrypted backup needs.
+func Create(backupRoot string, info Info, entries []manifest.Entry, sealer manifest.Sealer) (*Info, error) {
+	if sealer == nil && manifest.Sealed(backupRoot) {
+		return nil, manifest.ErrLocked
+	}
+	if info.Created.IsZero() {
+		info.Created = time.Now()
+	}
+	if info.Name == "" {
+		info.Name = NewName(info.Created)
+	}
+	if strings.ContainsAny(info.Name, `/\:`) || strings.HasPrefix(info.Name, ".") {
+		return nil, fmt.Errorf("invalid snapshot name %q", info.Name)
+	}
+	final := Path(backupRoot, info.Name)
+	if _, err := os.Stat(final); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", info.Name)
+	}
+	tmp := final + partialSuffix
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+
+	m := manifest.New()
+	// Device files deduplicated onto one backup copy share a single link
+	linked := make(map[string]bool)
+	for _, e := range entries {
+		src := filepath.Join(backupRoot, e.LocalPath)
+		if _, err := os.Stat(src); err != nil && e.Hash != "" {
+			// Only in a repository's object store, e.g. an encrypted one without a tree
+			linked[e.LocalPath] = true
+		}
+		if !linked[e.LocalPath] {
+			copied, err := link(src, filepath.Join(tmp, e.LocalPath))
+			if err != nil {
+				os.RemoveAll(tmp)
+				return nil, fmt.Errorf("snapshot %s: %w", e.LocalPath, err)
+			}
+			if copied {
+				info.Copied++
+			}
+			linked[e.LocalPath] = true
+		}
+		m.AddEntry(e)
+		info.Files++
+		info.Bytes += e.Size
+	}
+
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, err
+	}
+	if err := m.SaveSealed(tmp, sealer); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := writeInfo(tmp, &info); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return &info, nil
+}
+
+// link hardlinks src to dst, falling back to a copy on volumes without
+// hardlinks (FAT32, exFAT, some network shares)
+func link(src, dst string) (copied bool, err error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	if os.Link(src, dst) == nil {
+		return false, nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return false, err
+	}
+	return true, out.Close()
+}
+
+func writeInfo(dir string, info *Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, infoFile), data, 0644)
+}
+
+// List returns the snapshots of a backup, oldest first.
+// A backup without snapshots returns an empty list.
+func List(backupRoot string) ([]Info, error) {
+	dirs, err := os.ReadDir(filepath.Join(backupRoot, DirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var infos []Info
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasSuffix(d.Name(), partialSuffix) {
+			continue
+		}
+		info, err := readInfo(Path(backupRoot, d.Name()))
+		if err != nil {
+			continue // Not a snapshot, or one from an interrupted delete
+		}
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Created.Before(infos[j].Created) })
+	return infos, nil
+}
+
+// Unchanged returns the latest snapshot of source when it already records
+// exactly these entries and missing count, so a run that changed nothing on
+// the device or in the backup needs no new snapshot
+func Unchanged(backupRoot, source string, entries []manifest.Entry, missing int, sealer manifest.Sealer) (string, bool) {
+	infos, err := List(backupRoot)
+	if err != nil {
+		return "", false
+	}
+	for i := len(infos) - 1; i >= 0; i-- {
+		if infos[i].Source != source {
+			continue
+		}
+		if infos[i].Missing != missing || infos[i].Files != len(entries) {
+			return "", false
+		}
+		m, err := manifest.LoadSealed(Path(backupRoot, infos[i].Name), sealer)
+		if err != nil || len(m.Entries) != len(entries) {
+			return "", false
+		}
+		recorded := make(map[manifest.Entry]bool, len(m.Entries))
+		for _, e := range m.Entries {
+			recorded[e] = true
+		}
+		for _, e := range entries {
+			if !recorded[e] {
+				return "", false
+			}
+		}
+		return infos[i].Name, true
+	}
+	return "", false
+}
+
+// Load returns a snapshot's info and manifest, decrypted with sealer if it is encrypted
+func Load(backupRoot, name string, sealer manifest.Sealer) (*Info, *manifest.Manifest, error) {
+	dir := Path(backupRoot, name)
+	info, err := readInfo(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	m, err := manifest.LoadSealed(dir, sealer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return info, m, nil
+}
+
+func readInfo(dir string) (*Info, error) {
+	data, err := os.ReadFile(filepath.Join(dir, infoFile))
+	if err != nil {
+		return nil, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
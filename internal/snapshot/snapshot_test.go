@@ -0,0 +1,109 @@
+package snapshot
+
+import (
+	"AndroidSafeLocal/internal/manifest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateListLoad(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2024/01/a.jpg", "first")
+	write("2024/01/a_1.jpg", "edited")
+
+	first := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	entries := []manifest.Entry{{OriginalPath: "/sdcard/DCIM/a.jpg", LocalPath: filepath.Join("2024", "01", "a.jpg"), Size: 5}}
+	info, err := Create(root, Info{Created: first, Source: "/sdcard/DCIM"}, entries, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if info.Name != "2024-01-10_080000" || info.Files != 1 || info.Bytes != 5 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	// The device copy was edited: the second snapshot points at the new version
+	entries[0].LocalPath = filepath.Join("2024", "01", "a_1.jpg")
+	entries[0].Size = 6
+	if _, err := Create(root, Info{Created: first.Add(time.Hour)}, entries, nil); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := Create(root, Info{Name: info.Name}, entries, nil); err == nil {
+		t.Error("Expected error for an existing snapshot name")
+	}
+	if _, err := Create(root, Info{Name: "../escape"}, entries, nil); err == nil {
+		t.Error("Expected error for a name with a path separator")
+	}
+
+	// Removing the file from the backup tree leaves the snapshot copy intact
+	if err := os.Remove(filepath.Join(root, "2024", "01", "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(Path(root, info.Name), "2024", "01", "a.jpg"))
+	if err != nil || string(data) != "first" {
+		t.Errorf("Snapshot copy lost: %q, %v", data, err)
+	}
+
+	infos, err := List(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != info.Name || infos[1].Name != "2024-01-10_090000" {
+		t.Fatalf("Unexpected list %+v", infos)
+	}
+
+	_, m, err := Load(root, infos[1].Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Size != 6 {
+		t.Errorf("Unexpected snapshot manifest %+v", m.Entries)
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "2024"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "2024", "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []manifest.Entry{{OriginalPath: "/sdcard/DCIM/a.jpg", LocalPath: filepath.Join("2024", "a.jpg"), Size: 1}}
+	if _, ok := Unchanged(root, "/sdcard/DCIM", entries, 0, nil); ok {
+		t.Error("Unchanged without snapshots")
+	}
+	info, err := Create(root, Info{Source: "/sdcard/DCIM"}, entries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := Unchanged(root, "/sdcard/DCIM", entries, 0, nil); !ok || name != info.Name {
+		t.Errorf("Unchanged = %q, %v, want %q", name, ok, info.Name)
+	}
+	if _, ok := Unchanged(root, "/sdcard/DCIM", entries, 1, nil); ok {
+		t.Error("Unchanged with a new failure")
+	}
+	if _, ok := Unchanged(root, "/sdcard/DCIM", nil, 0, nil); ok {
+		t.Error("Unchanged after the file left the device")
+	}
+	if _, ok := Unchanged(root, "/sdcard/Download", entries, 0, nil); ok {
+		t.Error("Unchanged for another source")
+	}
+}
+
+func TestListWithoutSnapshots(t *testing.T) {
+	infos, err := List(t.TempDir())
+	if err != nil || len(infos) != 0 {
+		t.Errorf("Expected empty list, got %v, %v", infos, err)
+	}
+}
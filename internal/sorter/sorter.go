@@ -63,3 +63,18 @@ func (s *Sorter) extractDate(filename string) (string, string) { // year, month
 
 	return "", ""
 }
+
+// CaptureTime returns the date a file was taken: from its name when it carries
+// one (IMG_20240101_...), else from the device timestamp
+func CaptureTime(name, timestamp string) (time.Time, bool) {
+	for _, re := range []*regexp.Regexp{regexYMDSeperated, regexYMDCompact} {
+		if m := re.FindStringSubmatch(name); len(m) > 3 {
+			t, err := time.Parse("2006-01-02", m[1]+"-"+m[2]+"-"+m[3])
+			if err == nil {
+				return t, true
+			}
+		}
+	}
+	t, err := time.Parse("2006-01-02 15:04", timestamp)
+	return t, err == nil
+}
@@ -62,3 +62,24 @@ func TestGetDestination(t *testing.T) {
 		})
 	}
 }
+
+func TestCaptureTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp string
+		want      string
+		ok        bool
+	}{
+		{"IMG_20231225_120000.jpg", "2024-01-01 10:00", "2023-12-25", true},
+		{"Screenshot_2024-02-29-10-00-00.png", "", "2024-02-29", true},
+		{"IMG_20230230_bogus.jpg", "2023-03-01 09:00", "2023-03-01", true}, // Impossible date in name
+		{"random.txt", "2022-11-20 09:30", "2022-11-20", true},
+		{"random.txt", "", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CaptureTime(tt.name, tt.timestamp)
+		if ok != tt.ok || (ok && got.Format("2006-01-02") != tt.want) {
+			t.Errorf("CaptureTime(%q, %q) = %v, %v; want %s, %v", tt.name, tt.timestamp, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local stores files in a folder on this PC
+type Local struct {
+	Root string
+}
+
+// NewLocal returns the storage of a local folder, created on the first Put
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+// Path returns the local file of a storage name
+func (l *Local) Path(name string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(name))
+}
+
+func (l *Local) Put(name string, r io.Reader, size int64) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	dest := l.Path(name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".partial"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("%s: wrote %d bytes, expected %d", name, n, size)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (l *Local) Get(name string) (io.ReadCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(l.Path(name))
+}
+
+func (l *Local) Stat(name string) (Info, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := os.Stat(l.Path(name))
+	if err != nil {
+		return Info{}, err
+	}
+	if info.IsDir() {
+		return Info{}, notExist(name)
+	}
+	return Info{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) List(prefix string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(l.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable, a missing root has nothing stored yet
+		}
+		rel, _ := filepath.Rel(l.Root, p)
+		name := filepath.ToSlash(rel)
+		if p != l.Root && hidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !underPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		infos = append(infos, Info{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return sortInfos(infos), err
+}
+
+func (l *Local) Delete(name string) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(l.Path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Close() error { return nil }
+
+func (l *Local) String() string { return l.Root }
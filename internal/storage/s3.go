@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 stores files in a bucket of an S3-compatible object store (AWS, MinIO,
+// Backblaze B2, Wasabi...), addressed path-style so any endpoint works
+type S3 struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string // Key prefix, empty or ending in a slash
+	signer   s3Signer
+	client   *http.Client
+}
+
+// S3Config locates a bucket and holds the credentials to use it
+type S3Config struct {
+	Endpoint     string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// NewS3 returns the storage of a bucket. A nil client uses http.DefaultClient.
+func NewS3(cfg S3Config, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket missing")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{
+		endpoint: endpoint,
+		bucket:   cfg.Bucket,
+		prefix:   prefix,
+		signer:   s3Signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, sessionToken: cfg.SessionToken, region: cfg.Region},
+		client:   client,
+	}, nil
+}
+
+// openS3 opens s3://bucket/prefix?endpoint=...&region=... URLs. Credentials
+// come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN;
+// the region defaults to AWS_REGION and the endpoint to AWS for that region.
+func openS3(u *url.URL) (Storage, error) {
+	q := u.Query()
+	cfg := S3Config{
+		Endpoint:     q.Get("endpoint"),
+		Region:       q.Get("region"),
+		Bucket:       u.Host,
+		Prefix:       u.Path,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 credentials missing, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return NewS3(cfg, nil)
+}
+
+// request sends a signed request for key ("" for the bucket itself)
+func (s *S3) request(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false) // Sent as signed
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// Uploads stream, so the payload isn't part of the signature
+	s.signer.sign(req, unsignedPayload, time.Now())
+	return s.client.Do(req)
+}
+
+// check turns an unexpected response into an error, closing its body
+func (s *S3) check(resp *http.Response, key string, ok ...int) error {
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notExist(key)
+	}
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s (%s)", resp.Request.Method, key, e.Code, e.Message)
+	}
+	return fmt.Errorf("s3 %s %s: %s", resp.Request.Method, key, resp.Status)
+}
+
+func (s *S3) key(name string) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + name, nil
+}
+
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+	resp, err := s.request(http.MethodPut, key, nil, r, size)
+	if err != nil {
+		return err
+	}
+	if err := s.check(resp, key, http.StatusOK); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.request(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(resp, key, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Stat(name string) (Info, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return Info{}, err
+	}
+	resp, err := s.request(http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := s.check(resp, key, http.StatusOK); err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Info{Name: strings.TrimPrefix(key, s.prefix), Size: resp.ContentLength, ModTime: modified}, nil
+}
+
+// listResult is the ListObjectsV2 response body
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(prefix string) ([]Info, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + strings.TrimLeft(prefix, "/")}}
+	var infos []Info
+	for {
+		resp, err := s.request(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.check(resp, s.bucket, http.StatusOK); err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", s.bucket, err)
+		}
+		for _, c := range page.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if !hidden(name) && underPrefix(name, prefix) {
+				infos = append(infos, Info{Name: name, Size: c.Size, ModTime: c.LastModified})
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return sortInfos(infos), nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func (s *S3) Delete(name string) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+	resp, err := s.request(http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	// Deleting a missing key succeeds on S3 as well
+	if err := s.check(resp, key, http.StatusNoContent, http.StatusOK, http.StatusNotFound); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Close() error { return nil }
+
+func (s *S3) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix + " (" + s.endpoint.Host + ")"
+}
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Signer signs requests with AWS Signature Version 4
+type s3Signer struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+}
+
+// sign adds the date, payload hash and Authorization headers to req
+func (sg s3Signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sg.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sg.sessionToken)
+	}
+
+	// Host, Range and the x-amz- headers are signed
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lower := strings.ToLower(k)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + sg.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hexSHA256(canonical)
+
+	key := hmacSHA256([]byte("AWS4"+sg.secretKey), day)
+	for _, part := range []string{sg.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+sg.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and
+// the slash unless encodeSlash is set, as SigV4 requires
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// WebDAV stores files on a WebDAV server such as Nextcloud or a NAS share
+type WebDAV struct {
+	base     *url.URL // Root folder, path ending in a slash
+	user     string
+	password string
+	client   *http.Client
+}
+
+// NewWebDAV returns the storage at the folder URL base (http or https).
+// An empty user sends no credentials.
+func NewWebDAV(base *url.URL, user, password string, client *http.Client) *WebDAV {
+	b := *base
+	b.User = nil
+	if !strings.HasSuffix(b.Path, "/") {
+		b.Path += "/"
+	}
+	b.RawPath = ""
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebDAV{base: &b, user: user, password: password, client: client}
+}
+
+// openWebDAV opens webdav:// (https) and webdav+http:// URLs. The password
+// defaults to ANDROID_SAFE_LOCAL_WEBDAV_PASSWORD.
+func openWebDAV(u *url.URL) (Storage, error) {
+	base := *u
+	base.Scheme = "https"
+	if strings.EqualFold(u.Scheme, "webdav+http") {
+		base.Scheme = "http"
+	}
+	user, password := "", os.Getenv("ANDROID_SAFE_LOCAL_WEBDAV_PASSWORD")
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+	return NewWebDAV(&base, user, password, nil), nil
+}
+
+func (w *WebDAV) url(name string) string {
+	u := *w.base
+	u.Path += name
+	return u.String()
+}
+
+func (w *WebDAV) do(method, name string, body io.Reader, size int64, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+	return w.client.Do(req)
+}
+
+// check turns an unexpected response into an error, closing its body
+func (w *WebDAV) check(resp *http.Response, name string, ok ...int) error {
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notExist(name)
+	}
+	return fmt.Errorf("webdav %s %s: %s", resp.Request.Method, name, resp.Status)
+}
+
+func (w *WebDAV) Put(name string, r io.Reader, size int64) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if err := w.mkdirs(path.Dir(name)); err != nil {
+		return err
+	}
+	resp, err := w.do(http.MethodPut, name, r, size, nil)
+	if err != nil {
+		return err
+	}
+	if err := w.check(resp, name, http.StatusCreated, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// mkdirs creates dir and its parents, which WebDAV servers don't do on PUT
+func (w *WebDAV) mkdirs(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		collection := strings.Join(parts[:i+1], "/") + "/"
+		resp, err := w.do("MKCOL", collection, nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		// 405: the folder exists already
+		if err := w.check(resp, collection, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (w *WebDAV) Get(name string) (io.ReadCloser, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.do(http.MethodGet, name, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.check(resp, name, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (w *WebDAV) Stat(name string) (Info, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return Info{}, err
+	}
+	infos, dirs, err := w.propfind(name)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(infos) != 1 || len(dirs) > 0 {
+		return Info{}, notExist(name)
+	}
+	return infos[0], nil
+}
+
+func (w *WebDAV) List(prefix string) ([]Info, error) {
+	var infos []Info
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		files, dirs, err := w.propfind(dir)
+		if err != nil {
+			if dir == "" && errors.Is(err, fs.ErrNotExist) {
+				return nil, nil // Nothing stored yet
+			}
+			return nil, err
+		}
+		for _, f := range files {
+			if !hidden(f.Name) && underPrefix(f.Name, prefix) {
+				infos = append(infos, f)
+			}
+		}
+		for _, d := range dirs {
+			if d != dir && !hidden(strings.TrimSuffix(d, "/")) {
+				pending = append(pending, d)
+			}
+		}
+	}
+	return sortInfos(infos), nil
+}
+
+// multistatus is the PROPFIND response body
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				Length   int64  `xml:"getcontentlength"`
+				Modified string `xml:"getlastmodified"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+// propfind lists name and, for a folder, its direct children. Folder names end in a slash.
+func (w *WebDAV) propfind(name string) (files []Info, dirs []string, err error) {
+	resp, err := w.do("PROPFIND", name, strings.NewReader(propfindBody), int64(len(propfindBody)),
+		map[string]string{"Depth": "1", "Content-Type": "application/xml"})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := w.check(resp, name, http.StatusMultiStatus); err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, nil, fmt.Errorf("webdav PROPFIND %s: %w", name, err)
+	}
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil || !strings.HasPrefix(href.Path, w.base.Path) {
+			continue
+		}
+		rel := strings.TrimPrefix(href.Path, w.base.Path)
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				if rel != "" && !strings.HasSuffix(rel, "/") {
+					rel += "/"
+				}
+				dirs = append(dirs, rel)
+				continue
+			}
+			modified, _ := http.ParseTime(ps.Prop.Modified)
+			files = append(files, Info{Name: rel, Size: ps.Prop.Length, ModTime: modified})
+		}
+	}
+	return files, dirs, nil
+}
+
+func (w *WebDAV) Delete(name string) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	resp, err := w.do(http.MethodDelete, name, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil
+	}
+	if err := w.check(resp, name, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (w *WebDAV) Close() error { return nil }
+
+func (w *WebDAV) String() string { return w.base.String() }